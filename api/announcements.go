@@ -6,21 +6,35 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Strum355/log"
 	"github.com/UCCNetsoc/discord-bot/config"
-	"github.com/patrickmn/go-cache"
-	"github.com/spf13/viper"
+	"github.com/UCCNetsoc/discord-bot/store"
+	"github.com/bwmarrin/discordgo"
 )
 
 // Announcement for bot and rest api
 type Announcement struct {
-	Date    time.Time
-	Content string
-	*Image
+	ID          string
+	Date        time.Time
+	Edited      *time.Time
+	Deleted     bool
+	Content     string
+	Attachments []Attachment
+	Embeds      []Embed
+	Reactions   []Reaction
 }
 
+var (
+	// Announcements by message ID, kept current by the gateway handlers
+	announcementsByID = map[string]*Announcement{}
+	// IDs changed by the gateway handlers while a backfill runs, nil otherwise
+	announcementsTouched map[string]bool
+	announcementsLock    sync.RWMutex
+)
+
 type sortAnnouncements []*Announcement
 
 func (a sortAnnouncements) Len() int           { return len(a) }
@@ -33,7 +47,7 @@ func (a *sortAnnouncements) Swap(i, j int) {
 
 func getAnnouncements(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
-	limit := viper.GetInt("api.announcement_query_limit")
+	limit := config.GetInt("api.announcement_query_limit")
 	queryAmount, exists := query["q"]
 	if !exists || len(query) == 0 {
 		http.Error(w, "Please add the parameter 'q'", 400)
@@ -49,74 +63,20 @@ func getAnnouncements(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var announcements []*Announcement
-	cachedAnnouncements, found := cached.Get("announcements")
-	if found {
-		announcements = cachedAnnouncements.([]*Announcement)
-	} else {
-		announcements = []*Announcement{}
-		publicChannelID := viper.Get("discord.channels").(*config.Channels).PublicAnnouncements
-		publicAnnounce, err := session.ChannelMessages(publicChannelID, 100, "", "", "")
-		if err != nil {
-			log.WithError(err).Error("Error querying announcements for api")
-			return
-		}
-		// Get other messages from public announcements.
-		for _, message := range publicAnnounce {
-			if message.Author.ID != session.State.User.ID && len(message.Content) > viper.GetInt("api.public_message_cutoff") {
-				date, err := time.Parse(time.RFC3339, message.Timestamp.String())
-				if err != nil {
-					log.WithError(err).Error("Message time parse fail")
-					return
-				}
-				img, err := parseImage(message)
-				if err != nil {
-					log.WithError(err).Error("Message image parse fail")
-					return
-				}
-				content, err := message.ContentWithMoreMentionsReplaced(session)
-				var replaced bool
-				for _, symbol := range viper.GetStringSlice("api.remove_symbols") {
-					if strings.Contains(content, symbol) {
-						replaced = true
-						content = strings.ReplaceAll(content, symbol, "")
-					}
-				}
-				if !replaced {
-					continue
-				}
-				content = strings.TrimSpace(content)
-				if err != nil {
-					log.WithError(err).Error("Message mentions replace fail")
-					return
-				}
-				announcement := &Announcement{
-					Date:    date,
-					Content: content,
-					Image:   img,
-				}
-				announcements = append(announcements, announcement)
-			}
-		}
-		sortA := sortAnnouncements(announcements)
-		sort.Sort(&sortA)
-		cached.Set("announcements", announcements, cache.DefaultExpiration)
+	announcements, err := publicAnnouncements(false)
+	if err != nil {
+		log.WithError(err).Error("Error querying announcements for api")
+		http.Error(w, "Failed to get announcements", 500)
+		return
 	}
 	if len(announcements) > amount {
 		announcements = announcements[:amount]
 	}
 	w.Header().Set("content-type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	setCORS(w, r)
 	returnAnnouncements := []returnAnnouncement{}
 	for _, ann := range announcements {
-		announce := returnAnnouncement{
-			Date:    ann.Date.Unix(),
-			Content: ann.Content,
-		}
-		if ann.ImgData != nil {
-			announce.ImageURL = ann.ImgURL
-		}
-		returnAnnouncements = append(returnAnnouncements, announce)
+		returnAnnouncements = append(returnAnnouncements, newReturnAnnouncement(ann))
 	}
 
 	b, err := json.Marshal(returnAnnouncements)
@@ -126,3 +86,243 @@ func getAnnouncements(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Write(b)
 }
+
+// publicAnnouncements returns the announcements in the public channel, newest first
+func publicAnnouncements(includeDeleted bool) ([]*Announcement, error) {
+	announcementsLock.RLock()
+	defer announcementsLock.RUnlock()
+	current := []*Announcement{}
+	for _, ann := range announcementsByID {
+		if includeDeleted || !ann.Deleted {
+			current = append(current, ann)
+		}
+	}
+	sortA := sortAnnouncements(current)
+	sort.Sort(&sortA)
+	return current, nil
+}
+
+// loadAnnouncements reads announcements persisted by previous runs
+func loadAnnouncements() error {
+	if err := store.CreateTables(
+		"CREATE TABLE IF NOT EXISTS announcements(id VARCHAR(32) PRIMARY KEY, date TIMESTAMPTZ NOT NULL, deleted BOOLEAN NOT NULL DEFAULT FALSE, data JSONB NOT NULL);",
+	); err != nil {
+		return err
+	}
+	rows, err := store.DB.Query("SELECT data FROM announcements")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	announcementsLock.Lock()
+	defer announcementsLock.Unlock()
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		ann := &Announcement{}
+		if err := json.Unmarshal(data, ann); err != nil {
+			return err
+		}
+		announcementsByID[ann.ID] = ann
+	}
+	return rows.Err()
+}
+
+// backfillAnnouncements pages back through the announcements channel up to api.announcement_history messages,
+// catching up on anything posted, edited or deleted while the bot was offline.
+// Messages the gateway handlers change while it runs are left alone, the fetched copies are older.
+func backfillAnnouncements() error {
+	announcementsLock.Lock()
+	announcementsTouched = map[string]bool{}
+	announcementsLock.Unlock()
+	defer func() {
+		announcementsLock.Lock()
+		announcementsTouched = nil
+		announcementsLock.Unlock()
+	}()
+
+	publicChannelID := config.Get().Channels().PublicAnnouncements
+	history := config.GetInt("api.announcement_history")
+
+	messages := []*discordgo.Message{}
+	before := ""
+	for len(messages) < history {
+		batch, err := session.ChannelMessages(publicChannelID, 100, before, "", "")
+		if err != nil {
+			return err
+		}
+		messages = append(messages, batch...)
+		if len(batch) < 100 {
+			break
+		}
+		before = batch[len(batch)-1].ID
+	}
+
+	found := map[string]bool{}
+	fetched := []*Announcement{}
+	var oldest time.Time
+	for _, message := range messages {
+		if oldest.IsZero() || message.Timestamp.Before(oldest) {
+			oldest = message.Timestamp
+		}
+		if announcement, ok := newAnnouncement(message); ok {
+			found[announcement.ID] = true
+			fetched = append(fetched, announcement)
+		}
+	}
+
+	announcementsLock.Lock()
+	defer announcementsLock.Unlock()
+	for _, announcement := range fetched {
+		if !announcementsTouched[announcement.ID] {
+			storeAnnouncement(announcement)
+		}
+	}
+	missing := []*Announcement{}
+	for id, ann := range announcementsByID {
+		// Only messages inside the fetched window can be known to be deleted
+		if !found[id] && !ann.Deleted && !ann.Date.Before(oldest) && !announcementsTouched[id] {
+			missing = append(missing, ann)
+		}
+	}
+	for _, ann := range missing {
+		deleted := *ann
+		deleted.Deleted = true
+		storeAnnouncement(&deleted)
+	}
+	log.WithFields(log.Fields{"messages": len(messages), "announcements": len(found)}).Info("Backfilled announcements")
+	return nil
+}
+
+// saveAnnouncement updates the in-memory list and persists the announcement
+func saveAnnouncement(ann *Announcement) {
+	announcementsLock.Lock()
+	defer announcementsLock.Unlock()
+	touchAnnouncement(ann.ID)
+	storeAnnouncement(ann)
+}
+
+// deleteAnnouncement marks an announcement deleted, returning it if it was known
+func deleteAnnouncement(id string) (*Announcement, bool) {
+	announcementsLock.Lock()
+	defer announcementsLock.Unlock()
+	// Touched even when unknown, so a backfill fetched before the delete doesn't add it
+	touchAnnouncement(id)
+	ann, ok := announcementsByID[id]
+	if !ok {
+		return nil, false
+	}
+	deleted := *ann
+	deleted.Deleted = true
+	storeAnnouncement(&deleted)
+	return &deleted, true
+}
+
+// removeAnnouncement forgets a message which is no longer an announcement
+func removeAnnouncement(id string) {
+	announcementsLock.Lock()
+	defer announcementsLock.Unlock()
+	touchAnnouncement(id)
+	delete(announcementsByID, id)
+
+	if _, err := store.DB.Exec("DELETE FROM announcements WHERE id = $1;", id); err != nil {
+		log.WithError(err).Error("Failed to remove announcement")
+	}
+}
+
+// touchAnnouncement records a change from the gateway during a backfill, announcementsLock must be held
+func touchAnnouncement(id string) {
+	if announcementsTouched != nil {
+		announcementsTouched[id] = true
+	}
+}
+
+// storeAnnouncement with announcementsLock held, so the database is written in the same order as the list
+func storeAnnouncement(ann *Announcement) {
+	announcementsByID[ann.ID] = ann
+
+	data, err := json.Marshal(ann)
+	if err != nil {
+		log.WithError(err).Error("Failed to marshal announcement")
+		return
+	}
+	_, err = store.DB.Exec(
+		"INSERT INTO announcements VALUES($1, $2, $3, $4) ON CONFLICT (id) DO UPDATE SET date = $2, deleted = $3, data = $4;",
+		ann.ID, ann.Date, ann.Deleted, data,
+	)
+	if err != nil {
+		log.WithError(err).Error("Failed to store announcement")
+	}
+}
+
+// newAnnouncement converts a message into an announcement, if it is one.
+// Announcements are messages not from the bot that ping everyone.
+func newAnnouncement(message *discordgo.Message) (*Announcement, bool) {
+	if message.Author == nil || message.Author.ID == session.State.User.ID || len(message.Content) <= config.GetInt("api.public_message_cutoff") {
+		return nil, false
+	}
+	content, err := message.ContentWithMoreMentionsReplaced(session)
+	if err != nil {
+		log.WithError(err).Error("Message mentions replace fail")
+		content = message.ContentWithMentionsReplaced()
+	}
+	var replaced bool
+	for _, symbol := range config.GetStringSlice("api.remove_symbols") {
+		if strings.Contains(content, symbol) {
+			replaced = true
+			content = strings.ReplaceAll(content, symbol, "")
+		}
+	}
+	if !replaced {
+		return nil, false
+	}
+
+	announcement := &Announcement{
+		ID:      message.ID,
+		Date:    message.Timestamp,
+		Edited:  message.EditedTimestamp,
+		Content: strings.TrimSpace(content),
+	}
+	for _, attachment := range message.Attachments {
+		announcement.Attachments = append(announcement.Attachments, newAttachment(attachment))
+	}
+	for _, emb := range message.Embeds {
+		announcement.Embeds = append(announcement.Embeds, newEmbed(emb))
+	}
+	for _, reaction := range message.Reactions {
+		announcement.Reactions = append(announcement.Reactions, newReaction(reaction))
+	}
+	return announcement, true
+}
+
+func newReturnAnnouncement(ann *Announcement) returnAnnouncement {
+	announce := returnAnnouncement{
+		ID:          ann.ID,
+		Date:        ann.Date.Unix(),
+		Deleted:     ann.Deleted,
+		Content:     ann.Content,
+		Attachments: ann.Attachments,
+		Embeds:      ann.Embeds,
+		Reactions:   ann.Reactions,
+	}
+	if ann.Edited != nil {
+		edited := ann.Edited.Unix()
+		announce.EditedDate = &edited
+	}
+	if img := ann.GetImage(); img != nil {
+		announce.ImageURL = img.URL
+	}
+	if announce.Attachments == nil {
+		announce.Attachments = []Attachment{}
+	}
+	if announce.Embeds == nil {
+		announce.Embeds = []Embed{}
+	}
+	if announce.Reactions == nil {
+		announce.Reactions = []Reaction{}
+	}
+	return announce
+}
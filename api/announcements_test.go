@@ -0,0 +1,266 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/UCCNetsoc/discord-bot/store"
+	"github.com/bwmarrin/discordgo"
+	"github.com/spf13/viper"
+)
+
+func TestMain(m *testing.M) {
+	log.InitSimpleLogger(&log.Config{Output: io.Discard})
+	os.Exit(m.Run())
+}
+
+const testChannel = "announcements"
+
+// useTestConfig loads a config with only the required settings and the announcements channel
+func useTestConfig(t *testing.T) {
+	t.Helper()
+	for key, value := range map[string]string{
+		"DISCORD_TOKEN":            "test",
+		"DISCORD_PUBLIC_SERVER":    "1",
+		"DISCORD_COMMITTEE_SERVER": "2",
+		"DISCORD_PUBLIC_CHANNEL":   testChannel,
+	} {
+		t.Setenv(key, value)
+	}
+	if err := config.InitConfig(""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setConfig overrides a setting until the test ends. viper isn't reset, config.InitConfig keeps using the global one.
+func setConfig(t *testing.T, key string, value interface{}) {
+	t.Helper()
+	viper.Set(key, value)
+	t.Cleanup(func() { viper.Set(key, nil) })
+}
+
+// fakeStore keeps the announcements table in memory
+type fakeStore struct {
+	lock sync.Mutex
+	rows map[string]Announcement
+}
+
+func useFakeStore(t *testing.T) *fakeStore {
+	t.Helper()
+	fake := &fakeStore{rows: map[string]Announcement{}}
+	previous := store.DB
+	store.DB = sql.OpenDB(fake)
+	t.Cleanup(func() {
+		store.DB.Close()
+		store.DB = previous
+	})
+	return fake
+}
+
+func (f *fakeStore) row(id string) (Announcement, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	ann, ok := f.rows[id]
+	return ann, ok
+}
+
+func (f *fakeStore) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeStore) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ store *fakeStore }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.store, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+type fakeStmt struct {
+	store *fakeStore
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.store.lock.Lock()
+	defer s.store.lock.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE"):
+	case strings.HasPrefix(s.query, "INSERT INTO announcements"):
+		ann := Announcement{}
+		if err := json.Unmarshal(args[3].([]byte), &ann); err != nil {
+			return nil, err
+		}
+		if ann.Deleted != args[2].(bool) {
+			return nil, fmt.Errorf("deleted column %t doesn't match the data", args[2])
+		}
+		s.store.rows[args[0].(string)] = ann
+	case strings.HasPrefix(s.query, "DELETE FROM announcements"):
+		delete(s.store.rows, args[0].(string))
+	default:
+		return nil, fmt.Errorf("unexpected exec %q", s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, fmt.Errorf("unexpected query %q", s.query)
+}
+
+// fakeChannel serves the messages in the announcements channel. During lists calls duringList before answering,
+// with the messages as they were when the list was requested.
+type fakeChannel struct {
+	lock       sync.Mutex
+	messages   map[string]*discordgo.Message
+	duringList func()
+}
+
+func newFakeChannel(t *testing.T, messages ...*discordgo.Message) *fakeChannel {
+	t.Helper()
+	fake := &fakeChannel{messages: map[string]*discordgo.Message{}}
+	for _, message := range messages {
+		fake.messages[message.ID] = message
+	}
+	server := httptest.NewServer(fake)
+	previous := discordgo.EndpointChannels
+	discordgo.EndpointChannels = server.URL + "/channels/"
+	t.Cleanup(func() {
+		discordgo.EndpointChannels = previous
+		server.Close()
+	})
+	s, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.State.User = &discordgo.User{ID: "bot"}
+	previousSession := session
+	session = s
+	t.Cleanup(func() { session = previousSession })
+	return fake
+}
+
+func (f *fakeChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/channels/"+testChannel+"/messages")
+	f.lock.Lock()
+	if path == "" {
+		list := []*discordgo.Message{}
+		for _, message := range f.messages {
+			list = append(list, message)
+		}
+		f.lock.Unlock()
+		if f.duringList != nil {
+			f.duringList()
+		}
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+	defer f.lock.Unlock()
+	message, ok := f.messages[strings.TrimPrefix(path, "/")]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"message": "Unknown Message", "code": 10008}`)
+		return
+	}
+	json.NewEncoder(w).Encode(message)
+}
+
+func (f *fakeChannel) set(message *discordgo.Message) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.messages[message.ID] = message
+}
+
+func (f *fakeChannel) delete(id string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.messages, id)
+}
+
+func announcementMessage(id, content string, date time.Time) *discordgo.Message {
+	return &discordgo.Message{
+		ID:        id,
+		ChannelID: testChannel,
+		Content:   "@everyone " + content,
+		Timestamp: date,
+		Author:    &discordgo.User{ID: "committee"},
+	}
+}
+
+func TestBackfillInterleavedWithGateway(t *testing.T) {
+	useTestConfig(t)
+	db := useFakeStore(t)
+	announcementsByID = map[string]*Announcement{}
+	t.Cleanup(func() { announcementsByID = map[string]*Announcement{} })
+
+	start := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+	edited := announcementMessage("1", "first, edited during the backfill", start)
+	messages := []*discordgo.Message{
+		announcementMessage("1", "first", start),
+		announcementMessage("2", "second", start.Add(time.Hour)),
+		announcementMessage("3", "posted while offline", start.Add(2*time.Hour)),
+		announcementMessage("5", "untouched", start.Add(4*time.Hour)),
+	}
+	channel := newFakeChannel(t, messages...)
+	for _, message := range messages[:2] {
+		ann, _ := newAnnouncement(message)
+		saveAnnouncement(ann)
+	}
+	// Deleted while offline
+	gone, _ := newAnnouncement(announcementMessage("4", "deleted while offline", start.Add(3*time.Hour)))
+	saveAnnouncement(gone)
+
+	// The gateway sees changes after the channel was read, but before the backfill saves what it read
+	channel.duringList = func() {
+		channel.set(edited)
+		announcementUpdate(session, &discordgo.MessageUpdate{Message: edited})
+		for _, id := range []string{"2", "3"} {
+			channel.delete(id)
+			announcementDelete(session, &discordgo.MessageDelete{Message: &discordgo.Message{ID: id, ChannelID: testChannel}})
+		}
+	}
+	if err := backfillAnnouncements(); err != nil {
+		t.Fatal(err)
+	}
+
+	announcements, _ := publicAnnouncements(true)
+	got := map[string]Announcement{}
+	for _, ann := range announcements {
+		got[ann.ID] = *ann
+		if row, ok := db.row(ann.ID); !ok || row.Deleted != ann.Deleted || row.Content != ann.Content {
+			t.Errorf("%s stored as %+v, listed as %+v", ann.ID, row, *ann)
+		}
+	}
+	if got["1"].Content != "first, edited during the backfill" {
+		t.Errorf("edit during the backfill overwritten with %q", got["1"].Content)
+	}
+	if !got["2"].Deleted {
+		t.Error("delete during the backfill undone")
+	}
+	if _, ok := got["3"]; ok {
+		t.Error("message deleted during the backfill added from the older list")
+	}
+	if !got["4"].Deleted {
+		t.Error("message deleted while offline not marked deleted")
+	}
+	if got["5"].Content != "untouched" || got["5"].Deleted {
+		t.Errorf("message posted while offline backfilled as %+v", got["5"])
+	}
+
+	// Later changes aren't tracked once the backfill is done
+	if announcementsTouched != nil {
+		t.Error("still tracking gateway changes after the backfill")
+	}
+}
@@ -1,32 +1,41 @@
 package api
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/charts"
 	"github.com/UCCNetsoc/discord-bot/config"
 	"github.com/UCCNetsoc/discord-bot/corona"
 	"github.com/bwmarrin/discordgo"
 	"github.com/patrickmn/go-cache"
-	"github.com/spf13/viper"
 )
 
 type returnEvent struct {
+	ID          string     `json:"id"`
 	Title       string     `json:"title"`
 	Description string     `json:"description"`
 	ImageURL    string     `json:"image_url"`
 	StartDate   *time.Time `json:"start_date"`
 	EndDate     *time.Time `json:"end_date"`
+	Duration    int64      `json:"duration"` // Seconds
+	AllDay      bool       `json:"all_day"`
 }
 
 type returnAnnouncement struct {
-	Date     int64  `json:"date"`
-	Content  string `json:"content"`
-	ImageURL string `json:"image_url"`
+	ID          string       `json:"id"`
+	Date        int64        `json:"date"`
+	EditedDate  *int64       `json:"edited_date"`
+	Deleted     bool         `json:"deleted"`
+	Content     string       `json:"content"`
+	ImageURL    string       `json:"image_url"`
+	Attachments []Attachment `json:"attachments"`
+	Embeds      []Embed      `json:"embeds"`
+	Reactions   []Reaction   `json:"reactions"`
 }
 
 type returnMembers struct {
@@ -34,36 +43,61 @@ type returnMembers struct {
 }
 
 var (
-	cached  *cache.Cache
+	// Created up front, other packages read the cached events before Run gets to them
+	cached  = cache.New(3*time.Minute, 3*time.Minute)
 	session *discordgo.Session
 )
 
 // Run the REST API
 func Run(s *discordgo.Session) {
-	cached = cache.New(3*time.Minute, 3*time.Minute)
-
 	session = s
 
+	if err := loadAnnouncements(); err != nil {
+		log.WithError(err).Error("Failed to load stored announcements")
+	}
+	s.AddHandler(announcementCreate)
+	s.AddHandler(announcementUpdate)
+	s.AddHandler(announcementDelete)
+	s.AddHandler(announcementReactionAdd)
+	s.AddHandler(announcementReactionRemove)
+	go func() {
+		if err := backfillAnnouncements(); err != nil {
+			log.WithError(err).Error("Failed to backfill announcements")
+		}
+	}()
+
 	http.HandleFunc("/events", getEvents)
 	http.HandleFunc("/announcements", getAnnouncements)
 	http.HandleFunc("/getMembers", getMembers)
+	http.Handle("/v1/", v1Router())
+	http.HandleFunc("/newsletter/unsubscribe", unsubscribeNewsletter)
+	http.HandleFunc("/github", postGitHub)
+
+	go watchCalendar()
 
 	http.HandleFunc("/corona", postCorona)
 	setWebhook()
 
-	http.ListenAndServe(fmt.Sprintf(":%d", viper.GetInt("api.port")), nil)
+	http.ListenAndServe(fmt.Sprintf(":%d", config.GetInt("api.port")), nil)
 }
 
+// setWebhook has covid19api push its summaries to corona.webhook
 func setWebhook() {
-	b := bytes.NewBuffer([]byte{})
-	json.NewEncoder(b).Encode(struct {
-		URL string
-	}{
-		viper.GetString("corona.webhook"),
-	})
-	resp, _ := http.Post("https://api.covid19api.com/webhook", "application/json", b)
-	b.ReadFrom(resp.Body)
-	log.Info(fmt.Sprintf("Corona webhook activation: %s %d", b.String(), resp.StatusCode))
+	combined, ok := corona.Data.(*corona.Combined)
+	if !ok || config.GetString("corona.provider") != "http" {
+		return
+	}
+	global, ok := combined.Global.(*corona.Covid19API)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := global.RegisterWebhook(ctx, config.GetString("corona.webhook")); err != nil {
+		log.WithError(err).Error("Failed to activate corona webhook")
+		return
+	}
+	log.Info("Corona webhook activated")
 }
 
 func postCorona(w http.ResponseWriter, r *http.Request) {
@@ -76,20 +110,20 @@ func postCorona(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
-	country := total.GetCountry(viper.GetString("corona.default"))
+	country := total.GetCountry(config.GetString("corona.default"))
 	log.WithContext(r.Context()).Info("New COVID data. Sending.")
-	embs, err := corona.CreateEmbed(country, session, r.Context())
+	embs, graphs, err := corona.CreateEmbed(country, r.Context(), corona.Options{})
 	if err != nil {
 		return
 	}
-	for _, emb := range embs {
-		session.ChannelMessageSendEmbed(viper.GetString("discord.public.corona"), emb)
-	}
+	session.ChannelMessageSendComplex(config.GetString("discord.public.corona"), &discordgo.MessageSend{
+		Embeds: embs,
+		Files:  charts.Files(graphs...),
+	})
 }
 
 func getMembers(w http.ResponseWriter, r *http.Request) {
-	servers := viper.Get("discord.servers").(*config.Servers)
-	members, err := session.GuildMembers(servers.PublicServer, "", 1000)
+	count, err := publicMemberCount()
 	if err != nil {
 		log.WithError(err).Error("Failed to get members")
 		http.Error(w, "Failed to get members", 500)
@@ -97,7 +131,16 @@ func getMembers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("content-type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	setCORS(w, r)
 
-	json.NewEncoder(w).Encode(returnMembers{Count: len(members)})
+	json.NewEncoder(w).Encode(returnMembers{Count: count})
+}
+
+func publicMemberCount() (int, error) {
+	servers := config.Get().Servers()
+	members, err := session.GuildMembers(servers.PublicServer, "", 1000)
+	if err != nil {
+		return 0, err
+	}
+	return len(members), nil
 }
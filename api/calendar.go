@@ -0,0 +1,150 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/apognu/gocal"
+
+	// The production image is alpine based and ships without zoneinfo
+	_ "time/tzdata"
+)
+
+const (
+	icsDateTime       = "20060102T150405"
+	icsDateTimeUTC    = "20060102T150405Z"
+	calendarLookahead = 30 * 24 * time.Hour
+)
+
+// CalendarLocation returns the timezone calendar events are displayed in.
+func CalendarLocation() *time.Location {
+	loc, err := time.LoadLocation(config.GetString("google.calendar.timezone"))
+	if err != nil {
+		log.WithError(err).Error("Invalid calendar timezone, falling back to UTC")
+		return time.UTC
+	}
+	return loc
+}
+
+// IsAllDay reports whether an event was declared with DATE rather than DATE-TIME values.
+func IsAllDay(event gocal.Event) bool {
+	return event.RawStart.Params["VALUE"] == "DATE" || len(event.RawStart.Value) == len("20060102")
+}
+
+// EventDuration returns how long an event lasts.
+func EventDuration(event gocal.Event) time.Duration {
+	if event.Start == nil || event.End == nil {
+		return 0
+	}
+	return event.End.Sub(*event.Start)
+}
+
+// normaliseICS rewrites the properties gocal loses timezone information for.
+// EXDATE and RECURRENCE-ID are parsed by gocal without their TZID parameter and only
+// one value per line is understood, so they are split and converted to UTC.
+// Floating DTSTART/DTEND values are pinned to loc instead of the host's local time.
+func normaliseICS(r io.Reader, loc *time.Location) (*bytes.Buffer, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		// Unfold continuation lines - https://datatracker.ietf.org/doc/html/rfc5545#section-3.1
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	out := bytes.NewBuffer([]byte{})
+	for _, line := range lines {
+		tokens := strings.SplitN(line, ":", 2)
+		if len(tokens) < 2 {
+			fmt.Fprintf(out, "%s\r\n", line)
+			continue
+		}
+		params := strings.Split(tokens[0], ";")
+		name := strings.ToUpper(params[0])
+		tzid, isDate := "", false
+		for _, param := range params[1:] {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch strings.ToUpper(kv[0]) {
+			case "TZID":
+				tzid = strings.Trim(kv[1], `"`)
+			case "VALUE":
+				isDate = strings.EqualFold(kv[1], "DATE")
+			}
+		}
+
+		switch name {
+		case "EXDATE", "RECURRENCE-ID":
+			for _, value := range strings.Split(tokens[1], ",") {
+				value = strings.TrimSpace(value)
+				if isDate || len(value) == len("20060102") {
+					fmt.Fprintf(out, "%s;VALUE=DATE:%s\r\n", name, value)
+					continue
+				}
+				t, err := parseICSTime(value, tzid, loc)
+				if err != nil {
+					return nil, fmt.Errorf("could not parse %s %q: %w", name, value, err)
+				}
+				fmt.Fprintf(out, "%s:%s\r\n", name, t.UTC().Format(icsDateTimeUTC))
+			}
+		case "DTSTART", "DTEND":
+			if !isDate && tzid == "" && len(tokens[1]) == len(icsDateTime) {
+				fmt.Fprintf(out, "%s;TZID=%s:%s\r\n", tokens[0], loc.String(), tokens[1])
+			} else {
+				fmt.Fprintf(out, "%s\r\n", line)
+			}
+		default:
+			fmt.Fprintf(out, "%s\r\n", line)
+		}
+	}
+	return out, nil
+}
+
+func parseICSTime(value, tzid string, loc *time.Location) (time.Time, error) {
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(icsDateTimeUTC, value)
+	}
+	if tzid != "" {
+		tz, err := time.LoadLocation(tzid)
+		if err == nil {
+			loc = tz
+		}
+	}
+	return time.ParseInLocation(icsDateTime, value, loc)
+}
+
+// localiseEvent converts an event's times into loc.
+// gocal parses all-day events as UTC midnights, these are moved to midnight in loc
+// with an exclusive end so durations are whole days.
+func localiseEvent(event *gocal.Event, loc *time.Location) {
+	if event.Start == nil || event.End == nil {
+		return
+	}
+	var start, end time.Time
+	if IsAllDay(*event) {
+		s := event.Start.UTC()
+		e := event.End.UTC().Add(-time.Millisecond)
+		start = time.Date(s.Year(), s.Month(), s.Day(), 0, 0, 0, 0, loc)
+		end = time.Date(e.Year(), e.Month(), e.Day()+1, 0, 0, 0, 0, loc)
+	} else {
+		start, end = event.Start.In(loc), event.End.In(loc)
+	}
+	duration := end.Sub(start)
+	event.Start, event.End, event.Duration = &start, &end, &duration
+}
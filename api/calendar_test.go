@@ -0,0 +1,124 @@
+package api
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apognu/gocal"
+)
+
+var dublin, _ = time.LoadLocation("Europe/Dublin")
+
+// parseFixture parses an ICS fixture like QueryCalendarEvents, over a fixed window rather than the next 30 days
+func parseFixture(t *testing.T, name string, start, end time.Time) map[string][]gocal.Event {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := normaliseICS(f, dublin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := gocal.NewParser(r)
+	parser.Start, parser.End = &start, &end
+	if err = parser.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	events := map[string][]gocal.Event{}
+	for _, event := range parser.Events {
+		localiseEvent(&event, dublin)
+		events[event.Uid] = append(events[event.Uid], event)
+	}
+	return events
+}
+
+func TestNormaliseICS(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"floating times are pinned", "DTSTART:20240331T003000", []string{"DTSTART;TZID=Europe/Dublin:20240331T003000"}},
+		{"UTC times are kept", "DTSTART:20240331T120000Z", []string{"DTSTART:20240331T120000Z"}},
+		{"dates are kept", "DTEND;VALUE=DATE:20240401", []string{"DTEND;VALUE=DATE:20240401"}},
+		{"zoned times are kept", "DTSTART;TZID=America/New_York:20240330T090000", []string{"DTSTART;TZID=America/New_York:20240330T090000"}},
+		{"exdates are split and converted to UTC", "EXDATE;TZID=Europe/Dublin:20240330T190000,20240331T190000", []string{"EXDATE:20240330T190000Z", "EXDATE:20240331T180000Z"}},
+		{"date exdates keep their type", "EXDATE;VALUE=DATE:20240330", []string{"EXDATE;VALUE=DATE:20240330"}},
+		{"folded lines are joined", "SUMMARY:Weekly\r\n  meeting", []string{"SUMMARY:Weekly meeting"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := normaliseICS(strings.NewReader(test.in), dublin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := strings.Split(strings.TrimSuffix(out.String(), "\r\n"), "\r\n")
+			if strings.Join(got, "|") != strings.Join(test.want, "|") {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLocaliseEvent(t *testing.T) {
+	window := []time.Time{time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)}
+	events := parseFixture(t, "timezones.ics", window[0], window[1])
+	for uid, event := range parseFixture(t, "allday.ics", window[0], window[1]) {
+		events[uid] = event
+	}
+	tests := []struct {
+		uid      string
+		start    string
+		end      string
+		duration time.Duration
+		allDay   bool
+	}{
+		// Clocks go forward at 01:00 on the 31st, so two hours on the clock is one hour long
+		{"floating@netsoc.co", "2024-03-31T00:30:00Z", "2024-03-31T02:30:00+01:00", time.Hour, false},
+		{"utc@netsoc.co", "2024-03-31T13:00:00+01:00", "2024-03-31T14:30:00+01:00", 90 * time.Minute, false},
+		{"zoned@netsoc.co", "2024-03-30T13:00:00Z", "2024-03-30T14:00:00Z", time.Hour, false},
+		// All-day events run midnight to midnight in the calendar timezone, 47 hours over spring forward
+		{"allday@netsoc.co", "2024-03-30T00:00:00Z", "2024-04-01T00:00:00+01:00", 47 * time.Hour, true},
+		{"oneday@netsoc.co", "2024-10-27T00:00:00+01:00", "2024-10-28T00:00:00Z", 25 * time.Hour, true},
+	}
+	for _, test := range tests {
+		t.Run(test.uid, func(t *testing.T) {
+			if len(events[test.uid]) != 1 {
+				t.Fatalf("got %d events, want 1", len(events[test.uid]))
+			}
+			event := events[test.uid][0]
+			if got := event.Start.Format(time.RFC3339); got != test.start {
+				t.Errorf("start %s, want %s", got, test.start)
+			}
+			if got := event.End.Format(time.RFC3339); got != test.end {
+				t.Errorf("end %s, want %s", got, test.end)
+			}
+			if event.Start.Location() != dublin {
+				t.Errorf("start in %s, want %s", event.Start.Location(), dublin)
+			}
+			if got := EventDuration(event); got != test.duration {
+				t.Errorf("duration %s, want %s", got, test.duration)
+			}
+			if got := IsAllDay(event); got != test.allDay {
+				t.Errorf("all day %t, want %t", got, test.allDay)
+			}
+		})
+	}
+}
+
+func TestRecurringOverDSTEnd(t *testing.T) {
+	events := parseFixture(t, "recurring.ics", time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC))
+	got := []string{}
+	for _, event := range events["weekly@netsoc.co"] {
+		got = append(got, event.Start.Format(time.RFC3339))
+	}
+	// Still 19:00 after the clocks go back on the 27th, without the excluded weeks
+	want := []string{"2024-10-15T19:00:00+01:00", "2024-10-29T19:00:00Z"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
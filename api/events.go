@@ -1,9 +1,8 @@
 package api
 
 import (
-	"bytes"
 	"encoding/json"
-	"io/ioutil"
+	"fmt"
 	"net/http"
 	"sort"
 	"strconv"
@@ -11,14 +10,14 @@ import (
 	"time"
 
 	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
 	"github.com/apognu/gocal"
 	"github.com/patrickmn/go-cache"
-	"github.com/spf13/viper"
 )
 
 func getEvents(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
-	limit := viper.GetInt("api.event_query_limit")
+	limit := config.GetInt("api.event_query_limit")
 	queryAmount, exists := query["q"]
 	if !exists || len(query) == 0 {
 		http.Error(w, "Please add the parameter 'q'", 400)
@@ -34,51 +33,21 @@ func getEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var events []gocal.Event
-	cachedEvents, found := cached.Get("events")
-	if found {
-		events = cachedEvents.([]gocal.Event)
-	} else {
-		events, err = QueryCalendarEvents(viper.GetString("google.calendar.public.ics"))
-		if err != nil {
-			http.Error(w, err.Error(), 400)
-			return
-		}
-		cached.Set("events", events, cache.DefaultExpiration)
+	events, err := PublicEvents()
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
 	}
 
 	w.Header().Set("content-type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	setCORS(w, r)
 
 	returnEvents := []returnEvent{}
 	for i, event := range events {
 		if i == amount {
 			break
 		}
-
-		eventImgURL := viper.GetString("google.calendar.image.default")
-		if len(event.Attachments) > 0 {
-			for _, attachment := range event.Attachments {
-				if attachment.Mime[:5] == "image" {
-					if strings.Contains(attachment.Value, "drive.google.com/file/d/") {
-						id := strings.Split(attachment.Value, "/d/")[1]
-						id = strings.Split(id, "/view")[0]
-						eventImgURL = "https://drive.google.com/uc?export=download&id=" + id
-					} else if strings.Contains(attachment.Value, "drive.google.com/open?id=") {
-						id := strings.Split(attachment.Value, "open?id=")[1]
-						eventImgURL = "https://drive.google.com/uc?export=download&id=" + id
-					}
-				}
-			}
-		}
-		formattedDescription := strings.ReplaceAll(event.Description, `\n`, "\n")
-		returnEvents = append(returnEvents, returnEvent{
-			event.Summary,
-			formattedDescription,
-			eventImgURL,
-			event.Start,
-			event.End,
-		})
+		returnEvents = append(returnEvents, newReturnEvent(event))
 	}
 	b, err := json.Marshal(returnEvents)
 	if err != nil {
@@ -88,6 +57,72 @@ func getEvents(w http.ResponseWriter, r *http.Request) {
 	w.Write(b)
 }
 
+// PublicEvents returns the public calendar's upcoming events, cached for a few minutes
+func PublicEvents() ([]gocal.Event, error) {
+	if cachedEvents, found := cached.Get("events"); found {
+		return cachedEvents.([]gocal.Event), nil
+	}
+	events, err := QueryCalendarEvents(config.GetString("google.calendar.public.ics"))
+	if err != nil {
+		return nil, err
+	}
+	cached.Set("events", events, cache.DefaultExpiration)
+	return events, nil
+}
+
+func newReturnEvent(event gocal.Event) returnEvent {
+	eventImgURL := config.GetString("google.calendar.image.default")
+	if len(event.Attachments) > 0 {
+		for _, attachment := range event.Attachments {
+			if attachment.Mime[:5] == "image" {
+				if strings.Contains(attachment.Value, "drive.google.com/file/d/") {
+					id := strings.Split(attachment.Value, "/d/")[1]
+					id = strings.Split(id, "/view")[0]
+					eventImgURL = "https://drive.google.com/uc?export=download&id=" + id
+				} else if strings.Contains(attachment.Value, "drive.google.com/open?id=") {
+					id := strings.Split(attachment.Value, "open?id=")[1]
+					eventImgURL = "https://drive.google.com/uc?export=download&id=" + id
+				}
+			}
+		}
+	}
+	return returnEvent{
+		ID:          eventID(event),
+		Title:       event.Summary,
+		Description: strings.ReplaceAll(event.Description, `\n`, "\n"),
+		ImageURL:    eventImgURL,
+		StartDate:   event.Start,
+		EndDate:     event.End,
+		Duration:    int64(EventDuration(event).Seconds()),
+		AllDay:      IsAllDay(event),
+	}
+}
+
+// eventID stays the same when an event is rescheduled, so moves are published as updates.
+// Occurrences of recurring events share a UID, they're told apart by the start they were originally
+// scheduled for, which an occurrence moved on its own keeps as its RECURRENCE-ID.
+func eventID(event gocal.Event) string {
+	if event.RecurrenceID != "" {
+		if original, err := recurrenceStart(event.RecurrenceID); err == nil {
+			return fmt.Sprintf("%s-%d", event.Uid, original.Unix())
+		}
+	}
+	if event.IsRecurring {
+		return fmt.Sprintf("%s-%d", event.Uid, event.Start.Unix())
+	}
+	return event.Uid
+}
+
+// recurrenceStart parses a RECURRENCE-ID rewritten by normaliseICS, either in UTC or an all-day date
+func recurrenceStart(value string) (time.Time, error) {
+	if len(value) == len("20060102") {
+		return time.ParseInLocation("20060102", value, CalendarLocation())
+	}
+	return time.Parse(icsDateTimeUTC, value)
+}
+
+// QueryCalendarEvents returns the events in the next 30 days of an ICS calendar,
+// with recurring events expanded and all times in the calendar timezone.
 func QueryCalendarEvents(url string) ([]gocal.Event, error) {
 	resp, err := http.Get(url)
 	if err != nil {
@@ -97,15 +132,15 @@ func QueryCalendarEvents(url string) ([]gocal.Event, error) {
 
 	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	loc := CalendarLocation()
+	r, err := normaliseICS(resp.Body, loc)
 	if err != nil {
 		log.WithError(err)
 		return nil, err
 	}
 
-	r := bytes.NewBuffer(body)
-
-	start, end := time.Now(), time.Now().Add(30*24*time.Hour)
+	start := time.Now().In(loc)
+	end := start.Add(calendarLookahead)
 
 	c := gocal.NewParser(r)
 	c.Start, c.End = &start, &end
@@ -115,7 +150,13 @@ func QueryCalendarEvents(url string) ([]gocal.Event, error) {
 	}
 
 	calEvents := c.Events
+	for i := range calEvents {
+		localiseEvent(&calEvents[i], loc)
+	}
 	sort.SliceStable(calEvents, func(i, j int) bool {
+		if calEvents[i].Start.Equal(*calEvents[j].Start) {
+			return calEvents[i].Summary < calEvents[j].Summary
+		}
 		return calEvents[i].Start.Before(*calEvents[j].Start)
 	})
 
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Gateway handlers keeping the announcements list current without polling
+
+func isAnnouncementsChannel(channelID string) bool {
+	return channelID == config.Get().Channels().PublicAnnouncements
+}
+
+func announcementCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if !isAnnouncementsChannel(m.ChannelID) {
+		return
+	}
+	if announcement, ok := newAnnouncement(m.Message); ok {
+		log.WithFields(log.Fields{"id": announcement.ID}).Info("New announcement")
+		saveAnnouncement(announcement)
+		publish(announcementCreated, newReturnAnnouncement(announcement))
+	}
+}
+
+func announcementUpdate(s *discordgo.Session, m *discordgo.MessageUpdate) {
+	if !isAnnouncementsChannel(m.ChannelID) {
+		return
+	}
+	refreshAnnouncement(m.ChannelID, m.ID)
+}
+
+func announcementDelete(s *discordgo.Session, m *discordgo.MessageDelete) {
+	if !isAnnouncementsChannel(m.ChannelID) {
+		return
+	}
+	if deleted, ok := deleteAnnouncement(m.ID); ok {
+		publish(announcementDeleted, newReturnAnnouncement(deleted))
+	}
+}
+
+func announcementReactionAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	if isAnnouncementsChannel(r.ChannelID) {
+		refreshAnnouncement(r.ChannelID, r.MessageID)
+	}
+}
+
+func announcementReactionRemove(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
+	if isAnnouncementsChannel(r.ChannelID) {
+		refreshAnnouncement(r.ChannelID, r.MessageID)
+	}
+}
+
+// refreshAnnouncement refetches a message, update events can be partial
+func refreshAnnouncement(channelID, messageID string) {
+	message, err := session.ChannelMessage(channelID, messageID)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"id": messageID}).Error("Failed to refresh announcement")
+		return
+	}
+	announcementsLock.RLock()
+	previous, existed := announcementsByID[messageID]
+	announcementsLock.RUnlock()
+	if announcement, ok := newAnnouncement(message); ok {
+		saveAnnouncement(announcement)
+		if existed {
+			publish(announcementUpdated, newReturnAnnouncement(announcement))
+		} else {
+			publish(announcementCreated, newReturnAnnouncement(announcement))
+		}
+	} else if existed {
+		// Edited so it no longer pings everyone
+		removeAnnouncement(messageID)
+		gone := *previous
+		gone.Deleted = true
+		publish(announcementDeleted, newReturnAnnouncement(&gone))
+	}
+}
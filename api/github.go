@@ -0,0 +1,365 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/UCCNetsoc/discord-bot/embed"
+	"github.com/bwmarrin/discordgo"
+)
+
+// GitHub caps webhook payloads at 25MB
+const maxGitHubPayload = 25 << 20
+
+// Embed colours for GitHub events
+const (
+	githubPushColour     = 0x24292f
+	githubOpenedColour   = 0x2da44e
+	githubMergedColour   = 0x8250df
+	githubClosedColour   = 0xcf222e
+	githubReleaseColour  = 0x0969da
+	githubWorkflowColour = 0xcf222e
+)
+
+type githubUser struct {
+	Login     string `json:"login"`
+	AvatarURL string `json:"avatar_url"`
+	HTMLURL   string `json:"html_url"`
+}
+
+type githubRepository struct {
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	HTMLURL  string `json:"html_url"`
+	Owner    struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+type githubEvent struct {
+	Action       string           `json:"action"`
+	Repository   githubRepository `json:"repository"`
+	Organization *struct {
+		Login string `json:"login"`
+	} `json:"organization"`
+	Sender githubUser `json:"sender"`
+
+	// push
+	Ref     string `json:"ref"`
+	Compare string `json:"compare"`
+	Deleted bool   `json:"deleted"`
+	Commits []struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+		URL     string `json:"url"`
+		Author  struct {
+			Name     string `json:"name"`
+			Username string `json:"username"`
+		} `json:"author"`
+	} `json:"commits"`
+
+	// pull_request
+	PullRequest *struct {
+		Number  int        `json:"number"`
+		Title   string     `json:"title"`
+		Body    string     `json:"body"`
+		HTMLURL string     `json:"html_url"`
+		Merged  bool       `json:"merged"`
+		Draft   bool       `json:"draft"`
+		User    githubUser `json:"user"`
+		Base    struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+		Head struct {
+			Ref string `json:"ref"`
+		} `json:"head"`
+	} `json:"pull_request"`
+
+	// release
+	Release *struct {
+		TagName    string `json:"tag_name"`
+		Name       string `json:"name"`
+		Body       string `json:"body"`
+		HTMLURL    string `json:"html_url"`
+		Prerelease bool   `json:"prerelease"`
+	} `json:"release"`
+
+	// workflow_run
+	WorkflowRun *struct {
+		Name       string `json:"name"`
+		HTMLURL    string `json:"html_url"`
+		HeadBranch string `json:"head_branch"`
+		HeadSHA    string `json:"head_sha"`
+		Event      string `json:"event"`
+		Status     string `json:"status"`
+		Conclusion string `json:"conclusion"`
+		RunNumber  int    `json:"run_number"`
+	} `json:"workflow_run"`
+}
+
+// postGitHub receives organisation webhooks and posts the interesting events to their routed channels
+func postGitHub(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxGitHubPayload))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if !verifyGitHubSignature(body, r.Header.Get("X-Hub-Signature-256")) {
+		log.WithContext(r.Context()).WithFields(log.Fields{"delivery": r.Header.Get("X-GitHub-Delivery")}).Error("Invalid GitHub webhook signature")
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	kind := r.Header.Get("X-GitHub-Event")
+	if kind == "ping" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	event := &githubEvent{}
+	if err = json.Unmarshal(body, event); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if !githubOrganisationAllowed(event) {
+		http.Error(w, "Organisation not allowed", http.StatusForbidden)
+		return
+	}
+
+	emb := githubEmbed(kind, event)
+	channels := githubChannels(event.Repository.Name, kind)
+	if emb == nil || len(channels) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	// GitHub times out deliveries after 10 seconds, so Discord is posted to in the background
+	go func() {
+		for _, channelID := range channels {
+			if _, err := session.ChannelMessageSendEmbed(channelID, emb); err != nil {
+				log.WithError(err).WithFields(log.Fields{"channel": channelID, "event": kind, "repo": event.Repository.FullName}).Error("Failed to post GitHub event")
+			}
+		}
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// verifyGitHubSignature checks the sha256=<hex HMAC> header against github.secret
+func verifyGitHubSignature(body []byte, header string) bool {
+	secret := config.GetString("github.secret")
+	signature, ok := strings.CutPrefix(header, "sha256=")
+	if secret == "" || !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func githubOrganisationAllowed(event *githubEvent) bool {
+	organisation := config.GetString("github.organisation")
+	if organisation == "" {
+		return true
+	}
+	if event.Organization != nil {
+		return strings.EqualFold(event.Organization.Login, organisation)
+	}
+	return strings.EqualFold(event.Repository.Owner.Login, organisation)
+}
+
+// githubChannels routes an event using github.routes, a comma separated list of repo/event=channel rules.
+// Either side may be *, the most specific matching rules win and github.channel is used when none match.
+func githubChannels(repo, kind string) []string {
+	best := -1
+	channels := []string{}
+	for _, rule := range strings.Split(config.GetString("github.routes"), ",") {
+		rule = strings.TrimSpace(rule)
+		match, channelID, ok := strings.Cut(rule, "=")
+		if !ok {
+			continue
+		}
+		ruleRepo, ruleKind, ok := strings.Cut(strings.TrimSpace(match), "/")
+		if !ok {
+			ruleKind = "*"
+		}
+		specificity := 0
+		if ruleRepo != "*" {
+			if !strings.EqualFold(ruleRepo, repo) {
+				continue
+			}
+			specificity += 2
+		}
+		if ruleKind != "*" {
+			if ruleKind != kind {
+				continue
+			}
+			specificity++
+		}
+		switch {
+		case specificity > best:
+			best = specificity
+			channels = []string{}
+		case specificity < best:
+			continue
+		}
+		// A rule without a channel mutes the matching events
+		if channelID = strings.TrimSpace(channelID); channelID != "" {
+			channels = append(channels, channelID)
+		}
+	}
+	if best == -1 && config.GetString("github.channel") != "" {
+		channels = append(channels, config.GetString("github.channel"))
+	}
+	return channels
+}
+
+// githubEmbed formats the supported events, returning nil for anything which shouldn't be posted
+func githubEmbed(kind string, event *githubEvent) *discordgo.MessageEmbed {
+	var emb *embed.Embed
+	switch kind {
+	case "push":
+		emb = githubPushEmbed(event)
+	case "pull_request":
+		emb = githubPullRequestEmbed(event)
+	case "release":
+		emb = githubReleaseEmbed(event)
+	case "workflow_run":
+		emb = githubWorkflowEmbed(event)
+	}
+	if emb == nil {
+		return nil
+	}
+	if event.Sender.Login != "" {
+		emb.SetAuthor(event.Sender.Login, event.Sender.AvatarURL, event.Sender.HTMLURL)
+	}
+	emb.TruncateTitle()
+	return emb.MessageEmbed
+}
+
+func githubPushEmbed(event *githubEvent) *embed.Embed {
+	branch, ok := strings.CutPrefix(event.Ref, "refs/heads/")
+	if !ok || event.Deleted || len(event.Commits) == 0 {
+		return nil
+	}
+	plural := "commits"
+	if len(event.Commits) == 1 {
+		plural = "commit"
+	}
+	lines := []string{}
+	for idx, commit := range event.Commits {
+		if idx == 10 {
+			lines = append(lines, fmt.Sprintf("…and %d more", len(event.Commits)-idx))
+			break
+		}
+		summary, _, _ := strings.Cut(commit.Message, "\n")
+		if runes := []rune(summary); len(runes) > 72 {
+			summary = string(runes[:72]) + "…"
+		}
+		author := commit.Author.Username
+		if author == "" {
+			author = commit.Author.Name
+		}
+		lines = append(lines, fmt.Sprintf("[`%s`](%s) %s - %s", commit.ID[:min(7, len(commit.ID))], commit.URL, summary, author))
+	}
+	emb := embed.NewEmbed().
+		SetTitle(fmt.Sprintf("[%s:%s] %d new %s", event.Repository.Name, branch, len(event.Commits), plural)).
+		SetDescription(strings.Join(lines, "\n")).
+		SetColor(githubPushColour)
+	emb.URL = event.Compare
+	return emb
+}
+
+func githubPullRequestEmbed(event *githubEvent) *embed.Embed {
+	pr := event.PullRequest
+	if pr == nil {
+		return nil
+	}
+	var action string
+	colour := githubOpenedColour
+	switch {
+	case event.Action == "opened" && !pr.Draft, event.Action == "ready_for_review":
+		action = "opened"
+	case event.Action == "reopened":
+		action = "reopened"
+	case event.Action == "closed" && pr.Merged:
+		action, colour = "merged", githubMergedColour
+	case event.Action == "closed":
+		action, colour = "closed", githubClosedColour
+	default:
+		return nil
+	}
+	emb := embed.NewEmbed().
+		SetTitle(fmt.Sprintf("[%s] Pull request %s: #%d %s", event.Repository.Name, action, pr.Number, pr.Title)).
+		SetColor(colour)
+	if action == "opened" {
+		emb.SetDescription(githubBody(pr.Body)).
+			AddField("Branch", fmt.Sprintf("`%s` → `%s`", pr.Head.Ref, pr.Base.Ref))
+	}
+	emb.URL = pr.HTMLURL
+	return emb
+}
+
+func githubReleaseEmbed(event *githubEvent) *embed.Embed {
+	release := event.Release
+	if release == nil || event.Action != "published" {
+		return nil
+	}
+	name := release.Name
+	if name == "" {
+		name = release.TagName
+	}
+	kind := "release"
+	if release.Prerelease {
+		kind = "pre-release"
+	}
+	emb := embed.NewEmbed().
+		SetTitle(fmt.Sprintf("[%s] New %s: %s", event.Repository.Name, kind, name)).
+		SetDescription(githubBody(release.Body)).
+		SetColor(githubReleaseColour)
+	emb.URL = release.HTMLURL
+	return emb
+}
+
+// Only failures are posted, successful runs would drown out everything else
+func githubWorkflowEmbed(event *githubEvent) *embed.Embed {
+	run := event.WorkflowRun
+	if run == nil || event.Action != "completed" {
+		return nil
+	}
+	switch run.Conclusion {
+	case "failure", "timed_out", "startup_failure":
+	default:
+		return nil
+	}
+	emb := embed.NewEmbed().
+		SetTitle(fmt.Sprintf("[%s] %s #%d failed on %s", event.Repository.Name, run.Name, run.RunNumber, run.HeadBranch)).
+		SetColor(githubWorkflowColour).
+		AddField("Conclusion", strings.ReplaceAll(run.Conclusion, "_", " ")).
+		AddField("Commit", fmt.Sprintf("`%s`", run.HeadSHA[:min(7, len(run.HeadSHA))])).
+		AddField("Triggered by", run.Event)
+	emb.URL = run.HTMLURL
+	return emb
+}
+
+// githubBody shortens a markdown description for an embed
+func githubBody(body string) string {
+	body = strings.TrimSpace(strings.ReplaceAll(body, "\r\n", "\n"))
+	if runes := []rune(body); len(runes) > 500 {
+		body = strings.TrimSpace(string(runes[:500])) + "…"
+	}
+	return body
+}
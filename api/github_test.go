@@ -0,0 +1,237 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func githubSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// githubPayload reads a recorded delivery from testdata/github
+func githubPayload(t *testing.T, kind string) []byte {
+	t.Helper()
+	body, err := os.ReadFile("testdata/github/" + kind + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestVerifyGitHubSignature(t *testing.T) {
+	useTestConfig(t)
+	body := []byte(`{"zen": "Keep it logically awesome."}`)
+	valid := githubSignature("hunter2", body)
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		want   bool
+	}{
+		{"valid", "hunter2", valid, true},
+		{"wrong secret", "hunter2", githubSignature("hunter3", body), false},
+		{"other body", "hunter2", githubSignature("hunter2", []byte("{}")), false},
+		{"truncated", "hunter2", valid[:len(valid)-2], false},
+		{"not hex", "hunter2", "sha256=" + strings.Repeat("zz", 32), false},
+		{"missing prefix", "hunter2", strings.TrimPrefix(valid, "sha256="), false},
+		{"sha1", "hunter2", "sha1=" + strings.TrimPrefix(valid, "sha256="), false},
+		{"missing", "hunter2", "", false},
+		// An unset secret rejects everything, even deliveries signed with an empty key
+		{"empty secret", "", githubSignature("", body), false},
+	}
+	for _, test := range tests {
+		setConfig(t, "github.secret", test.secret)
+		if got := verifyGitHubSignature(body, test.header); got != test.want {
+			t.Errorf("%s: verified %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGitHubChannels(t *testing.T) {
+	useTestConfig(t)
+	routes := "* = all, */push = pushes, discord-bot = bot, discord-bot/push = bot-pushes, Discord-Bot/release = releases-a, discord-bot/release = releases-b, website/push =, wiki/*="
+
+	tests := []struct {
+		routes   string
+		fallback string
+		repo     string
+		kind     string
+		want     string
+	}{
+		{routes, "", "discord-bot", "push", "bot-pushes"},
+		{routes, "", "discord-bot", "pull_request", "bot"},
+		{routes, "", "infra", "push", "pushes"},
+		{routes, "", "infra", "release", "all"},
+		// Every rule at the most specific level matches, repositories ignore case
+		{routes, "", "discord-bot", "release", "releases-a,releases-b"},
+		// An empty channel mutes the events, rather than falling back to a less specific rule
+		{routes, "", "website", "push", ""},
+		{routes, "", "website", "release", "all"},
+		{routes, "", "wiki", "push", ""},
+		// github.channel is only used when nothing matches, including muting rules
+		{"discord-bot/push = bot-pushes", "general", "discord-bot", "release", "general"},
+		{"discord-bot/push = bot-pushes", "general", "discord-bot", "push", "bot-pushes"},
+		{"discord-bot/push =", "general", "discord-bot", "push", ""},
+		{"", "general", "discord-bot", "push", "general"},
+		{"", "", "discord-bot", "push", ""},
+		// Malformed rules are skipped
+		{"discord-bot/push, */release = releases", "general", "discord-bot", "push", "general"},
+	}
+	for _, test := range tests {
+		setConfig(t, "github.routes", test.routes)
+		setConfig(t, "github.channel", test.fallback)
+		if got := strings.Join(githubChannels(test.repo, test.kind), ","); got != test.want {
+			t.Errorf("%s %s with %q: routed to %q, want %q", test.repo, test.kind, test.routes, got, test.want)
+		}
+	}
+}
+
+func TestGitHubEmbed(t *testing.T) {
+	tests := []struct {
+		kind        string
+		title       string
+		url         string
+		colour      int
+		author      string
+		description string
+		fields      string
+	}{
+		{
+			"push", "[discord-bot:master] 2 new commits",
+			"https://github.com/UCCNetsoc/discord-bot/compare/6113728f27ae...0d1a26e67d8f", githubPushColour, "adalovelace",
+			// Only the first line of messages, shortened, crediting usernames over names
+			"[`b1a2c3d`](https://github.com/UCCNetsoc/discord-bot/commit/b1a2c3d4e5f60718293a4b5c6d7e8f9012345678) Add /online command - adalovelace\n" +
+				"[`0d1a26e`](https://github.com/UCCNetsoc/discord-bot/commit/0d1a26e67d8f5eaf1f6ba5c57fc3c7d91ac0fd1c) " +
+				"Fix the player list being cut off when more than ten players are online … - Grace Hopper",
+			"",
+		},
+		{
+			"pull_request", "[discord-bot] Pull request opened: #87 Post GitHub events to Discord",
+			"https://github.com/UCCNetsoc/discord-bot/pull/87", githubOpenedColour, "gracehopper",
+			"Adds a `/github` webhook endpoint.\n\n- Pushes, pull requests and releases are posted\n- Failed workflow runs are posted",
+			"Branch: `github-webhooks` → `master`",
+		},
+		{
+			// Releases without a name use their tag
+			"release", "[discord-bot] New release: v2.3.0",
+			"https://github.com/UCCNetsoc/discord-bot/releases/tag/v2.3.0", githubReleaseColour, "adalovelace",
+			"## What's Changed\n* Post GitHub events to Discord by @gracehopper in https://github.com/UCCNetsoc/discord-bot/pull/87",
+			"",
+		},
+		{
+			"workflow_run", "[discord-bot] Build and deploy #142 failed on master",
+			"https://github.com/UCCNetsoc/discord-bot/actions/runs/1318272345", githubWorkflowColour, "adalovelace",
+			"",
+			"Conclusion: timed out, Commit: `0d1a26e`, Triggered by: push",
+		},
+	}
+	for _, test := range tests {
+		event := &githubEvent{}
+		if err := json.Unmarshal(githubPayload(t, test.kind), event); err != nil {
+			t.Fatalf("%s: %v", test.kind, err)
+		}
+		emb := githubEmbed(test.kind, event)
+		if emb == nil {
+			t.Errorf("%s: not posted", test.kind)
+			continue
+		}
+		fields := []string{}
+		for _, field := range emb.Fields {
+			fields = append(fields, field.Name+": "+field.Value)
+		}
+		if emb.Title != test.title || emb.URL != test.url || emb.Color != test.colour || emb.Description != test.description || strings.Join(fields, ", ") != test.fields {
+			t.Errorf("%s: got %q %s %x\n%q\n%v", test.kind, emb.Title, emb.URL, emb.Color, emb.Description, fields)
+		}
+		if emb.Author == nil || emb.Author.Name != test.author || !strings.HasPrefix(emb.Author.IconURL, "https://avatars.githubusercontent.com/") {
+			t.Errorf("%s: author %+v", test.kind, emb.Author)
+		}
+	}
+}
+
+func TestGitHubEmbedActions(t *testing.T) {
+	// Each edit is applied to a recorded payload, want is part of the title or empty when nothing should be posted
+	tests := []struct {
+		payload string
+		kind    string
+		edit    func(event *githubEvent)
+		want    string
+	}{
+		{"push", "push", func(e *githubEvent) { e.Ref = "refs/tags/v2.3.0" }, ""},
+		{"push", "push", func(e *githubEvent) { e.Deleted, e.Commits = true, nil }, ""},
+		{"pull_request", "pull_request", func(e *githubEvent) { e.Action = "synchronize" }, ""},
+		{"pull_request", "pull_request", func(e *githubEvent) { e.PullRequest.Draft = true }, ""},
+		{"pull_request", "pull_request", func(e *githubEvent) { e.Action, e.PullRequest.Draft = "ready_for_review", true }, "Pull request opened"},
+		{"pull_request", "pull_request", func(e *githubEvent) { e.Action, e.PullRequest.Merged = "closed", true }, "Pull request merged"},
+		{"pull_request", "pull_request", func(e *githubEvent) { e.Action = "closed" }, "Pull request closed"},
+		{"release", "release", func(e *githubEvent) { e.Action = "created" }, ""},
+		{"release", "release", func(e *githubEvent) { e.Release.Name, e.Release.Prerelease = "Beta", true }, "New pre-release: Beta"},
+		{"workflow_run", "workflow_run", func(e *githubEvent) { e.WorkflowRun.Conclusion = "success" }, ""},
+		{"workflow_run", "workflow_run", func(e *githubEvent) { e.Action = "requested" }, ""},
+		{"push", "issues", func(e *githubEvent) {}, ""},
+	}
+	for _, test := range tests {
+		event := &githubEvent{}
+		if err := json.Unmarshal(githubPayload(t, test.payload), event); err != nil {
+			t.Fatal(err)
+		}
+		test.edit(event)
+		emb := githubEmbed(test.kind, event)
+		switch {
+		case test.want == "" && emb != nil:
+			t.Errorf("%s: posted %q", test.kind, emb.Title)
+		case test.want != "" && (emb == nil || !strings.Contains(emb.Title, test.want)):
+			t.Errorf("%s: got %+v, want %s", test.kind, emb, test.want)
+		}
+	}
+}
+
+func TestPostGitHub(t *testing.T) {
+	useTestConfig(t)
+	setConfig(t, "github.secret", "hunter2")
+	setConfig(t, "github.routes", "discord-bot/push =")
+	push := githubPayload(t, "push")
+	other := bytes.ReplaceAll(push, []byte(`"login": "UCCNetsoc"`), []byte(`"login": "SomeoneElse"`))
+
+	tests := []struct {
+		name      string
+		method    string
+		kind      string
+		body      []byte
+		signature string
+		status    int
+	}{
+		{"get", http.MethodGet, "push", push, githubSignature("hunter2", push), http.StatusMethodNotAllowed},
+		{"unsigned", http.MethodPost, "push", push, "", http.StatusUnauthorized},
+		{"forged", http.MethodPost, "push", push, githubSignature("hunter3", push), http.StatusUnauthorized},
+		{"ping", http.MethodPost, "ping", []byte(`{"zen": "Design for failure."}`), githubSignature("hunter2", []byte(`{"zen": "Design for failure."}`)), http.StatusNoContent},
+		{"invalid JSON", http.MethodPost, "push", []byte("{"), githubSignature("hunter2", []byte("{")), http.StatusBadRequest},
+		// Muted by the route, so nothing is posted
+		{"muted", http.MethodPost, "push", push, githubSignature("hunter2", push), http.StatusNoContent},
+		{"other organisation", http.MethodPost, "push", other, githubSignature("hunter2", other), http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "/github", bytes.NewReader(test.body))
+		req.Header.Set("X-GitHub-Event", test.kind)
+		if test.signature != "" {
+			req.Header.Set("X-Hub-Signature-256", test.signature)
+		}
+		w := httptest.NewRecorder()
+		postGitHub(w, req)
+		if w.Code != test.status {
+			t.Errorf("%s: responded %d, want %d", test.name, w.Code, test.status)
+		}
+	}
+}
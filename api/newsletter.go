@@ -0,0 +1,41 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/emails"
+)
+
+// unsubscribeNewsletter handles the per-recipient links in newsletters.
+// GET only asks for confirmation, as mail scanners follow links without the recipient.
+// POST unsubscribes, from the confirmation form or mail clients supporting one-click List-Unsubscribe.
+func unsubscribeNewsletter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	token := r.URL.Query().Get("token")
+	email, ok := emails.VerifyUnsubscribeToken(token)
+	if !ok {
+		http.Error(w, "Invalid unsubscribe link", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	if r.Method == http.MethodGet {
+		fmt.Fprintf(w,
+			`<form method="post" action="?token=%s"><p>Unsubscribe %s from the UCC Netsoc newsletter?</p><button type="submit">Unsubscribe</button></form>`,
+			html.EscapeString(url.QueryEscape(token)), html.EscapeString(email),
+		)
+		return
+	}
+	if err := emails.Unsubscribe(email); err != nil {
+		log.WithError(err).Error("Failed to unsubscribe from newsletter")
+		http.Error(w, "Failed to unsubscribe, please try again later", http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "<p>%s has been unsubscribed from the UCC Netsoc newsletter.</p>", html.EscapeString(email))
+}
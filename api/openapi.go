@@ -0,0 +1,162 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/UCCNetsoc/discord-bot/config"
+)
+
+type apiParam struct {
+	Name        string
+	Description string
+	Type        string
+	Format      string
+}
+
+type apiRoute struct {
+	Path        string
+	Summary     string
+	Params      []apiParam
+	Response    interface{}
+	List        bool
+	Description string
+	ContentType string
+}
+
+var (
+	pageQueryParams = []apiParam{
+		{Name: "limit", Description: "Maximum number of items to return, capped at the configured query limit", Type: "integer"},
+		{Name: "offset", Description: "Number of items to skip, cannot be combined with cursor", Type: "integer"},
+		{Name: "cursor", Description: "Opaque cursor from a previous response's pagination.next_cursor", Type: "string"},
+		{Name: "since", Description: "Only include items at or after this time (RFC3339 or unix seconds)", Type: "string", Format: "date-time"},
+		{Name: "until", Description: "Only include items before this time (RFC3339 or unix seconds)", Type: "string", Format: "date-time"},
+	}
+
+	v1Routes = []apiRoute{
+		{Path: "/v1/events", Summary: "Upcoming public events", Params: pageQueryParams, Response: returnEvent{}, List: true,
+			Description: "Events from the public calendar for the next 30 days, soonest first"},
+		{Path: "/v1/announcements", Summary: "Public announcements", Response: returnAnnouncement{}, List: true,
+			Params: append([]apiParam{
+				{Name: "include_deleted", Description: "Include announcements that have since been deleted", Type: "boolean"},
+			}, pageQueryParams...),
+			Description: "Announcements from the public announcements channel, newest first"},
+		{Path: "/v1/members", Summary: "Public server member count", Response: returnMembers{}},
+		{Path: "/v1/stream", Summary: "Live notifications", ContentType: "text/event-stream", Response: notification{},
+			Description: "Server-Sent Events stream. Event names are announcement.created, announcement.updated, announcement.deleted, " +
+				"event.created, event.updated and event.deleted, the data is the announcement or event as JSON"},
+		{Path: "/v1/openapi.json", Summary: "This document", Response: map[string]interface{}{}},
+	}
+)
+
+// openAPIDocument generates an OpenAPI 3 document from v1Routes and the response types
+func openAPIDocument() map[string]interface{} {
+	paths := map[string]interface{}{}
+	for _, route := range v1Routes {
+		schema := schemaOf(reflect.TypeOf(route.Response))
+		if route.List {
+			schema = map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"data":       map[string]interface{}{"type": "array", "items": schema},
+					"pagination": schemaOf(reflect.TypeOf(pagination{})),
+				},
+			}
+		}
+		contentType := route.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		params := []interface{}{}
+		for _, param := range route.Params {
+			paramSchema := map[string]interface{}{"type": param.Type}
+			if param.Format != "" {
+				paramSchema["format"] = param.Format
+			}
+			params = append(params, map[string]interface{}{
+				"name":        param.Name,
+				"in":          "query",
+				"description": param.Description,
+				"schema":      paramSchema,
+			})
+		}
+		operation := map[string]interface{}{
+			"summary":    route.Summary,
+			"parameters": params,
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "OK",
+					"content":     map[string]interface{}{contentType: map[string]interface{}{"schema": schema}},
+				},
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content": map[string]interface{}{"application/json": map[string]interface{}{
+						"schema": schemaOf(reflect.TypeOf(errorBody{})),
+					}},
+				},
+			},
+		}
+		if route.Description != "" {
+			operation["description"] = route.Description
+		}
+		paths[route.Path] = map[string]interface{}{"get": operation}
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Netsoc Discord Bot API",
+			"version": config.GetString("bot.version"),
+		},
+		"paths": paths,
+	}
+}
+
+// schemaOf builds a JSON schema for a type using its json tags
+func schemaOf(t reflect.Type) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object"}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Name
+			if tag, ok := field.Tag.Lookup("json"); ok {
+				tagName := strings.Split(tag, ",")[0]
+				if tagName == "-" {
+					continue
+				}
+				if tagName != "" {
+					name = tagName
+				}
+			}
+			properties[name] = schemaOf(field.Type)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	}
+	return map[string]interface{}{}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	useTestConfig(t)
+	w := httptest.NewRecorder()
+	v1Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("served with %d", w.Code)
+	}
+
+	document := struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title string `json:"title"`
+		} `json:"info"`
+		Paths map[string]struct {
+			Get *struct {
+				Summary    string `json:"summary"`
+				Parameters []struct {
+					Name string `json:"name"`
+					In   string `json:"in"`
+				} `json:"parameters"`
+				Responses map[string]struct {
+					Content map[string]struct {
+						Schema struct {
+							Type       string                     `json:"type"`
+							Properties map[string]json.RawMessage `json:"properties"`
+						} `json:"schema"`
+					} `json:"content"`
+				} `json:"responses"`
+			} `json:"get"`
+		} `json:"paths"`
+	}{}
+	if err := json.NewDecoder(w.Body).Decode(&document); err != nil {
+		t.Fatal(err)
+	}
+	if document.OpenAPI != "3.0.3" || document.Info.Title == "" {
+		t.Errorf("document is OpenAPI %q titled %q", document.OpenAPI, document.Info.Title)
+	}
+
+	// Every route served is documented, and nothing else
+	if len(document.Paths) != len(v1Handlers) {
+		t.Errorf("documents %d paths, %d are served", len(document.Paths), len(v1Handlers))
+	}
+	for path := range v1Handlers {
+		item, ok := document.Paths[path]
+		if !ok || item.Get == nil || item.Get.Summary == "" {
+			t.Errorf("%s isn't documented", path)
+			continue
+		}
+		if _, ok = item.Get.Responses["200"]; !ok {
+			t.Errorf("%s has no OK response", path)
+		}
+		if _, ok = item.Get.Responses["default"].Content["application/json"]; !ok {
+			t.Errorf("%s has no error response", path)
+		}
+	}
+
+	// Lists document their pagination
+	for _, route := range v1Routes {
+		if !route.List {
+			continue
+		}
+		operation := document.Paths[route.Path].Get
+		params := map[string]bool{}
+		for _, param := range operation.Parameters {
+			params[param.Name] = param.In == "query"
+		}
+		for _, name := range []string{"limit", "offset", "cursor", "since", "until"} {
+			if !params[name] {
+				t.Errorf("%s doesn't document the %s query parameter", route.Path, name)
+			}
+		}
+		schema := operation.Responses["200"].Content["application/json"].Schema
+		if schema.Properties["data"] == nil || schema.Properties["pagination"] == nil {
+			t.Errorf("%s isn't documented as a list", route.Path)
+		}
+	}
+}
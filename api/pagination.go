@@ -0,0 +1,168 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// cursorKey is the position of an item in a listing, encoded into an opaque cursor
+type cursorKey struct {
+	Time int64  `json:"t"`
+	ID   string `json:"id"`
+}
+
+func (c cursorKey) less(o cursorKey) bool {
+	if c.Time != o.Time {
+		return c.Time < o.Time
+	}
+	return c.ID < o.ID
+}
+
+func (c cursorKey) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(cursor string) (*cursorKey, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	key := &cursorKey{}
+	if err = json.Unmarshal(b, key); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return key, nil
+}
+
+// pageParams are the query parameters shared by every list endpoint
+type pageParams struct {
+	Limit  int
+	Offset int
+	Cursor *cursorKey
+	Since  *time.Time
+	Until  *time.Time
+}
+
+type pagination struct {
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type listResponse struct {
+	Data       interface{} `json:"data"`
+	Pagination pagination  `json:"pagination"`
+}
+
+// parsePageParams reads limit, offset, cursor, since and until.
+// limit defaults to and is capped at maxLimit.
+func parsePageParams(query url.Values, maxLimit int) (*pageParams, error) {
+	params := &pageParams{Limit: maxLimit}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return nil, errors.New("'limit' must be a positive integer")
+		}
+		if limit < maxLimit {
+			params.Limit = limit
+		}
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return nil, errors.New("'offset' must be a non-negative integer")
+		}
+		params.Offset = offset
+	}
+	if v := query.Get("cursor"); v != "" {
+		if params.Offset != 0 {
+			return nil, errors.New("'cursor' and 'offset' cannot be used together")
+		}
+		cursor, err := decodeCursor(v)
+		if err != nil {
+			return nil, err
+		}
+		params.Cursor = cursor
+	}
+	var err error
+	if params.Since, err = parseTimeParam(query, "since"); err != nil {
+		return nil, err
+	}
+	if params.Until, err = parseTimeParam(query, "until"); err != nil {
+		return nil, err
+	}
+	if params.Since != nil && params.Until != nil && params.Until.Before(*params.Since) {
+		return nil, errors.New("'until' must not be before 'since'")
+	}
+	return params, nil
+}
+
+// parseTimeParam accepts RFC3339 or unix seconds
+func parseTimeParam(query url.Values, name string) (*time.Time, error) {
+	v := query.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	if unix, err := strconv.ParseInt(v, 10, 64); err == nil {
+		t := time.Unix(unix, 0)
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' must be an RFC3339 timestamp or unix seconds", name)
+	}
+	return &t, nil
+}
+
+// paginate filters items to the since/until window, orders them by key and returns the requested page.
+// Items are ordered oldest first unless descending is set.
+func paginate[T any](items []T, key func(T) cursorKey, descending bool, params *pageParams) ([]T, pagination) {
+	filtered := []T{}
+	for _, item := range items {
+		t := time.Unix(0, key(item).Time)
+		if params.Since != nil && t.Before(*params.Since) {
+			continue
+		}
+		if params.Until != nil && !t.Before(*params.Until) {
+			continue
+		}
+		filtered = append(filtered, item)
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		if descending {
+			return key(filtered[j]).less(key(filtered[i]))
+		}
+		return key(filtered[i]).less(key(filtered[j]))
+	})
+
+	start := params.Offset
+	if params.Cursor != nil {
+		start = sort.Search(len(filtered), func(i int) bool {
+			if descending {
+				return key(filtered[i]).less(*params.Cursor)
+			}
+			return params.Cursor.less(key(filtered[i]))
+		})
+	}
+	if start > len(filtered) {
+		start = len(filtered)
+	}
+	end := start + params.Limit
+	if end > len(filtered) {
+		end = len(filtered)
+	}
+
+	info := pagination{Limit: params.Limit, Offset: start, Total: len(filtered)}
+	if end < len(filtered) && end > start {
+		info.NextCursor = key(filtered[end-1]).encode()
+	}
+	return filtered[start:end], info
+}
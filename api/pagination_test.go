@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePageParams(t *testing.T) {
+	since := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+	cursor := cursorKey{Time: since.UnixNano(), ID: "42"}
+
+	tests := []struct {
+		query  string
+		want   pageParams
+		errMsg string
+	}{
+		{"", pageParams{Limit: 50}, ""},
+		{"limit=10&offset=20", pageParams{Limit: 10, Offset: 20}, ""},
+		// Capped rather than rejected
+		{"limit=500", pageParams{Limit: 50}, ""},
+		{"limit=0", pageParams{}, "'limit' must be a positive integer"},
+		{"limit=ten", pageParams{}, "'limit' must be a positive integer"},
+		{"offset=-1", pageParams{}, "'offset' must be a non-negative integer"},
+		{"cursor=" + cursor.encode(), pageParams{Limit: 50, Cursor: &cursor}, ""},
+		{"cursor=" + cursor.encode() + "&offset=5", pageParams{}, "'cursor' and 'offset' cannot be used together"},
+		{"cursor=not-base64!", pageParams{}, "invalid cursor"},
+		{"cursor=" + url.QueryEscape("bm90IGpzb24"), pageParams{}, "invalid cursor"},
+		{"since=2021-09-01T01:00:00%2B01:00", pageParams{Limit: 50, Since: &since}, ""},
+		{"until=1630454400", pageParams{Limit: 50, Until: &since}, ""},
+		{"since=yesterday", pageParams{}, "'since' must be an RFC3339 timestamp or unix seconds"},
+		{"since=1630454400&until=1630454399", pageParams{}, "'until' must not be before 'since'"},
+	}
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		params, err := parsePageParams(query, 50)
+		if test.errMsg != "" {
+			if err == nil || err.Error() != test.errMsg {
+				t.Errorf("%q: got %v, want %s", test.query, err, test.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.query, err)
+			continue
+		}
+		if params.Limit != test.want.Limit || params.Offset != test.want.Offset ||
+			(params.Cursor == nil) != (test.want.Cursor == nil) || params.Cursor != nil && *params.Cursor != *test.want.Cursor ||
+			(params.Since == nil) != (test.want.Since == nil) || params.Since != nil && !params.Since.Equal(*test.want.Since) ||
+			(params.Until == nil) != (test.want.Until == nil) || params.Until != nil && !params.Until.Equal(*test.want.Until) {
+			t.Errorf("%q: parsed as %+v", test.query, params)
+		}
+	}
+}
+
+type pageItem struct {
+	id   string
+	date time.Time
+}
+
+func pageKey(item pageItem) cursorKey {
+	return cursorKey{Time: item.date.UnixNano(), ID: item.id}
+}
+
+func pageIDs(items []pageItem) string {
+	ids := []string{}
+	for _, item := range items {
+		ids = append(ids, item.id)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestPaginate(t *testing.T) {
+	start := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return start.AddDate(0, 0, n) }
+	// Out of order, with b and c at the same time
+	items := []pageItem{{"d", day(3)}, {"a", day(0)}, {"c", day(1)}, {"b", day(1)}, {"e", day(4)}}
+
+	tests := []struct {
+		name       string
+		params     pageParams
+		descending bool
+		want       string
+		info       pagination
+	}{
+		{"oldest first", pageParams{Limit: 10}, false, "a,b,c,d,e", pagination{Limit: 10, Total: 5}},
+		{"newest first", pageParams{Limit: 10}, true, "e,d,c,b,a", pagination{Limit: 10, Total: 5}},
+		{"limit", pageParams{Limit: 2}, false, "a,b", pagination{Limit: 2, Total: 5, NextCursor: pageKey(items[3]).encode()}},
+		{"offset", pageParams{Limit: 2, Offset: 2}, false, "c,d", pagination{Limit: 2, Offset: 2, Total: 5, NextCursor: pageKey(items[0]).encode()}},
+		{"last page", pageParams{Limit: 2, Offset: 4}, false, "e", pagination{Limit: 2, Offset: 4, Total: 5}},
+		{"offset past the end", pageParams{Limit: 2, Offset: 10}, false, "", pagination{Limit: 2, Offset: 5, Total: 5}},
+		// since is inclusive, until is exclusive
+		{"since", pageParams{Limit: 10, Since: &[]time.Time{day(1)}[0]}, false, "b,c,d,e", pagination{Limit: 10, Total: 4}},
+		{"until", pageParams{Limit: 10, Until: &[]time.Time{day(3)}[0]}, false, "a,b,c", pagination{Limit: 10, Total: 3}},
+		{"since and until", pageParams{Limit: 10, Since: &[]time.Time{day(1)}[0], Until: &[]time.Time{day(4)}[0]}, true, "d,c,b", pagination{Limit: 10, Total: 3}},
+		{"cursor", pageParams{Limit: 2, Cursor: &cursorKey{Time: day(1).UnixNano(), ID: "b"}}, false, "c,d", pagination{Limit: 2, Offset: 2, Total: 5, NextCursor: pageKey(items[0]).encode()}},
+		{"cursor descending", pageParams{Limit: 2, Cursor: &cursorKey{Time: day(1).UnixNano(), ID: "c"}}, true, "b,a", pagination{Limit: 2, Offset: 3, Total: 5}},
+		// The item the cursor came from was removed, paging carries on from where it was
+		{"cursor of a removed item", pageParams{Limit: 10, Cursor: &cursorKey{Time: day(2).UnixNano(), ID: "gone"}}, true, "c,b,a", pagination{Limit: 10, Offset: 2, Total: 5}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, info := paginate(items, pageKey, test.descending, &test.params)
+			if got := pageIDs(page); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+			if info != test.info {
+				t.Errorf("pagination %+v, want %+v", info, test.info)
+			}
+		})
+	}
+}
+
+func TestPaginateCursorWalk(t *testing.T) {
+	start := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
+	items := []pageItem{}
+	for n := 0; n < 7; n++ {
+		// Pairs share a time, so pages split ties
+		items = append(items, pageItem{string(rune('a' + n)), start.Add(time.Duration(n/2) * time.Hour)})
+	}
+
+	for _, descending := range []bool{false, true} {
+		params := &pageParams{Limit: 3}
+		pages := []string{}
+		for {
+			page, info := paginate(items, pageKey, descending, params)
+			pages = append(pages, pageIDs(page))
+			if info.NextCursor == "" {
+				break
+			}
+			if len(pages) > len(items) {
+				t.Fatal("cursors never reached the end")
+			}
+			query := url.Values{"limit": {"3"}, "cursor": {info.NextCursor}}
+			var err error
+			if params, err = parsePageParams(query, 10); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := "abc|def|g"
+		if descending {
+			want = "gfe|dcb|a"
+		}
+		if got := strings.ReplaceAll(strings.Join(pages, "|"), ",", ""); got != want {
+			t.Errorf("descending %t: paged as %s, want %s", descending, got, want)
+		}
+	}
+}
+
+func TestMalformedCursor(t *testing.T) {
+	useTestConfig(t)
+	router := v1Router()
+	for _, path := range []string{"/v1/events", "/v1/announcements"} {
+		for _, cursor := range []string{"!!!", "bm90IGpzb24", cursorKey{ID: "1"}.encode() + "%00"} {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?cursor="+cursor, nil))
+			body := errorBody{}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Errorf("%s with cursor %s: %v", path, cursor, err)
+				continue
+			}
+			if w.Code != http.StatusBadRequest || w.Header().Get("content-type") != "application/json" ||
+				body.Error.Status != http.StatusBadRequest || body.Error.Message != "invalid cursor" {
+				t.Errorf("%s with cursor %s: %d %s %+v", path, cursor, w.Code, w.Header().Get("content-type"), body)
+			}
+		}
+	}
+}
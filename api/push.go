@@ -0,0 +1,225 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/apognu/gocal"
+	"github.com/matryer/try"
+)
+
+// Notification types pushed to the website
+const (
+	announcementCreated = "announcement.created"
+	announcementUpdated = "announcement.updated"
+	announcementDeleted = "announcement.deleted"
+	eventCreated        = "event.created"
+	eventUpdated        = "event.updated"
+	eventDeleted        = "event.deleted"
+)
+
+type notification struct {
+	ID   int64       `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+var (
+	subscribers     = map[chan notification]struct{}{}
+	subscribersLock sync.Mutex
+	lastNotifyID    int64
+	webhookClient   = http.Client{Timeout: 10 * time.Second}
+	webhookBackoff  = 5 * time.Second // Multiplied by the attempt number
+)
+
+const webhookAttempts = 3
+
+// publish sends a notification to every stream subscriber and configured webhook
+func publish(kind string, data interface{}) {
+	subscribersLock.Lock()
+	lastNotifyID++
+	n := notification{ID: lastNotifyID, Type: kind, Time: time.Now(), Data: data}
+	for sub := range subscribers {
+		select {
+		case sub <- n:
+		default:
+			// Slow clients miss notifications rather than blocking the bot
+		}
+	}
+	subscribersLock.Unlock()
+
+	urls := webhookURLs()
+	if len(urls) == 0 {
+		return
+	}
+	// Receivers couldn't tell these apart from forgeries without a secret
+	if config.GetString("api.webhooks.secret") == "" {
+		log.WithFields(log.Fields{"type": kind}).Error("Not delivering webhooks, api.webhooks.secret isn't set")
+		return
+	}
+	for _, url := range urls {
+		go deliverWebhook(url, n)
+	}
+}
+
+func subscribe() chan notification {
+	sub := make(chan notification, 16)
+	subscribersLock.Lock()
+	subscribers[sub] = struct{}{}
+	subscribersLock.Unlock()
+	return sub
+}
+
+func unsubscribe(sub chan notification) {
+	subscribersLock.Lock()
+	delete(subscribers, sub)
+	subscribersLock.Unlock()
+}
+
+func webhookURLs() []string {
+	urls := []string{}
+	for _, value := range config.GetStringSlice("api.webhooks.urls") {
+		for _, url := range strings.Split(value, ",") {
+			if url = strings.TrimSpace(url); url != "" {
+				urls = append(urls, url)
+			}
+		}
+	}
+	return urls
+}
+
+// signPayload is the hex HMAC-SHA256 of the body using api.webhooks.secret
+func signPayload(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(config.GetString("api.webhooks.secret")))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func deliverWebhook(url string, n notification) {
+	body, err := json.Marshal(n)
+	if err != nil {
+		log.WithError(err).Error("Failed to marshal webhook notification")
+		return
+	}
+	err = try.Do(func(attempt int) (bool, error) {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Netsoc-Event", n.Type)
+		req.Header.Set("X-Netsoc-Signature", "sha256="+signPayload(body))
+		resp, err := webhookClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				err = fmt.Errorf("webhook returned %s", resp.Status)
+			}
+		}
+		retry := attempt < webhookAttempts
+		if err != nil && retry {
+			time.Sleep(time.Duration(attempt) * webhookBackoff)
+		}
+		return retry, err
+	})
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"url": url, "type": n.Type}).Error("Failed to deliver webhook")
+	}
+}
+
+// v1Stream is a Server-Sent Events stream of notifications
+func v1Stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Subscribed before the headers are sent, so nothing published once the client is connected is missed
+	sub := subscribe()
+	defer unsubscribe(sub)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case n := <-sub:
+			data, err := json.Marshal(n.Data)
+			if err != nil {
+				log.WithError(err).Error("Failed to marshal stream notification")
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", n.ID, n.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
+// watchCalendar polls the public calendar and publishes changed events
+func watchCalendar() {
+	var previous map[string]string
+	for {
+		events, err := QueryCalendarEvents(config.GetString("google.calendar.public.ics"))
+		if err != nil {
+			log.WithError(err).Error("Failed to poll calendar for changes")
+		} else {
+			cached.Set("events", events, config.GetDuration("api.push.calendar_interval"))
+			previous = diffEvents(previous, events)
+		}
+		<-time.After(config.GetDuration("api.push.calendar_interval"))
+	}
+}
+
+// diffEvents publishes the differences against the previous poll and returns the new state.
+// Nothing is published on the first poll.
+func diffEvents(previous map[string]string, events []gocal.Event) map[string]string {
+	current := map[string]string{}
+	byID := map[string]returnEvent{}
+	for _, event := range events {
+		ret := newReturnEvent(event)
+		b, _ := json.Marshal(ret)
+		current[ret.ID] = string(b)
+		byID[ret.ID] = ret
+	}
+	if previous == nil {
+		return current
+	}
+	for id, state := range current {
+		if old, ok := previous[id]; !ok {
+			publish(eventCreated, byID[id])
+		} else if old != state {
+			publish(eventUpdated, byID[id])
+		}
+	}
+	for id, state := range previous {
+		if _, ok := current[id]; ok {
+			continue
+		}
+		old := returnEvent{}
+		json.Unmarshal([]byte(state), &old)
+		// Events which finished simply fell out of the window
+		if old.EndDate != nil && old.EndDate.After(time.Now()) {
+			publish(eventDeleted, old)
+		}
+	}
+	return current
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apognu/gocal"
+)
+
+// collect notifications published during the test, take returns those since the last take
+func collect(t *testing.T) (take func() []notification) {
+	t.Helper()
+	sub := subscribe()
+	t.Cleanup(func() { unsubscribe(sub) })
+	return func() []notification {
+		taken := []notification{}
+		for {
+			select {
+			case n := <-sub:
+				taken = append(taken, n)
+			default:
+				return taken
+			}
+		}
+	}
+}
+
+func oneOff(uid, summary string, start time.Time) gocal.Event {
+	end := start.Add(time.Hour)
+	return gocal.Event{Uid: uid, Summary: summary, Start: &start, End: &end}
+}
+
+func flatten(events map[string][]gocal.Event) []gocal.Event {
+	all := []gocal.Event{}
+	for _, occurrences := range events {
+		all = append(all, occurrences...)
+	}
+	return all
+}
+
+func TestDiffEvents(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	tomorrow := now.Add(24 * time.Hour)
+	window := []time.Time{time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)}
+	weekly := flatten(parseFixture(t, "recurring.ics", window[0], window[1]))
+	moved := flatten(parseFixture(t, "rescheduled.ics", window[0], window[1]))
+	// Both have the occurrence originally at 19:00 GMT on the 29th
+	movedID := "weekly@netsoc.co-" + strconv.FormatInt(time.Date(2024, 10, 29, 19, 0, 0, 0, time.UTC).Unix(), 10)
+
+	tests := []struct {
+		name     string
+		previous []gocal.Event
+		current  []gocal.Event
+		want     []string
+	}{
+		{"unchanged", []gocal.Event{oneOff("a", "Games night", tomorrow)}, []gocal.Event{oneOff("a", "Games night", tomorrow)}, nil},
+		{"created", []gocal.Event{oneOff("a", "Games night", tomorrow)}, []gocal.Event{oneOff("a", "Games night", tomorrow), oneOff("b", "AGM", tomorrow)}, []string{"event.created b"}},
+		{"rescheduled", []gocal.Event{oneOff("a", "Games night", tomorrow)}, []gocal.Event{oneOff("a", "Games night", tomorrow.Add(2*time.Hour))}, []string{"event.updated a"}},
+		{"renamed", []gocal.Event{oneOff("a", "Games night", tomorrow)}, []gocal.Event{oneOff("a", "Board games night", tomorrow)}, []string{"event.updated a"}},
+		{"occurrence rescheduled", weekly, moved, []string{"event.updated " + movedID}},
+		{"deleted", []gocal.Event{oneOff("a", "Games night", tomorrow), oneOff("b", "AGM", tomorrow)}, []gocal.Event{oneOff("b", "AGM", tomorrow)}, []string{"event.deleted a"}},
+		{"cancelled part way through", []gocal.Event{oneOff("a", "Hackathon", now.Add(-30*time.Minute))}, nil, []string{"event.deleted a"}},
+		// Finished events drop out of the calendar window without having been deleted
+		{"ended", []gocal.Event{oneOff("a", "Games night", now.Add(-2*time.Hour)), oneOff("b", "AGM", tomorrow)}, []gocal.Event{oneOff("b", "AGM", tomorrow)}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			take := collect(t)
+			state := diffEvents(nil, test.previous)
+			if first := take(); len(first) != 0 {
+				t.Fatalf("published %d notifications on the first poll", len(first))
+			}
+			state = diffEvents(state, test.current)
+			got := []string{}
+			for _, n := range take() {
+				got = append(got, n.Type+" "+n.Data.(returnEvent).ID)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ", ") != strings.Join(test.want, ", ") {
+				t.Errorf("published %v, want %v", got, test.want)
+			}
+			if len(state) != len(test.current) {
+				t.Errorf("state has %d events, want %d", len(state), len(test.current))
+			}
+		})
+	}
+
+	// The moved occurrence keeps its ID with its new times
+	state := diffEvents(diffEvents(nil, weekly), moved)
+	if !strings.Contains(state[movedID], `"start_date":"2024-10-30T18:00:00Z"`) {
+		t.Errorf("moved occurrence is %s", state[movedID])
+	}
+}
+
+func TestSignPayload(t *testing.T) {
+	// https://datatracker.ietf.org/doc/html/rfc4231#section-4.3
+	setConfig(t, "api.webhooks.secret", "Jefe")
+	if got := signPayload([]byte("what do ya want for nothing?")); got != "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843" {
+		t.Errorf("signed as %s", got)
+	}
+	setConfig(t, "api.webhooks.secret", "rotated")
+	if got := signPayload([]byte("what do ya want for nothing?")); got == "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843" {
+		t.Error("signature doesn't depend on the secret")
+	}
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	setConfig(t, "api.webhooks.secret", "hunter2")
+	previous := webhookBackoff
+	webhookBackoff = 100 * time.Millisecond
+	t.Cleanup(func() { webhookBackoff = previous })
+
+	for _, failures := range []int32{0, 1, webhookAttempts} {
+		attempts := atomic.Int32{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			mac := hmac.New(sha256.New, []byte("hunter2"))
+			mac.Write(body)
+			if r.Header.Get("X-Netsoc-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) || r.Header.Get("X-Netsoc-Event") != eventCreated {
+				t.Errorf("webhook signed %s for %s", r.Header.Get("X-Netsoc-Signature"), r.Header.Get("X-Netsoc-Event"))
+			}
+			if attempts.Add(1) <= failures {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		}))
+		started := time.Now()
+		deliverWebhook(server.URL, notification{ID: 1, Type: eventCreated, Data: "data"})
+		server.Close()
+
+		want := failures + 1
+		if failures == webhookAttempts {
+			want = webhookAttempts
+		}
+		if attempts.Load() != want {
+			t.Errorf("%d failures: delivered in %d attempts, want %d", failures, attempts.Load(), want)
+		}
+		// Backs off 100ms then 200ms, with no wait after the last attempt
+		if elapsed := time.Since(started); failures == webhookAttempts && elapsed > 500*time.Millisecond {
+			t.Errorf("took %s to give up", elapsed)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(v1Stream))
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("content type %s", resp.Header.Get("Content-Type"))
+	}
+
+	// Subscribed by the time the headers arrive
+	publish(announcementCreated, map[string]string{"id": "1", "content": "line one\nline two"})
+	publish(eventDeleted, map[string]string{"id": "2"})
+	reader := bufio.NewReader(resp.Body)
+	events := []string{}
+	for len(events) < 2 {
+		event := []string{}
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == "\n" {
+				break
+			}
+			event = append(event, strings.TrimSuffix(line, "\n"))
+		}
+		events = append(events, strings.Join(event, "|"))
+	}
+	for idx, want := range []string{
+		// Newlines in the data are escaped by the JSON, so each event's data is a single line
+		`event: announcement.created|data: {"content":"line one\nline two","id":"1"}`,
+		`event: event.deleted|data: {"id":"2"}`,
+	} {
+		id, rest, _ := strings.Cut(events[idx], "|")
+		if !strings.HasPrefix(id, "id: ") || rest != want {
+			t.Errorf("event %d framed as %q, want an id then %q", idx, events[idx], want)
+		}
+	}
+}
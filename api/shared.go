@@ -1,10 +1,7 @@
 package api
 
 import (
-	"bytes"
-	"fmt"
-	"io/ioutil"
-	"net/http"
+	"strings"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -17,9 +14,38 @@ type Entry interface {
 
 // Image to be embedded in an entry
 type Image struct {
-	ImgData   *bytes.Buffer
-	ImgHeader *http.Header
-	ImgURL    string
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Attachment is a file attached to an announcement
+type Attachment struct {
+	ID          string `json:"id"`
+	URL         string `json:"url"`
+	ProxyURL    string `json:"proxy_url"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+}
+
+// Embed is a rich embed included in an announcement
+type Embed struct {
+	Title        string `json:"title,omitempty"`
+	Description  string `json:"description,omitempty"`
+	URL          string `json:"url,omitempty"`
+	ImageURL     string `json:"image_url,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	VideoURL     string `json:"video_url,omitempty"`
+}
+
+// Reaction is the count of one emoji on an announcement
+type Reaction struct {
+	Emoji    string `json:"emoji"`
+	EmojiURL string `json:"emoji_url,omitempty"`
+	Count    int    `json:"count"`
 }
 
 // GetContent returns message content
@@ -27,36 +53,61 @@ func (a Announcement) GetContent() string {
 	return a.Content
 }
 
-// GetImage returns Image response data
+// GetImage returns the first image attached or embedded in the announcement
 func (a Announcement) GetImage() *Image {
-	return a.Image
-}
-
-func parseImage(m *discordgo.Message) (*Image, error) {
-	var (
-		image       *http.Response
-		err         error
-		imageHeader *http.Header
-		imageURL    string
-		imageBody   *bytes.Buffer
-	)
-	if len(m.Attachments) > 0 && m.Attachments[0].Width > 0 {
-		image, err = http.Get(m.Attachments[0].URL)
-		if err != nil {
-			return nil, fmt.Errorf("Error parsing image: %w", err)
+	for _, attachment := range a.Attachments {
+		if attachment.Width > 0 || strings.HasPrefix(attachment.ContentType, "image/") {
+			return &Image{URL: attachment.URL, Width: attachment.Width, Height: attachment.Height}
 		}
-		imageHeader = &image.Header
-		imageURL = image.Request.URL.String()
-		imageRead, err := ioutil.ReadAll(image.Body)
-		if err != nil {
-			return nil, err
+	}
+	for _, emb := range a.Embeds {
+		if emb.ImageURL != "" {
+			return &Image{URL: emb.ImageURL}
 		}
-		imageBody = bytes.NewBuffer(imageRead)
-		defer image.Body.Close()
-	}
-	return &Image{
-		ImgData:   imageBody,
-		ImgURL:    imageURL,
-		ImgHeader: imageHeader,
-	}, nil
+	}
+	return nil
+}
+
+func newAttachment(a *discordgo.MessageAttachment) Attachment {
+	return Attachment{
+		ID:          a.ID,
+		URL:         a.URL,
+		ProxyURL:    a.ProxyURL,
+		Filename:    a.Filename,
+		ContentType: a.ContentType,
+		Size:        a.Size,
+		Width:       a.Width,
+		Height:      a.Height,
+	}
+}
+
+func newEmbed(e *discordgo.MessageEmbed) Embed {
+	emb := Embed{
+		Title:       e.Title,
+		Description: e.Description,
+		URL:         e.URL,
+	}
+	if e.Image != nil {
+		emb.ImageURL = e.Image.URL
+	}
+	if e.Thumbnail != nil {
+		emb.ThumbnailURL = e.Thumbnail.URL
+	}
+	if e.Video != nil {
+		emb.VideoURL = e.Video.URL
+	}
+	return emb
+}
+
+func newReaction(r *discordgo.MessageReactions) Reaction {
+	reaction := Reaction{Count: r.Count}
+	if r.Emoji != nil {
+		reaction.Emoji = r.Emoji.Name
+		if r.Emoji.ID != "" && r.Emoji.Animated {
+			reaction.EmojiURL = discordgo.EndpointEmojiAnimated(r.Emoji.ID)
+		} else if r.Emoji.ID != "" {
+			reaction.EmojiURL = discordgo.EndpointEmoji(r.Emoji.ID)
+		}
+	}
+	return reaction
 }
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/apognu/gocal"
+)
+
+// v1Handlers by path, each is documented in v1Routes
+var v1Handlers = map[string]http.HandlerFunc{
+	"/v1/events":        v1Events,
+	"/v1/announcements": v1Announcements,
+	"/v1/members":       v1Members,
+	"/v1/stream":        v1Stream,
+	"/v1/openapi.json":  v1OpenAPI,
+}
+
+// v1Router serves the versioned REST API under /v1
+func v1Router() http.Handler {
+	mux := http.NewServeMux()
+	for path, handler := range v1Handlers {
+		mux.HandleFunc(path, getOnly(handler))
+	}
+	mux.HandleFunc("/v1/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "No such endpoint")
+	})
+	return withCORS(mux)
+}
+
+func getOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "Only GET is supported")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func v1Events(w http.ResponseWriter, r *http.Request) {
+	params, err := parsePageParams(r.URL.Query(), config.GetInt("api.event_query_limit"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	events, err := PublicEvents()
+	if err != nil {
+		log.WithError(err).Error("Error querying events for api")
+		writeError(w, http.StatusBadGateway, "Failed to get events")
+		return
+	}
+	page, info := paginate(events, func(e gocal.Event) cursorKey {
+		return cursorKey{Time: e.Start.UnixNano(), ID: eventID(e)}
+	}, false, params)
+
+	data := []returnEvent{}
+	for _, event := range page {
+		data = append(data, newReturnEvent(event))
+	}
+	writeJSON(w, http.StatusOK, listResponse{Data: data, Pagination: info})
+}
+
+func v1Announcements(w http.ResponseWriter, r *http.Request) {
+	params, err := parsePageParams(r.URL.Query(), config.GetInt("api.announcement_query_limit"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	announcements, err := publicAnnouncements(r.URL.Query().Get("include_deleted") == "true")
+	if err != nil {
+		log.WithError(err).Error("Error querying announcements for api")
+		writeError(w, http.StatusBadGateway, "Failed to get announcements")
+		return
+	}
+	page, info := paginate(announcements, func(a *Announcement) cursorKey {
+		return cursorKey{Time: a.Date.UnixNano(), ID: a.ID}
+	}, true, params)
+
+	data := []returnAnnouncement{}
+	for _, ann := range page {
+		data = append(data, newReturnAnnouncement(ann))
+	}
+	writeJSON(w, http.StatusOK, listResponse{Data: data, Pagination: info})
+}
+
+func v1Members(w http.ResponseWriter, r *http.Request) {
+	count, err := publicMemberCount()
+	if err != nil {
+		log.WithError(err).Error("Failed to get members")
+		writeError(w, http.StatusBadGateway, "Failed to get members")
+		return
+	}
+	writeJSON(w, http.StatusOK, returnMembers{Count: count})
+}
+
+func v1OpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, openAPIDocument())
+}
@@ -0,0 +1,130 @@
+// Package charts renders go-chart PNGs to attach to Discord messages.
+package charts
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+// Colours matching Discord's dark theme
+var (
+	Background = drawing.ColorFromHex("2f3136")
+	Foreground = drawing.ColorFromHex("ffffff")
+	// Palette tells apart several series on one chart
+	Palette = []drawing.Color{
+		drawing.ColorFromHex("9b12f1"),
+		drawing.ColorFromHex("57f287"),
+		drawing.ColorFromHex("fee75c"),
+		drawing.ColorFromHex("eb459e"),
+		drawing.ColorFromHex("5865f2"),
+		drawing.ColorFromHex("ed4245"),
+	}
+)
+
+// Graph is anything go-chart can render, such as chart.Chart or chart.BarChart
+type Graph interface {
+	Render(rp chart.RendererProvider, w io.Writer) error
+}
+
+// Attachment is a rendered chart, embeds show it with SetImage(attachment.URL())
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+// URL refers to the attachment from an embed in the same message
+func (a *Attachment) URL() string {
+	return "attachment://" + a.Name
+}
+
+// File to send with the message. Each call reads the chart from the start, so it can be sent again.
+func (a *Attachment) File() *discordgo.File {
+	return &discordgo.File{Name: a.Name, ContentType: "image/png", Reader: bytes.NewReader(a.Data)}
+}
+
+// Files to send for every attachment
+func Files(attachments ...*Attachment) []*discordgo.File {
+	files := []*discordgo.File{}
+	for _, attachment := range attachments {
+		files = append(files, attachment.File())
+	}
+	return files
+}
+
+// Render a graph as a PNG attachment. Attachment names can only use letters, numbers, - and _.
+func Render(name string, graph Graph) (*Attachment, error) {
+	if !strings.HasSuffix(name, ".png") {
+		name += ".png"
+	}
+	buffer := &bytes.Buffer{}
+	if err := graph.Render(chart.PNG, buffer); err != nil {
+		return nil, err
+	}
+	return &Attachment{Name: name, Data: buffer.Bytes()}, nil
+}
+
+// Dark styles a chart's background and axes for Discord's dark theme
+func Dark(graph *chart.Chart) {
+	background := chart.Style{
+		StrokeWidth: 0,
+		FillColor:   Background,
+		Show:        true,
+	}
+	graph.Canvas = background
+	graph.Background = background
+	graph.XAxis.TickStyle = tickStyle()
+	graph.XAxis.Style = axisStyle()
+	graph.YAxis.TickStyle = tickStyle()
+	graph.YAxis.Style = axisStyle()
+	// An empty secondary axis would squash the chart, so it's only styled when a series uses it
+	for _, series := range graph.Series {
+		if series.GetYAxis() == chart.YAxisSecondary {
+			graph.YAxisSecondary.TickStyle = tickStyle()
+			graph.YAxisSecondary.Style = axisStyle()
+			break
+		}
+	}
+}
+
+// Line is a time series drawn in the given colour, without filling the area below so overlaid lines stay visible
+func Line(colour drawing.Color, width float64) chart.Style {
+	return chart.Style{
+		StrokeWidth: width,
+		StrokeColor: colour,
+		Show:        true,
+	}
+}
+
+// Dashed is a line drawn with dashes, to set apart a second measure in the same colour
+func Dashed(colour drawing.Color, width float64) chart.Style {
+	style := Line(colour, width)
+	style.StrokeDashArray = []float64{6, 4}
+	return style
+}
+
+// Colour from the palette for the nth series
+func Colour(n int) drawing.Color {
+	return Palette[n%len(Palette)]
+}
+
+func tickStyle() chart.Style {
+	return chart.Style{
+		StrokeWidth: 1,
+		StrokeColor: Foreground,
+		FillColor:   Background,
+		Show:        true,
+	}
+}
+
+func axisStyle() chart.Style {
+	return chart.Style{
+		FontColor: Foreground,
+		FillColor: Background,
+		Show:      true,
+	}
+}
@@ -0,0 +1,64 @@
+// render-emails writes every email template, filled with sample data, to a directory for review.
+//
+//	go run ./cmd/render-emails -out emails-preview
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/UCCNetsoc/discord-bot/emails"
+)
+
+var samples = map[string]interface{}{
+	emails.VerificationTemplate: emails.VerificationData{
+		Code:    "482913",
+		Expires: "15 minutes",
+	},
+	emails.NewsletterTemplate: emails.NewsletterData{
+		Subject:        "UCC Netsoc Newsletter",
+		Content:        "Hey everyone!\nOur AGM is on next Wednesday in WGB G.05 & there will be <pizza>.\nSee you there!",
+		ImageURL:       "https://raw.githubusercontent.com/UCCNetsoc/wiki/master/assets/logo-horizontal-inverted.png",
+		UnsubscribeURL: "http://localhost:2112/newsletter/unsubscribe?token=sample",
+	},
+	emails.EventReminderTemplate: emails.EventReminderData{
+		Title:       "Intro to Go",
+		Description: "Learn the basics of Go.\nBring a laptop!",
+		When:        "Wednesday 2 March at 18:00",
+		Duration:    "2 hours",
+	},
+}
+
+func main() {
+	out := flag.String("out", "emails-preview", "directory to write the rendered templates to")
+	flag.Parse()
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		exitError(err)
+	}
+	for _, name := range emails.Templates() {
+		data, ok := samples[name]
+		if !ok {
+			exitError(fmt.Errorf("no sample data for template %q", name))
+		}
+		rendered, err := emails.Render(name, data)
+		if err != nil {
+			exitError(fmt.Errorf("rendering %s: %w", name, err))
+		}
+		if err := os.WriteFile(filepath.Join(*out, name+".html"), []byte(rendered.HTML), 0o644); err != nil {
+			exitError(err)
+		}
+		text := fmt.Sprintf("Subject: %s\n\n%s", rendered.Subject, rendered.Text)
+		if err := os.WriteFile(filepath.Join(*out, name+".txt"), []byte(text), 0o644); err != nil {
+			exitError(err)
+		}
+		fmt.Println("Rendered", name)
+	}
+}
+
+func exitError(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
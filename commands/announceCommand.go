@@ -0,0 +1,377 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/api"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/UCCNetsoc/discord-bot/embed"
+	"github.com/UCCNetsoc/discord-bot/store"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	scheduledPending   = "pending"
+	scheduledPosting   = "posting" // Claimed by postDueAnnouncements, left as is if the bot stops part way so it isn't posted twice
+	scheduledPosted    = "posted"
+	scheduledCancelled = "cancelled"
+	scheduledFailed    = "failed"
+
+	scheduledMaxAttempts = 5
+	announceContentInput = "content"
+)
+
+// scheduledAnnouncement is an announcement queued to be posted to the public announcements channel
+type scheduledAnnouncement struct {
+	ID            int64
+	Content       string
+	SourceChannel sql.NullString
+	SourceMessage sql.NullString
+	AuthorID      string
+	PostAt        time.Time
+	Status        string
+	Attempts      int
+}
+
+func announceCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	topLevelArgs := i.ApplicationCommandData().Options[0]
+	args := optionMap(topLevelArgs.Options)
+
+	switch topLevelArgs.Name {
+	case "schedule":
+		postAt, err := parseAnnounceTime(args["time"].StringValue())
+		if err != nil {
+			InteractionResponseError(s, i, err.Error(), false)
+			return
+		}
+		if msg, ok := args["message"]; ok {
+			scheduleFromMessage(ctx, s, i, msg.StringValue(), postAt)
+			return
+		}
+		announceModal(ctx, s, i, fmt.Sprintf("announce_schedule:%d", postAt.Unix()), "Schedule announcement", "")
+
+	case "list":
+		announceList(ctx, s, i)
+
+	case "edit":
+		scheduled, err := getScheduled(args["id"].IntValue())
+		if err != nil {
+			InteractionResponseError(s, i, err.Error(), false)
+			return
+		}
+		if t, ok := args["time"]; ok {
+			postAt, err := parseAnnounceTime(t.StringValue())
+			if err != nil {
+				InteractionResponseError(s, i, err.Error(), false)
+				return
+			}
+			res, err := store.DB.Exec("UPDATE scheduled_announcements SET post_at = $1 WHERE id = $2 AND status = $3;", postAt, scheduled.ID, scheduledPending)
+			if err != nil {
+				log.WithContext(ctx).WithError(err).Error("Failed to reschedule announcement")
+				InteractionResponseError(s, i, "Couldn't reschedule the announcement", true)
+				return
+			}
+			if updated, _ := res.RowsAffected(); updated == 0 {
+				InteractionResponseError(s, i, fmt.Sprintf("Announcement #%d is no longer pending", scheduled.ID), false)
+				return
+			}
+			announceRespond(ctx, s, i, fmt.Sprintf("Announcement #%d rescheduled for <t:%d:F>", scheduled.ID, postAt.Unix()))
+			return
+		}
+		announceModal(ctx, s, i, fmt.Sprintf("announce_edit:%d", scheduled.ID), fmt.Sprintf("Edit announcement #%d", scheduled.ID), scheduled.Content)
+
+	case "cancel":
+		scheduled, err := getScheduled(args["id"].IntValue())
+		if err != nil {
+			InteractionResponseError(s, i, err.Error(), false)
+			return
+		}
+		// Only pending announcements can be cancelled, it may have been claimed for posting since it was read
+		res, err := store.DB.Exec("UPDATE scheduled_announcements SET status = $1 WHERE id = $2 AND status = $3;", scheduledCancelled, scheduled.ID, scheduledPending)
+		if err != nil {
+			log.WithContext(ctx).WithError(err).Error("Failed to cancel announcement")
+			InteractionResponseError(s, i, "Couldn't cancel the announcement", true)
+			return
+		}
+		if updated, _ := res.RowsAffected(); updated == 0 {
+			InteractionResponseError(s, i, fmt.Sprintf("Announcement #%d is no longer pending", scheduled.ID), false)
+			return
+		}
+		announceRespond(ctx, s, i, fmt.Sprintf("Announcement #%d cancelled", scheduled.ID))
+	}
+}
+
+// Modal submitted from /announce schedule
+func announceScheduleSubmit(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, arg := splitCustomID(i.ModalSubmitData().CustomID)
+	unix, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		InteractionResponseError(s, i, "Invalid schedule time", true)
+		return
+	}
+	content := modalValue(i.ModalSubmitData(), announceContentInput)
+	id, err := insertScheduled(content, "", "", i.Member.User.ID, time.Unix(unix, 0))
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to schedule announcement")
+		InteractionResponseError(s, i, "Couldn't schedule the announcement", true)
+		return
+	}
+	announceRespond(ctx, s, i, fmt.Sprintf("Announcement #%d scheduled for <t:%d:F>", id, unix))
+}
+
+// Modal submitted from /announce edit
+func announceEditSubmit(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, arg := splitCustomID(i.ModalSubmitData().CustomID)
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		InteractionResponseError(s, i, "Invalid announcement", true)
+		return
+	}
+	content := modalValue(i.ModalSubmitData(), announceContentInput)
+	res, err := store.DB.Exec("UPDATE scheduled_announcements SET content = $1 WHERE id = $2 AND status = $3;", content, id, scheduledPending)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to edit announcement")
+		InteractionResponseError(s, i, "Couldn't edit the announcement", true)
+		return
+	}
+	if updated, _ := res.RowsAffected(); updated == 0 {
+		InteractionResponseError(s, i, fmt.Sprintf("Announcement #%d is no longer pending", id), false)
+		return
+	}
+	announceRespond(ctx, s, i, fmt.Sprintf("Announcement #%d updated", id))
+}
+
+func scheduleFromMessage(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, reference string, postAt time.Time) {
+	channelID, messageID, err := parseMessageReference(reference, i.ChannelID)
+	if err != nil {
+		InteractionResponseError(s, i, err.Error(), false)
+		return
+	}
+	message, err := s.ChannelMessage(channelID, messageID)
+	if err != nil {
+		InteractionResponseError(s, i, "Couldn't find that message", false)
+		return
+	}
+	id, err := insertScheduled(message.Content, channelID, messageID, i.Member.User.ID, postAt)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to schedule announcement")
+		InteractionResponseError(s, i, "Couldn't schedule the announcement", true)
+		return
+	}
+	announceRespond(ctx, s, i, fmt.Sprintf("Announcement #%d scheduled for <t:%d:F>", id, postAt.Unix()))
+}
+
+func announceList(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	rows, err := store.DB.Query(
+		"SELECT id, content, author_id, post_at FROM scheduled_announcements WHERE status = $1 ORDER BY post_at ASC LIMIT $2;",
+		scheduledPending, embed.EmbedLimitField,
+	)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to list scheduled announcements")
+		InteractionResponseError(s, i, "Couldn't list scheduled announcements", true)
+		return
+	}
+	defer rows.Close()
+
+	emb := embed.NewEmbed().SetTitle("Scheduled Announcements")
+	for rows.Next() {
+		a := scheduledAnnouncement{}
+		if err := rows.Scan(&a.ID, &a.Content, &a.AuthorID, &a.PostAt); err != nil {
+			log.WithContext(ctx).WithError(err).Error("Failed to read row")
+			continue
+		}
+		preview := a.Content
+		if runes := []rune(preview); len(runes) > 200 {
+			preview = string(runes[:200]) + "..."
+		}
+		emb.AddField(fmt.Sprintf("#%d", a.ID), fmt.Sprintf("<t:%d:F> by <@%s>\n%s", a.PostAt.Unix(), a.AuthorID, preview))
+	}
+	if len(emb.Fields) == 0 {
+		emb.SetDescription("Nothing is scheduled")
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{emb.MessageEmbed},
+		},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+func announceModal(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, customID, title, content string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: customID,
+			Title:    title,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:  announceContentInput,
+							Label:     "Announcement",
+							Style:     discordgo.TextInputParagraph,
+							Value:     content,
+							Required:  true,
+							MaxLength: 2000,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+func announceRespond(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+		},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+// parseAnnounceTime accepts a duration from now, RFC3339 or a date and time in the calendar timezone
+func parseAnnounceTime(input string) (time.Time, error) {
+	input = strings.TrimSpace(input)
+	var postAt time.Time
+	if d, err := time.ParseDuration(input); err == nil {
+		postAt = time.Now().Add(d)
+	} else if t, err := time.Parse(time.RFC3339, input); err == nil {
+		postAt = t
+	} else {
+		parsed := false
+		for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "02/01/2006 15:04"} {
+			if t, err := time.ParseInLocation(layout, input, api.CalendarLocation()); err == nil {
+				postAt, parsed = t, true
+				break
+			}
+		}
+		if !parsed {
+			return postAt, fmt.Errorf("couldn't understand %q, try `2h30m` or `2006-01-02 15:04`", input)
+		}
+	}
+	if postAt.Before(time.Now()) {
+		return postAt, errors.New("that time has already passed")
+	}
+	return postAt, nil
+}
+
+func insertScheduled(content, sourceChannel, sourceMessage, authorID string, postAt time.Time) (int64, error) {
+	var id int64
+	err := store.DB.QueryRow(
+		"INSERT INTO scheduled_announcements(content, source_channel, source_message, author_id, post_at, status) VALUES($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6) RETURNING id;",
+		content, sourceChannel, sourceMessage, authorID, postAt, scheduledPending,
+	).Scan(&id)
+	return id, err
+}
+
+func getScheduled(id int64) (*scheduledAnnouncement, error) {
+	a := &scheduledAnnouncement{}
+	err := store.DB.QueryRow(
+		"SELECT id, content, source_channel, source_message, author_id, post_at, status, attempts FROM scheduled_announcements WHERE id = $1;", id,
+	).Scan(&a.ID, &a.Content, &a.SourceChannel, &a.SourceMessage, &a.AuthorID, &a.PostAt, &a.Status, &a.Attempts)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't find announcement #%d", id)
+	}
+	if a.Status == scheduledPosting {
+		return nil, fmt.Errorf("announcement #%d is being posted", id)
+	}
+	if a.Status != scheduledPending {
+		return nil, fmt.Errorf("announcement #%d has already been %s", id, a.Status)
+	}
+	return a, nil
+}
+
+// ScheduledAnnouncements posts queued announcements when they are due.
+// The queue is stored in the database so pending announcements survive restarts.
+func ScheduledAnnouncements(s *discordgo.Session) {
+	for {
+		postDueAnnouncements(s)
+		<-time.After(30 * time.Second)
+	}
+}
+
+func postDueAnnouncements(s *discordgo.Session) {
+	rows, err := store.DB.Query(
+		"SELECT id, content, source_channel, source_message, author_id, post_at, status, attempts FROM scheduled_announcements WHERE status = $1 AND post_at <= NOW() ORDER BY post_at ASC;",
+		scheduledPending,
+	)
+	if err != nil {
+		log.WithError(err).Error("Failed to query scheduled announcements")
+		return
+	}
+	due := []scheduledAnnouncement{}
+	for rows.Next() {
+		a := scheduledAnnouncement{}
+		if err := rows.Scan(&a.ID, &a.Content, &a.SourceChannel, &a.SourceMessage, &a.AuthorID, &a.PostAt, &a.Status, &a.Attempts); err != nil {
+			log.WithError(err).Error("Failed to read row")
+			continue
+		}
+		due = append(due, a)
+	}
+	rows.Close()
+
+	channels := config.Get().Channels()
+	for _, a := range due {
+		// Claimed before posting, so a cancel after the query stops it, and it isn't posted again if marking it posted fails
+		res, err := store.DB.Exec("UPDATE scheduled_announcements SET status = $1 WHERE id = $2 AND status = $3;", scheduledPosting, a.ID, scheduledPending)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"id": a.ID}).Error("Failed to claim scheduled announcement")
+			continue
+		}
+		if claimed, _ := res.RowsAffected(); claimed == 0 {
+			continue
+		}
+		message, err := postScheduled(s, channels.PublicAnnouncements, a)
+		if err != nil {
+			status := scheduledPending
+			if a.Attempts+1 >= scheduledMaxAttempts {
+				status = scheduledFailed
+			}
+			log.WithError(err).WithFields(log.Fields{"id": a.ID, "attempt": a.Attempts + 1}).Error("Failed to post scheduled announcement")
+			store.DB.Exec("UPDATE scheduled_announcements SET attempts = attempts + 1, status = $1 WHERE id = $2;", status, a.ID)
+			continue
+		}
+		if _, err = store.DB.Exec("UPDATE scheduled_announcements SET status = $1, posted_id = $2 WHERE id = $3;", scheduledPosted, message.ID, a.ID); err != nil {
+			log.WithError(err).WithFields(log.Fields{"id": a.ID}).Error("Failed to mark scheduled announcement posted")
+		}
+	}
+}
+
+func postScheduled(s *discordgo.Session, channelID string, a scheduledAnnouncement) (*discordgo.Message, error) {
+	send := &discordgo.MessageSend{
+		Content: a.Content,
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Parse: []discordgo.AllowedMentionType{discordgo.AllowedMentionTypeEveryone, discordgo.AllowedMentionTypeRoles},
+		},
+	}
+	if a.SourceMessage.Valid {
+		source, err := s.ChannelMessage(a.SourceChannel.String, a.SourceMessage.String)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't fetch source message: %w", err)
+		}
+		files, closeFiles, err := reuploadAttachments(source)
+		if err != nil {
+			return nil, err
+		}
+		defer closeFiles()
+		send.Files = files
+	}
+	return s.ChannelMessageSendComplex(channelID, send)
+}
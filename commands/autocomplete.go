@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord drops autocomplete responses after 3 seconds, this leaves time to send them
+const autocompleteTimeout = 2 * time.Second
+
+// Discord shows at most 25 choices, with names of up to 100 characters
+const (
+	maxChoices    = 25
+	maxChoiceName = 100
+)
+
+// choicesFunc lists every value an option could take, they're ranked against what's been typed by respondChoices
+type choicesFunc func(context.Context, *discordgo.Session, *discordgo.InteractionCreate) ([]*discordgo.ApplicationCommandOptionChoice, error)
+
+// respondChoices sends the choices best matching typed. If the provider fails, any choices it did return are still sent.
+func respondChoices(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, function choicesFunc, typed string) {
+	ctx, cancel := context.WithTimeout(ctx, autocompleteTimeout)
+	defer cancel()
+	choices, err := function(ctx, s, i)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to list autocomplete choices")
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: rankChoices(typed, choices)},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+// rankChoices keeps the choices matching typed, best matches first.
+// Equally good matches keep the order they were listed in, so providers can list the likeliest first.
+func rankChoices(typed string, choices []*discordgo.ApplicationCommandOptionChoice) []*discordgo.ApplicationCommandOptionChoice {
+	typed = strings.ToLower(strings.TrimSpace(typed))
+	type ranked struct {
+		choice *discordgo.ApplicationCommandOptionChoice
+		score  int
+	}
+	matches := []ranked{}
+	for _, choice := range choices {
+		score, ok := matchScore(typed, choice.Name)
+		if value, isString := choice.Value.(string); isString {
+			if valueScore, valueOK := matchScore(typed, value); valueOK && (!ok || valueScore < score) {
+				score, ok = valueScore, true
+			}
+		}
+		if ok {
+			matches = append(matches, ranked{choice, score})
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].score < matches[b].score })
+	best := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, match := range matches {
+		if len(best) == maxChoices {
+			break
+		}
+		if runes := []rune(match.choice.Name); len(runes) > maxChoiceName {
+			match.choice.Name = string(runes[:maxChoiceName-1]) + "…"
+		}
+		best = append(best, match.choice)
+	}
+	return best
+}
+
+// matchScore of a candidate for what's been typed, lower is better.
+// Exact matches beat prefixes, then the start of a later word, then anywhere inside,
+// then the typed letters in order with the fewest letters between them.
+func matchScore(typed, candidate string) (int, bool) {
+	candidate = strings.ToLower(candidate)
+	switch {
+	case typed == "" || candidate == typed:
+		return 0, true
+	case strings.HasPrefix(candidate, typed):
+		return 1, true
+	}
+	if strings.Contains(candidate, typed) {
+		for _, word := range strings.FieldsFunc(candidate, isWordSeparator) {
+			if strings.HasPrefix(word, typed) {
+				return 2, true
+			}
+		}
+		return 3, true
+	}
+	// Fuzzy matches rank after substrings, tighter ones first
+	gaps, next, started := 0, 0, false
+	letters := []rune(typed)
+	for _, letter := range candidate {
+		if next == len(letters) {
+			break
+		}
+		if letter == letters[next] {
+			next++
+			started = true
+		} else if started {
+			gaps++
+		}
+	}
+	if next < len(letters) {
+		return 0, false
+	}
+	return 4 + gaps, true
+}
+
+func isWordSeparator(r rune) bool {
+	return strings.ContainsRune(" -_./:", r)
+}
+
+// focusedOptions finds the option being typed in, inside any subcommand
+func focusedOptions(options []*discordgo.ApplicationCommandInteractionDataOption) []*discordgo.ApplicationCommandInteractionDataOption {
+	focused := []*discordgo.ApplicationCommandInteractionDataOption{}
+	for _, option := range options {
+		if option.Focused {
+			focused = append(focused, option)
+		}
+		focused = append(focused, focusedOptions(option.Options)...)
+	}
+	return focused
+}
@@ -0,0 +1,141 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func choiceNames(choices []*discordgo.ApplicationCommandOptionChoice) string {
+	names := []string{}
+	for _, choice := range choices {
+		names = append(names, choice.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func namedChoices(names ...string) []*discordgo.ApplicationCommandOptionChoice {
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, name := range names {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: strings.ToLower(name)})
+	}
+	return choices
+}
+
+func TestRankChoices(t *testing.T) {
+	tests := []struct {
+		name    string
+		typed   string
+		choices []*discordgo.ApplicationCommandOptionChoice
+		want    string
+	}{
+		{
+			"tiers", "land",
+			namedChoices("Poland", "Lan Party Day", "Old Land Rd", "Landscape", "Finland", "Land", "Lead and Ink", "Ireland"),
+			// Exact, prefix, word prefix, substrings, then fuzzy by gaps
+			"Land, Landscape, Old Land Rd, Poland, Finland, Ireland, Lead and Ink, Lan Party Day",
+		},
+		{
+			"ignores case and spaces", "  UNITED ",
+			namedChoices("The United States", "United Kingdom", "united"),
+			"united, United Kingdom, The United States",
+		},
+		{
+			"word separators", "bot",
+			namedChoices("robotics", "netsoc/bot", "discord-bot", "bot_runner", "my.bot"),
+			"bot_runner, netsoc/bot, discord-bot, my.bot, robotics",
+		},
+		{
+			// Listed order is kept within each tier, so providers can put the likeliest first
+			"stable within a tier", "a",
+			namedChoices("Bravo", "Alpha", "Charlie", "Able", "Delta", "Ace"),
+			"Alpha, Able, Ace, Bravo, Charlie, Delta",
+		},
+		{
+			"fewer gaps first", "ire",
+			namedChoices("In Rare Events", "Iraq Ecuador", "I R E"),
+			"I R E, Iraq Ecuador, In Rare Events",
+		},
+		{
+			"no match", "xyz",
+			namedChoices("Ireland", "Germany"),
+			"",
+		},
+		{
+			"everything when nothing is typed", "",
+			namedChoices("Ireland", "Germany", "France"),
+			"Ireland, Germany, France",
+		},
+		{
+			// Values match too, with the better of the two scores
+			"values", "ie",
+			[]*discordgo.ApplicationCommandOptionChoice{
+				{Name: "Italy", Value: "it"},
+				{Name: "Ireland", Value: "ie"},
+				{Name: "Belgium", Value: 1},
+				{Name: "Fiery", Value: "fi"},
+			},
+			"Ireland, Fiery",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := choiceNames(rankChoices(test.typed, test.choices)); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		typed     string
+		candidate string
+		score     int
+		ok        bool
+	}{
+		{"", "anything", 0, true},
+		{"ireland", "Ireland", 0, true},
+		{"ire", "Ireland", 1, true},
+		{"zea", "New Zealand", 2, true},
+		{"eal", "New Zealand", 3, true},
+		{"nz", "New Zealand", 4 + 3, true},
+		// Gaps are only counted once the first letter matches
+		{"ld", "New Zealand", 4 + 2, true},
+		{"dn", "New Zealand", 0, false},
+	}
+	for _, test := range tests {
+		score, ok := matchScore(test.typed, test.candidate)
+		if score != test.score || ok != test.ok {
+			t.Errorf("%q for %q scored %d, %t, want %d, %t", test.typed, test.candidate, score, ok, test.score, test.ok)
+		}
+	}
+}
+
+func TestRankChoicesLimits(t *testing.T) {
+	names := []string{}
+	for n := 0; n < 40; n++ {
+		names = append(names, fmt.Sprintf("Modded Server %02d", n))
+	}
+	// The cap applies after ranking, so the best match listed last isn't cut off
+	names = append(names, "Server")
+	ranked := rankChoices("server", namedChoices(names...))
+	if len(ranked) != maxChoices || ranked[0].Name != "Server" || ranked[1].Name != "Modded Server 00" || ranked[maxChoices-1].Name != "Modded Server 23" {
+		t.Errorf("got %d choices: %s", len(ranked), choiceNames(ranked))
+	}
+
+	long := strings.Repeat("é", 150)
+	ranked = rankChoices("", namedChoices(long, strings.Repeat("a", 100)))
+	if name := []rune(ranked[0].Name); len(name) != maxChoiceName || string(name[maxChoiceName-1]) != "…" || string(name[:maxChoiceName-1]) != strings.Repeat("é", maxChoiceName-1) {
+		t.Errorf("%d rune name truncated to %q", 150, ranked[0].Name)
+	}
+	// The value is left alone, it's what the command receives
+	if ranked[0].Value != long {
+		t.Error("value truncated")
+	}
+	if ranked[1].Name != strings.Repeat("a", 100) {
+		t.Errorf("100 rune name truncated to %q", ranked[1].Name)
+	}
+}
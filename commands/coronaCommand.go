@@ -2,31 +2,57 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/charts"
+	"github.com/UCCNetsoc/discord-bot/config"
 	"github.com/UCCNetsoc/discord-bot/corona"
 	"github.com/UCCNetsoc/discord-bot/embed"
 	"github.com/bwmarrin/discordgo"
-	"github.com/spf13/viper"
+	"github.com/patrickmn/go-cache"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 )
 
+// Countries listed by the summary, cached for autocompletion
+var coronaCountries = cache.New(time.Hour, time.Hour)
+
 func coronaCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	switch options[0].Name {
+	case "stats":
+		coronaStats(ctx, s, i, optionMap(options[0].Options))
+	case "compare":
+		coronaCompare(ctx, s, i, options[0].Options)
+	}
+}
+
+func coronaStats(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, args map[string]*discordgo.ApplicationCommandInteractionDataOption) {
 	var embeds []*discordgo.MessageEmbed
 	var countryInput string
-	args := i.ApplicationCommandData().Options
-	total, err, _ := corona.GetCorona()
+	opts := corona.Options{}
+	if opt, ok := args["days"]; ok {
+		opts.CompareDays = int(opt.IntValue())
+	}
+	if opt, ok := args["average"]; ok {
+		opts.Average = opt.BoolValue()
+	}
+	if opt, ok := args["per100k"]; ok {
+		opts.Per100k = opt.BoolValue()
+	}
+	total, err := corona.Data.Summary(ctx)
 	if err != nil {
 		log.WithError(err).WithContext(ctx).Error("covid summary invalid output")
 		InteractionResponseError(s, i, "Unable to parse covid stats", true)
 		return
 	}
 	p := message.NewPrinter(language.English)
-	if len(args) < 1 {
-		countryInput = viper.GetString("corona.default")
+	if _, ok := args["country"]; !ok {
+		countryInput = config.GetString("corona.default")
 		// Also send global stats
 		body := "**New**\n"
 		body += p.Sprintf("Cases: %d\n", total.Global["NewConfirmed"].(int))
@@ -45,25 +71,19 @@ func coronaCommand(ctx context.Context, s *discordgo.Session, i *discordgo.Inter
 	} else {
 		countryInput = strings.ToLower(
 			strings.ReplaceAll(
-				strings.TrimSpace(args[0].StringValue()),
+				strings.TrimSpace(args["country"].StringValue()),
 				" ", "-",
 			),
 		)
 	}
-	var country *corona.CountrySummary
-	if countryInput == viper.GetString("corona.default") {
-		_, country, err = corona.GetArcgis()
-		if err != nil {
-			log.WithError(err).WithContext(ctx).Error("covid arcgis invalid output")
-			InteractionResponseError(s, i, "Unable to parse covid stats", true)
-			return
-		}
-	} else {
-		country = total.GetCountry(countryInput)
+	country, err := corona.Data.Country(ctx, countryInput)
+	if err != nil && !errors.Is(err, corona.ErrUnknownCountry) {
+		log.WithError(err).WithContext(ctx).Error("covid country invalid output")
+		InteractionResponseError(s, i, "Unable to parse covid stats", true)
+		return
 	}
 	if country != nil {
-		var coronaEmbeds []*discordgo.MessageEmbed
-		coronaEmbeds, err = corona.CreateEmbed(country, s, ctx)
+		coronaEmbeds, graphs, err := corona.CreateEmbed(country, ctx, opts)
 		if err != nil {
 			InteractionResponseError(s, i, err.Error(), true)
 			return
@@ -73,6 +93,7 @@ func coronaCommand(ctx context.Context, s *discordgo.Session, i *discordgo.Inter
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
 				Embeds: embeds,
+				Files:  charts.Files(graphs...),
 			},
 		})
 		if err != nil {
@@ -82,3 +103,95 @@ func coronaCommand(ctx context.Context, s *discordgo.Session, i *discordgo.Inter
 		InteractionResponseError(s, i, fmt.Sprintf("Couldn't find a country called %s", countryInput), false)
 	}
 }
+
+// Compare the rates per 100k people of up to five countries
+func coronaCompare(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
+	// Getting every country's history can take longer than the interaction deadline
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+		return
+	}
+	total, err := corona.Data.Summary(ctx)
+	if err != nil {
+		log.WithError(err).WithContext(ctx).Error("covid summary invalid output")
+		coronaEdit(ctx, s, i, "Unable to parse covid stats")
+		return
+	}
+	countries := []corona.CountrySummary{}
+	seen := map[string]bool{}
+	for _, option := range options {
+		country := total.FindCountry(option.StringValue())
+		if country == nil {
+			coronaEdit(ctx, s, i, fmt.Sprintf("Couldn't find a country called %s", option.StringValue()))
+			return
+		}
+		if !seen[country.Slug] && len(countries) < corona.MaxCompare {
+			seen[country.Slug] = true
+			countries = append(countries, *country)
+		}
+	}
+	rates, err := corona.Rates(ctx, countries)
+	if err != nil {
+		log.WithError(err).WithContext(ctx).Error("Failed to get covid rates")
+		coronaEdit(ctx, s, i, fmt.Sprintf("Unable to compare: %v", err))
+		return
+	}
+	emb := corona.CompareTable(rates)
+	graph, err := corona.CompareGraph(rates)
+	if err != nil {
+		log.WithError(err).WithContext(ctx).Error("Failed to chart covid rates")
+	} else {
+		emb.Image = &discordgo.MessageEmbedImage{URL: graph.URL()}
+	}
+	edit := &discordgo.WebhookEdit{Embeds: &[]*discordgo.MessageEmbed{emb}}
+	if graph != nil {
+		edit.Files = charts.Files(graph)
+	}
+	if _, err = s.InteractionResponseEdit(i.Interaction, edit); err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+func coronaEdit(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	_, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+// Countries from the summary, by name
+func coronaCountryChoices(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) ([]*discordgo.ApplicationCommandOptionChoice, error) {
+	countries, err := coronaCountryList(ctx)
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, country := range countries {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: country.Country, Value: country.Slug})
+	}
+	return choices, err
+}
+
+// Countries from the summary which can be compared, as their population is known
+func coronaCompareChoices(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) ([]*discordgo.ApplicationCommandOptionChoice, error) {
+	countries, err := coronaCountryList(ctx)
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, country := range countries {
+		if _, ok := corona.CountryPopulation(country.Slug); ok {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: country.Country, Value: country.Slug})
+		}
+	}
+	return choices, err
+}
+
+func coronaCountryList(ctx context.Context) ([]corona.CountrySummary, error) {
+	if countries, ok := coronaCountries.Get("countries"); ok {
+		return countries.([]corona.CountrySummary), nil
+	}
+	total, err := corona.Data.Summary(ctx)
+	if err != nil {
+		return nil, err
+	}
+	coronaCountries.SetDefault("countries", total.Countries)
+	return total.Countries, nil
+}
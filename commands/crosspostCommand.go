@@ -0,0 +1,251 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/UCCNetsoc/discord-bot/embed"
+	"github.com/UCCNetsoc/discord-bot/store"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	crosspostPending   = "pending"
+	crosspostPublished = "published"
+	crosspostDiscarded = "discarded"
+)
+
+// crosspostDraft is a committee message awaiting approval to be published to the public server
+type crosspostDraft struct {
+	ID          int64
+	ChannelID   string
+	MessageID   string
+	AuthorID    string
+	Status      string
+	ApprovedBy  sql.NullString
+	PublishedID sql.NullString
+}
+
+// Preview a committee message as it will be published, for a second committee member to approve
+func crosspostCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	message, ok := data.Resolved.Messages[data.TargetID]
+	if !ok {
+		InteractionResponseError(s, i, "Couldn't find that message", true)
+		return
+	}
+	if len(message.Content) == 0 && len(message.Attachments) == 0 {
+		InteractionResponseError(s, i, "That message has nothing to publish", false)
+		return
+	}
+
+	var id int64
+	err := store.DB.QueryRow(
+		"INSERT INTO crossposts(channel_id, message_id, author_id, status) VALUES($1, $2, $3, $4) RETURNING id;",
+		i.ChannelID, message.ID, i.Member.User.ID, crosspostPending,
+	).Scan(&id)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to store crosspost draft")
+		InteractionResponseError(s, i, "Couldn't save the draft", true)
+		return
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:    fmt.Sprintf("%s wants to publish this to the public announcements channel. A second committee member needs to approve it.", i.Member.User.Mention()),
+			Embeds:     []*discordgo.MessageEmbed{crosspostPreview(message)},
+			Components: crosspostButtons(id),
+			AllowedMentions: &discordgo.MessageAllowedMentions{
+				Parse: []discordgo.AllowedMentionType{},
+			},
+		},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+func crosspostApprove(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	draft, err := crosspostFromInteraction(i)
+	if err != nil {
+		InteractionResponseError(s, i, err.Error(), true)
+		return
+	}
+	if draft.AuthorID == i.Member.User.ID {
+		InteractionResponseError(s, i, "A different committee member has to approve this", false)
+		return
+	}
+
+	// Downloading and re-uploading images can take longer than the interaction deadline
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+		return
+	}
+
+	// Claim the draft so two approvals can't both publish it
+	res, err := store.DB.Exec(
+		"UPDATE crossposts SET status = $1, approved_by = $2 WHERE id = $3 AND status = $4;",
+		crosspostPublished, i.Member.User.ID, draft.ID, crosspostPending,
+	)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to claim crosspost draft")
+		crosspostFollowup(s, i, "Couldn't approve the draft")
+		return
+	}
+	if claimed, _ := res.RowsAffected(); claimed == 0 {
+		crosspostFollowup(s, i, "This draft has already been handled")
+		return
+	}
+
+	published, err := publishCrosspost(s, draft)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to publish crosspost")
+		store.DB.Exec("UPDATE crossposts SET status = $1, approved_by = NULL WHERE id = $2;", crosspostPending, draft.ID)
+		crosspostFollowup(s, i, fmt.Sprintf("Encountered error: %v", err))
+		return
+	}
+	if _, err = store.DB.Exec("UPDATE crossposts SET published_id = $1 WHERE id = $2;", published.ID, draft.ID); err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to record published crosspost")
+	}
+
+	content := fmt.Sprintf("Published to <#%s>, drafted by <@%s> and approved by %s.", published.ChannelID, draft.AuthorID, i.Member.User.Mention())
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content:         &content,
+		Components:      &[]discordgo.MessageComponent{},
+		AllowedMentions: &discordgo.MessageAllowedMentions{Parse: []discordgo.AllowedMentionType{}},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+func crosspostDiscard(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	draft, err := crosspostFromInteraction(i)
+	if err != nil {
+		InteractionResponseError(s, i, err.Error(), true)
+		return
+	}
+	// Only pending drafts are discarded, an approval may have claimed it since it was read
+	res, err := store.DB.Exec(
+		"UPDATE crossposts SET status = $1 WHERE id = $2 AND status = $3;",
+		crosspostDiscarded, draft.ID, crosspostPending,
+	)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to discard crosspost draft")
+		InteractionResponseError(s, i, "Couldn't discard the draft", true)
+		return
+	}
+	if discarded, _ := res.RowsAffected(); discarded == 0 {
+		InteractionResponseError(s, i, "This draft has already been handled", true)
+		return
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    fmt.Sprintf("Discarded by %s.", i.Member.User.Mention()),
+			Components: []discordgo.MessageComponent{},
+			AllowedMentions: &discordgo.MessageAllowedMentions{
+				Parse: []discordgo.AllowedMentionType{},
+			},
+		},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+// publishCrosspost sends the current version of the draft message to the public announcements channel
+func publishCrosspost(s *discordgo.Session, draft *crosspostDraft) (*discordgo.Message, error) {
+	message, err := s.ChannelMessage(draft.ChannelID, draft.MessageID)
+	if err != nil {
+		return nil, errors.New("couldn't fetch the draft message, was it deleted?")
+	}
+	files, closeFiles, err := reuploadAttachments(message)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles()
+	channels := config.Get().Channels()
+	return s.ChannelMessageSendComplex(channels.PublicAnnouncements, &discordgo.MessageSend{
+		Content: message.Content,
+		Files:   files,
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Parse: []discordgo.AllowedMentionType{discordgo.AllowedMentionTypeEveryone, discordgo.AllowedMentionTypeRoles},
+		},
+	})
+}
+
+func crosspostFollowup(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	_, err := s.FollowupMessageCreate(i.Interaction, false, &discordgo.WebhookParams{
+		Content: content,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to send followup")
+	}
+}
+
+// crosspostFromInteraction loads the pending draft referenced by a button's custom ID
+func crosspostFromInteraction(i *discordgo.InteractionCreate) (*crosspostDraft, error) {
+	_, id := splitCustomID(i.MessageComponentData().CustomID)
+	draftID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid draft")
+	}
+	draft := &crosspostDraft{}
+	err = store.DB.QueryRow(
+		"SELECT id, channel_id, message_id, author_id, status, approved_by, published_id FROM crossposts WHERE id = $1;", draftID,
+	).Scan(&draft.ID, &draft.ChannelID, &draft.MessageID, &draft.AuthorID, &draft.Status, &draft.ApprovedBy, &draft.PublishedID)
+	if err != nil {
+		return nil, errors.New("couldn't find that draft")
+	}
+	if draft.Status != crosspostPending {
+		return nil, fmt.Errorf("this draft has already been %s", draft.Status)
+	}
+	return draft, nil
+}
+
+func crosspostPreview(message *discordgo.Message) *discordgo.MessageEmbed {
+	emb := embed.NewEmbed().SetTitle("Announcement preview").SetDescription(message.Content)
+	if message.Author != nil {
+		emb.SetAuthor(message.Author.Username, message.Author.AvatarURL("128"))
+	}
+	for _, attachment := range message.Attachments {
+		if attachment.Width > 0 {
+			emb.SetImage(attachment.URL)
+			break
+		}
+	}
+	if len(message.Attachments) > 0 {
+		emb.SetFooter(fmt.Sprintf("%d attachment(s) will be re-uploaded", len(message.Attachments)))
+	}
+	return emb.MessageEmbed
+}
+
+func crosspostButtons(id int64) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Approve & publish",
+					Style:    discordgo.SuccessButton,
+					CustomID: fmt.Sprintf("crosspost_approve:%d", id),
+				},
+				discordgo.Button{
+					Label:    "Discard",
+					Style:    discordgo.DangerButton,
+					CustomID: fmt.Sprintf("crosspost_discard:%d", id),
+				},
+			},
+		},
+	}
+}
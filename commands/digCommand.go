@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Strum355/log"
@@ -12,6 +13,14 @@ import (
 	"github.com/bwmarrin/discordgo"
 )
 
+// Domains queried since the bot started, most recent first, suggested when typing a domain
+var (
+	recentDomains   []string
+	recentDomainsMu sync.Mutex
+)
+
+const maxRecentDomains = 50
+
 func dig(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
 	args := i.ApplicationCommandData().Options
 
@@ -94,6 +103,8 @@ func dig(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCrea
 		}).
 		Info("got DNS response")
 
+	rememberDomain(args[1].StringValue())
+
 	var b strings.Builder
 	b.WriteString("```\n")
 
@@ -132,3 +143,26 @@ func dig(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCrea
 		log.WithError(err)
 	}
 }
+
+func rememberDomain(domain string) {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	recentDomainsMu.Lock()
+	defer recentDomainsMu.Unlock()
+	domains := []string{domain}
+	for _, recent := range recentDomains {
+		if recent != domain && len(domains) < maxRecentDomains {
+			domains = append(domains, recent)
+		}
+	}
+	recentDomains = domains
+}
+
+func digDomainChoices(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) ([]*discordgo.ApplicationCommandOptionChoice, error) {
+	recentDomainsMu.Lock()
+	defer recentDomainsMu.Unlock()
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, domain := range recentDomains {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: domain, Value: domain})
+	}
+	return choices, nil
+}
@@ -5,18 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/Strum355/log"
 	"github.com/UCCNetsoc/discord-bot/api"
+	"github.com/UCCNetsoc/discord-bot/config"
 	"github.com/UCCNetsoc/discord-bot/embed"
+	"github.com/apognu/gocal"
 	"github.com/bwmarrin/discordgo"
-	"github.com/spf13/viper"
 )
 
 func upcomingEvent(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
-	calendarURL := viper.GetString("google.calendar.public.ics")
-	if i.GuildID == viper.GetString("discord.committee.server") {
-		calendarURL = viper.GetString("google.calendar." + i.ApplicationCommandData().Options[0].StringValue() + ".ics")
+	calendarURL := config.GetString("google.calendar.public.ics")
+	if i.GuildID == config.GetString("discord.committee.server") {
+		calendarURL = config.GetString("google.calendar." + i.ApplicationCommandData().Options[0].StringValue() + ".ics")
 	}
 	eventEmbeds, err := upcomingEventEmbeds(ctx, s, 2, calendarURL)
 	if err != nil {
@@ -73,11 +75,12 @@ func upcomingEventEmbeds(ctx context.Context, s *discordgo.Session, limit int, u
 				}
 			}
 		}
-		if emb.Image == nil && viper.GetString("google.calendar.image.default") != "" {
-			emb.SetThumbnail(viper.GetString("google.calendar.image.default"))
+		if emb.Image == nil && config.GetString("google.calendar.image.default") != "" {
+			emb.SetThumbnail(config.GetString("google.calendar.image.default"))
 		}
 
-		emb.AddField("When?", fmt.Sprintf("<t:%v:F>", event.Start.Unix()))
+		emb.AddField("When?", eventTimeRange(event))
+		emb.AddField("How long?", formatDuration(api.EventDuration(event)))
 
 		emb.SetAuthor("Netsoc Event", s.State.User.AvatarURL("2048"), "https://netsoc.co/go/calendar")
 
@@ -85,3 +88,47 @@ func upcomingEventEmbeds(ctx context.Context, s *discordgo.Session, limit int, u
 	}
 	return eventEmbeds, nil
 }
+
+// Discord timestamps render in the reader's own timezone
+func eventTimeRange(event gocal.Event) string {
+	start, end := event.Start, event.End
+	if api.IsAllDay(event) {
+		last := end.AddDate(0, 0, -1)
+		if last.After(*start) {
+			return fmt.Sprintf("<t:%d:D> - <t:%d:D>", start.Unix(), last.Unix())
+		}
+		return fmt.Sprintf("<t:%d:D> (all day)", start.Unix())
+	}
+	sy, sm, sd := start.Date()
+	ey, em, ed := end.Date()
+	if sy == ey && sm == em && sd == ed {
+		return fmt.Sprintf("<t:%d:F> - <t:%d:t>", start.Unix(), end.Unix())
+	}
+	return fmt.Sprintf("<t:%d:F> - <t:%d:F>", start.Unix(), end.Unix())
+}
+
+func formatDuration(d time.Duration) string {
+	if d <= 0 {
+		return "Unknown"
+	}
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+
+	parts := []string{}
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%dd", days))
+	}
+	if hours > 0 {
+		parts = append(parts, fmt.Sprintf("%dh", hours))
+	}
+	if minutes > 0 {
+		parts = append(parts, fmt.Sprintf("%dm", minutes))
+	}
+	if len(parts) == 0 {
+		return "Less than a minute"
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,255 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/UCCNetsoc/discord-bot/embed"
+	"github.com/UCCNetsoc/discord-bot/feeds"
+	"github.com/UCCNetsoc/discord-bot/store"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Watcher which RSS subscriptions are added to
+var feedWatcher *feeds.Watcher
+
+// rssFeed is a subscription to an RSS or Atom feed
+type rssFeed struct {
+	ID        int64
+	URL       string
+	Title     string
+	ChannelID string
+	Filter    string
+	Limit     int
+}
+
+func (f *rssFeed) name() string {
+	return fmt.Sprintf("rss:%d", f.ID)
+}
+
+func (f *rssFeed) feed() (*feeds.Feed, error) {
+	source := &feeds.RSSSource{URL: f.URL}
+	if f.Filter != "" {
+		filter, err := regexp.Compile("(?i)" + f.Filter)
+		if err != nil {
+			return nil, err
+		}
+		source.Filter = filter
+	}
+	return &feeds.Feed{
+		Name:     f.name(),
+		Source:   source,
+		Channels: []string{f.ChannelID},
+		Interval: config.GetDuration("rss.interval"),
+		Dedupe:   true,
+		Limit:    f.Limit,
+	}, nil
+}
+
+// WatchFeeds adds the stored RSS subscriptions to the watcher, which /feeds will also add to
+func WatchFeeds(w *feeds.Watcher) error {
+	feedWatcher = w
+	if err := store.CreateTables(
+		"CREATE TABLE IF NOT EXISTS rss_feeds(id SERIAL PRIMARY KEY, url TEXT NOT NULL, title TEXT NOT NULL, channel_id VARCHAR(32) NOT NULL, filter TEXT NOT NULL DEFAULT '', post_limit INT NOT NULL, added_by VARCHAR(32) NOT NULL);",
+	); err != nil {
+		return err
+	}
+	subscriptions, err := rssFeeds()
+	if err != nil {
+		return err
+	}
+	for _, subscription := range subscriptions {
+		feed, err := subscription.feed()
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"feed": subscription.URL}).Error("Invalid feed subscription")
+			continue
+		}
+		w.Add(feed)
+	}
+	config.OnReload(func(cfg *config.Config) {
+		subscriptions, err := rssFeeds()
+		if err != nil {
+			log.WithError(err).Error("Failed to update feed intervals")
+			return
+		}
+		for _, subscription := range subscriptions {
+			w.SetInterval(subscription.name(), cfg.RSS.Interval)
+		}
+	})
+	return nil
+}
+
+func feedsCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if feedWatcher == nil {
+		InteractionResponseError(s, i, "Feeds aren't running", false)
+		return
+	}
+	options := i.ApplicationCommandData().Options
+	switch options[0].Name {
+	case "add":
+		feedsAdd(ctx, s, i, optionMap(options[0].Options))
+	case "list":
+		feedsList(ctx, s, i)
+	case "remove":
+		feedsRemove(ctx, s, i, optionMap(options[0].Options))
+	}
+}
+
+// Subscribe a channel to a feed, only entries published after this are posted
+func feedsAdd(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, args map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	subscription := &rssFeed{
+		URL:       strings.TrimSpace(args["url"].StringValue()),
+		ChannelID: args["channel"].ChannelValue(s).ID,
+		Limit:     config.GetInt("rss.limit"),
+	}
+	if opt, ok := args["filter"]; ok {
+		subscription.Filter = opt.StringValue()
+		if _, err := regexp.Compile(subscription.Filter); err != nil {
+			InteractionResponseError(s, i, fmt.Sprintf("Invalid filter: %v", err), false)
+			return
+		}
+	}
+	if opt, ok := args["limit"]; ok {
+		subscription.Limit = int(opt.IntValue())
+	}
+
+	// Fetching can be slow, and checks the URL really is a feed before subscribing
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+		return
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	doc, err := feeds.FetchFeed(fetchCtx, subscription.URL)
+	if err != nil {
+		feedsEdit(ctx, s, i, fmt.Sprintf("Couldn't read that feed: %v", err))
+		return
+	}
+	subscription.Title = doc.Title
+	if subscription.Title == "" {
+		subscription.Title = subscription.URL
+	}
+
+	err = store.DB.QueryRow(
+		"INSERT INTO rss_feeds(url, title, channel_id, filter, post_limit, added_by) VALUES($1, $2, $3, $4, $5, $6) RETURNING id;",
+		subscription.URL, subscription.Title, subscription.ChannelID, subscription.Filter, subscription.Limit, i.Member.User.ID,
+	).Scan(&subscription.ID)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to store feed")
+		feedsEdit(ctx, s, i, "Encountered error: couldn't save the feed")
+		return
+	}
+	feed, err := subscription.feed()
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to create feed")
+		feedsEdit(ctx, s, i, "Encountered error: couldn't start the feed")
+		return
+	}
+	feedWatcher.Add(feed)
+	feedsEdit(ctx, s, i, fmt.Sprintf("Feed #%d: new posts from **%s** will appear in <#%s>", subscription.ID, subscription.Title, subscription.ChannelID))
+}
+
+func feedsList(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	subscriptions, err := rssFeeds()
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to list feeds")
+		InteractionResponseError(s, i, "Couldn't list the feeds", true)
+		return
+	}
+	emb := embed.NewEmbed().SetTitle("Feeds")
+	if len(subscriptions) == 0 {
+		emb.SetDescription("No feeds yet, add one with `/feeds add`")
+	}
+	for _, subscription := range subscriptions {
+		details := fmt.Sprintf("%s\nPosts in <#%s>, at most %d at a time", subscription.URL, subscription.ChannelID, subscription.Limit)
+		if subscription.Filter != "" {
+			details += fmt.Sprintf("\nFilter: `%s`", subscription.Filter)
+		}
+		emb.AddField(fmt.Sprintf("#%d %s", subscription.ID, subscription.Title), details)
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{emb.MessageEmbed},
+			Flags:  discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+func feedsRemove(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, args map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	subscription := &rssFeed{ID: args["id"].IntValue()}
+	err := store.DB.QueryRow("DELETE FROM rss_feeds WHERE id = $1 RETURNING title;", subscription.ID).Scan(&subscription.Title)
+	if errors.Is(err, sql.ErrNoRows) {
+		InteractionResponseError(s, i, fmt.Sprintf("There's no feed #%d", subscription.ID), false)
+		return
+	}
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to remove feed")
+		InteractionResponseError(s, i, "Couldn't remove the feed", true)
+		return
+	}
+	if err = feedWatcher.Remove(subscription.name()); err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to remove feed state")
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("Removed feed #%d %s", subscription.ID, subscription.Title),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+func feedsEdit(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	_, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+func rssFeeds() ([]*rssFeed, error) {
+	rows, err := store.DB.Query("SELECT id, url, title, channel_id, filter, post_limit FROM rss_feeds ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	subscriptions := []*rssFeed{}
+	for rows.Next() {
+		subscription := &rssFeed{}
+		if err = rows.Scan(&subscription.ID, &subscription.URL, &subscription.Title, &subscription.ChannelID, &subscription.Filter, &subscription.Limit); err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+// Feeds by number and title
+func feedChoices(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) ([]*discordgo.ApplicationCommandOptionChoice, error) {
+	subscriptions, err := rssFeeds()
+	if err != nil {
+		return nil, err
+	}
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, subscription := range subscriptions {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: fmt.Sprintf("#%d %s", subscription.ID, subscription.Title), Value: subscription.ID})
+	}
+	return choices, nil
+}
@@ -3,9 +3,8 @@ package commands
 import (
 	"context"
 
-	"github.com/spf13/viper"
-
 	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
 	"github.com/bwmarrin/discordgo"
 )
 
@@ -25,7 +24,7 @@ func version(ctx context.Context, s *discordgo.Session, i *discordgo.Interaction
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: viper.GetString("bot.version"),
+			Content: config.GetString("bot.version"),
 		}})
 	if err != nil {
 		log.WithContext(ctx).WithError(err).Error("Failed to send version message")
@@ -0,0 +1,485 @@
+package commands
+
+import (
+	"context"
+	"crypto/hmac"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/api"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/UCCNetsoc/discord-bot/embed"
+	"github.com/UCCNetsoc/discord-bot/minecraft"
+	"github.com/UCCNetsoc/discord-bot/store"
+	"github.com/bwmarrin/discordgo"
+)
+
+// MinecraftPollInterval is how often the game servers are polled, each poll a player appears in counts as this much playtime
+const MinecraftPollInterval = time.Minute
+
+// Stats over more days than this show weekly rather than daily active players
+const minecraftDailyDays = 14
+
+// RecordGameServers stores the player list from each successful poll
+func RecordGameServers(statuses []ServerStatus) {
+	now := time.Now().Truncate(time.Second)
+	for _, status := range statuses {
+		if status.Err != nil {
+			continue
+		}
+		res := status.Response
+		_, err := store.DB.Exec(
+			"INSERT INTO minecraft_polls(server, polled_at, online, max_players) VALUES($1, $2, $3, $4) ON CONFLICT DO NOTHING;",
+			status.Server.Name, now, res.Players.Online, res.Players.Max,
+		)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"server": status.Server.Name}).Error("Failed to record Minecraft poll")
+			continue
+		}
+		// Servers only send a sample of at most 12 players, so playtime is a lower bound on busy servers
+		for _, player := range res.Players.Sample {
+			_, err = store.DB.Exec(
+				"INSERT INTO minecraft_players(server, polled_at, player_id, name) VALUES($1, $2, $3, $4) ON CONFLICT DO NOTHING;",
+				status.Server.Name, now, player.ID, player.Name,
+			)
+			if err != nil {
+				log.WithError(err).WithFields(log.Fields{"server": status.Server.Name}).Error("Failed to record Minecraft player")
+			}
+		}
+	}
+
+	cutoff := now.AddDate(0, 0, -config.GetInt("minecraft.history_days"))
+	if _, err := store.DB.Exec("DELETE FROM minecraft_polls WHERE polled_at < $1;", cutoff); err != nil {
+		log.WithError(err).Error("Failed to remove old Minecraft polls")
+	}
+	if _, err := store.DB.Exec("DELETE FROM minecraft_players WHERE polled_at < $1;", cutoff); err != nil {
+		log.WithError(err).Error("Failed to remove old Minecraft players")
+	}
+}
+
+func minecraftCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	switch options[0].Name {
+	case "stats":
+		minecraftStats(ctx, s, i, optionMap(options[0].Options))
+	case "link":
+		minecraftLink(ctx, s, i, optionMap(options[0].Options))
+	case "verify":
+		minecraftVerify(ctx, s, i, optionMap(options[0].Options))
+	case "unlink":
+		minecraftUnlink(ctx, s, i)
+	case "notify":
+		minecraftNotify(ctx, s, i, optionMap(options[0].Options))
+	}
+}
+
+// Link a Discord account to the UUID of a Minecraft player, once they prove it's theirs
+// by entering a code whispered to them in game with /minecraft verify
+func minecraftLink(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, args map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	if config.GetString("minecraft.rcon.password") == "" {
+		InteractionResponseError(s, i, "minecraft.rcon.password must be configured to link accounts", false)
+		return
+	}
+	userID := i.Member.User.ID
+	username := strings.TrimSpace(args["username"].StringValue())
+	server, player, online := minecraftOnline(ctx, username)
+	if !online {
+		InteractionResponseError(s, i, fmt.Sprintf("%s isn't online, join one of our servers and try again", username), false)
+		return
+	}
+	if linked, err := minecraftLinkedElsewhere(userID, player.ID); err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to check Minecraft links")
+		InteractionResponseError(s, i, "Couldn't link your account", true)
+		return
+	} else if linked {
+		InteractionResponseError(s, i, fmt.Sprintf("%s is already linked to another Discord account", player.Name), false)
+		return
+	}
+
+	var sentAt time.Time
+	err := store.DB.QueryRow("SELECT sent_at FROM minecraft_link_codes WHERE user_id = $1;", userID).Scan(&sentAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.WithContext(ctx).WithError(err).Error("Failed to check pending Minecraft link")
+		InteractionResponseError(s, i, "Couldn't link your account", true)
+		return
+	}
+	// Stops the command being used to spam a player with whispers
+	if wait := time.Until(sentAt.Add(config.GetDuration("verify.resend_cooldown"))); wait > 0 {
+		InteractionResponseError(s, i, fmt.Sprintf("A code was sent recently, please wait %s before requesting another", wait.Round(time.Second)), false)
+		return
+	}
+
+	code, err := verifyCode()
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to generate Minecraft link code")
+		InteractionResponseError(s, i, "Couldn't link your account", true)
+		return
+	}
+	expiry := config.GetDuration("verify.code_expiry")
+	// Requesting a new code replaces the previous one and resets the attempts
+	_, err = store.DB.Exec(
+		`INSERT INTO minecraft_link_codes(user_id, player_id, name, code_hash, expires_at, attempts, sent_at) VALUES($1, $2, $3, $4, $5, 0, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET player_id = $2, name = $3, code_hash = $4, expires_at = $5, attempts = 0, sent_at = NOW();`,
+		userID, player.ID, player.Name, verifyHash(code), time.Now().Add(expiry),
+	)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to store Minecraft link code")
+		InteractionResponseError(s, i, "Couldn't link your account", true)
+		return
+	}
+
+	message := fmt.Sprintf("%s on Discord wants to link to your account. If that's you, run /minecraft verify with the code %s", i.Member.User.Username, code)
+	if err = minecraftWhisper(ctx, server, player.Name, message); err != nil {
+		log.WithContext(ctx).WithError(err).WithFields(log.Fields{"server": server.Name}).Error("Failed to whisper Minecraft link code")
+		store.DB.Exec("DELETE FROM minecraft_link_codes WHERE user_id = $1;", userID)
+		InteractionResponseError(s, i, "Couldn't send you a code in game", true)
+		return
+	}
+	minecraftRespond(ctx, s, i, fmt.Sprintf("A code has been whispered to %s on %s. Enter it with `/minecraft verify` within %s.", player.Name, server.Name, formatDuration(expiry)))
+}
+
+// Finish linking with the code whispered in game
+func minecraftVerify(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, args map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	userID := i.Member.User.ID
+	code := strings.TrimSpace(args["code"].StringValue())
+
+	var (
+		playerID, name, codeHash string
+		expiresAt                time.Time
+		attempts                 int
+	)
+	// Count the attempt before checking it so concurrent submissions can't exceed the limit
+	err := store.DB.QueryRow(
+		"UPDATE minecraft_link_codes SET attempts = attempts + 1 WHERE user_id = $1 RETURNING player_id, name, code_hash, expires_at, attempts;", userID,
+	).Scan(&playerID, &name, &codeHash, &expiresAt, &attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		InteractionResponseError(s, i, "You don't have a pending link, use `/minecraft link` first", false)
+		return
+	}
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to load Minecraft link code")
+		InteractionResponseError(s, i, "Couldn't check your code", true)
+		return
+	}
+	if time.Now().After(expiresAt) {
+		store.DB.Exec("DELETE FROM minecraft_link_codes WHERE user_id = $1;", userID)
+		InteractionResponseError(s, i, "That code has expired, use `/minecraft link` to get a new one", false)
+		return
+	}
+	maxAttempts := config.GetInt("verify.max_attempts")
+	if attempts > maxAttempts {
+		InteractionResponseError(s, i, "Too many incorrect attempts, use `/minecraft link` to get a new code once the cooldown has passed", false)
+		return
+	}
+	if !hmac.Equal([]byte(verifyHash(code)), []byte(codeHash)) {
+		InteractionResponseError(s, i, fmt.Sprintf("That code is incorrect, %d attempt(s) left", maxAttempts-attempts), false)
+		return
+	}
+
+	// The unique player ID stops one player being linked to many accounts, even if two codes were sent to them
+	_, err = store.DB.Exec(
+		"INSERT INTO minecraft_links(user_id, player_id, name) VALUES($1, $2, $3) ON CONFLICT (user_id) DO UPDATE SET player_id = $2, name = $3;",
+		userID, playerID, name,
+	)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to store Minecraft link")
+		InteractionResponseError(s, i, fmt.Sprintf("%s is already linked to another Discord account", name), false)
+		return
+	}
+	if _, err = store.DB.Exec("DELETE FROM minecraft_link_codes WHERE user_id = $1;", userID); err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to remove Minecraft link code")
+	}
+	minecraftRespond(ctx, s, i, fmt.Sprintf("Linked to %s. Use `/minecraft notify` to let people know when you join.", name))
+}
+
+// minecraftLinkedElsewhere checks if a player is linked to a Discord user other than userID
+func minecraftLinkedElsewhere(userID, playerID string) (bool, error) {
+	var linkedUser string
+	err := store.DB.QueryRow("SELECT user_id FROM minecraft_links WHERE player_id = $1;", playerID).Scan(&linkedUser)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil && linkedUser != userID, err
+}
+
+func minecraftUnlink(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	res, err := store.DB.Exec("DELETE FROM minecraft_links WHERE user_id = $1;", i.Member.User.ID)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to remove Minecraft link")
+		InteractionResponseError(s, i, "Couldn't unlink your account", true)
+		return
+	}
+	if removed, _ := res.RowsAffected(); removed == 0 {
+		InteractionResponseError(s, i, "Your account isn't linked", false)
+		return
+	}
+	minecraftRespond(ctx, s, i, "Unlinked your Minecraft account")
+}
+
+// Opt in or out of join messages
+func minecraftNotify(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, args map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	enabled := args["enabled"].BoolValue()
+	res, err := store.DB.Exec("UPDATE minecraft_links SET notify = $1 WHERE user_id = $2;", enabled, i.Member.User.ID)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to update join notifications")
+		InteractionResponseError(s, i, "Couldn't update your settings", true)
+		return
+	}
+	if updated, _ := res.RowsAffected(); updated == 0 {
+		InteractionResponseError(s, i, "Link your account with `/minecraft link` first", false)
+		return
+	}
+	if enabled {
+		minecraftRespond(ctx, s, i, fmt.Sprintf("Joins will be announced in <#%s>", config.GetString("minecraft.join_channel")))
+	} else {
+		minecraftRespond(ctx, s, i, "Joins will no longer be announced")
+	}
+}
+
+// Minecraft usernames, which are safe to put in a command
+var minecraftUsername = regexp.MustCompile(`^[A-Za-z0-9_]{1,16}$`)
+
+// minecraftOnline finds a player by name on the servers, with the server they're playing on
+func minecraftOnline(ctx context.Context, username string) (GameServer, minecraft.Player, bool) {
+	for _, status := range QueryGameServers(ctx) {
+		if status.Err != nil {
+			continue
+		}
+		for _, player := range status.Response.Players.Sample {
+			if strings.EqualFold(player.Name, username) && minecraftUsername.MatchString(player.Name) {
+				return status.Server, player, true
+			}
+		}
+	}
+	return GameServer{}, minecraft.Player{}, false
+}
+
+// minecraftWhisper sends a private message to a player, using RCON on the host the server is pinged on
+func minecraftWhisper(ctx context.Context, server GameServer, player, message string) error {
+	client := &minecraft.Client{Timeout: 5 * time.Second}
+	address, err := client.RCONAddress(ctx, server.Host, config.GetInt("minecraft.rcon.port"))
+	if err != nil {
+		return err
+	}
+	rcon, err := client.DialRCON(ctx, address, config.GetString("minecraft.rcon.password"))
+	if err != nil {
+		return err
+	}
+	defer rcon.Close()
+	output, err := rcon.Command(fmt.Sprintf("tell %s %s", player, message))
+	if err != nil {
+		return err
+	}
+	// The player left between the ping and the whisper
+	if strings.Contains(output, "No player was found") {
+		return errors.New(output)
+	}
+	return nil
+}
+
+// MinecraftLinks maps player UUIDs to the Discord users they're linked to
+func MinecraftLinks() (map[string]string, error) {
+	rows, err := store.DB.Query("SELECT player_id, user_id FROM minecraft_links")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	links := map[string]string{}
+	for rows.Next() {
+		var playerID, userID string
+		if err = rows.Scan(&playerID, &userID); err != nil {
+			return nil, err
+		}
+		links[playerID] = userID
+	}
+	return links, rows.Err()
+}
+
+// Players seen on each server in the previous poll, nil until the first poll
+var previousPlayers map[string]map[string]bool
+
+// AnnounceJoins posts in minecraft.join_channel when a linked player who opted in joins a server
+func AnnounceJoins(s *discordgo.Session, statuses []ServerStatus) {
+	current := map[string]map[string]bool{}
+	joined := map[string][]string{}
+	for _, status := range statuses {
+		if status.Err != nil {
+			// Keep the last known players so an unreachable poll doesn't look like everyone rejoining
+			if previousPlayers != nil {
+				current[status.Server.Name] = previousPlayers[status.Server.Name]
+			}
+			continue
+		}
+		players := map[string]bool{}
+		for _, player := range status.Response.Players.Sample {
+			players[player.ID] = true
+			if previousPlayers != nil && !previousPlayers[status.Server.Name][player.ID] {
+				joined[status.Server.Name] = append(joined[status.Server.Name], player.ID)
+			}
+		}
+		current[status.Server.Name] = players
+	}
+	previousPlayers = current
+
+	channelID := config.GetString("minecraft.join_channel")
+	if channelID == "" || len(joined) == 0 {
+		return
+	}
+	for server, playerIDs := range joined {
+		for _, playerID := range playerIDs {
+			var userID, name string
+			err := store.DB.QueryRow(
+				"SELECT user_id, name FROM minecraft_links WHERE player_id = $1 AND notify;", playerID,
+			).Scan(&userID, &name)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				log.WithError(err).Error("Failed to look up Minecraft link")
+				continue
+			}
+			_, err = s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+				Content: fmt.Sprintf("<@%s> (%s) joined %s", userID, name, server),
+				// Show the mention without pinging the player
+				AllowedMentions: &discordgo.MessageAllowedMentions{Parse: []discordgo.AllowedMentionType{}},
+			})
+			if err != nil {
+				log.WithError(err).Error("Failed to announce Minecraft join")
+			}
+		}
+	}
+}
+
+func minecraftRespond(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+// Show peak concurrency, daily or weekly active players and the playtime leaderboard for a server
+func minecraftStats(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, args map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	servers := GameServers()
+	server := servers[0]
+	if opt, ok := args["server"]; ok {
+		found := false
+		for _, candidate := range servers {
+			if strings.EqualFold(candidate.Name, opt.StringValue()) {
+				server, found = candidate, true
+			}
+		}
+		if !found {
+			InteractionResponseError(s, i, fmt.Sprintf("There's no server called %q", opt.StringValue()), false)
+			return
+		}
+	}
+	days := int64(7)
+	if opt, ok := args["days"]; ok {
+		days = opt.IntValue()
+	}
+	emb, err := minecraftStatsEmbed(server, int(days))
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to query Minecraft stats")
+		InteractionResponseError(s, i, "Couldn't get the stats", true)
+		return
+	}
+	emb.SetTitle(fmt.Sprintf("%s over the last %d days", server.Name, days))
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{emb.MessageEmbed},
+		},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+func minecraftStatsEmbed(server GameServer, days int) (*embed.Embed, error) {
+	emb := embed.NewEmbed()
+	since := time.Now().AddDate(0, 0, -days)
+
+	var (
+		peak     int
+		peakTime time.Time
+	)
+	err := store.DB.QueryRow(
+		"SELECT online, polled_at FROM minecraft_polls WHERE server = $1 AND polled_at >= $2 ORDER BY online DESC, polled_at DESC LIMIT 1;",
+		server.Name, since,
+	).Scan(&peak, &peakTime)
+	if errors.Is(err, sql.ErrNoRows) {
+		return emb.SetDescription("No polls have been recorded for this server yet"), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	emb.AddField("Peak players", fmt.Sprintf("%d at <t:%d:f>", peak, peakTime.Unix()))
+
+	// Longer ranges are summarised by week, as a row per day would overflow the field
+	bucket, label, layout := "day", "Daily active players", "Mon 02 Jan"
+	if days > minecraftDailyDays {
+		bucket, label, layout = "week", "Weekly active players", "Week of Mon 02 Jan"
+	}
+	rows, err := store.DB.Query(
+		`SELECT date_trunc($4, polled_at AT TIME ZONE $3)::date AS period, COUNT(DISTINCT player_id) FROM minecraft_players
+		WHERE server = $1 AND polled_at >= $2 GROUP BY period ORDER BY period DESC;`,
+		server.Name, since, api.CalendarLocation().String(), bucket,
+	)
+	if err != nil {
+		return nil, err
+	}
+	active := []string{}
+	for rows.Next() {
+		var (
+			period time.Time
+			count  int
+		)
+		if err = rows.Scan(&period, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		active = append(active, fmt.Sprintf("%s: %d", period.Format(layout), count))
+	}
+	rows.Close()
+	if len(active) == 0 {
+		active = append(active, "Nobody has played")
+	}
+	emb.AddField(label, strings.Join(active, "\n"))
+
+	// Players are grouped by ID so name changes don't split their playtime
+	rows, err = store.DB.Query(
+		`SELECT (array_agg(name ORDER BY polled_at DESC))[1], COUNT(*) FROM minecraft_players
+		WHERE server = $1 AND polled_at >= $2 GROUP BY player_id ORDER BY COUNT(*) DESC LIMIT 10;`,
+		server.Name, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	leaderboard := []string{}
+	for rows.Next() {
+		var (
+			name  string
+			polls int64
+		)
+		if err = rows.Scan(&name, &polls); err != nil {
+			return nil, err
+		}
+		leaderboard = append(leaderboard, fmt.Sprintf("%d. %s - %s", len(leaderboard)+1, name, formatDuration(time.Duration(polls)*MinecraftPollInterval)))
+	}
+	if len(leaderboard) > 0 {
+		emb.AddField("Playtime", strings.Join(leaderboard, "\n"))
+	}
+	return emb, rows.Err()
+}
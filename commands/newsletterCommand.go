@@ -0,0 +1,412 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/UCCNetsoc/discord-bot/emails"
+	"github.com/UCCNetsoc/discord-bot/embed"
+	"github.com/UCCNetsoc/discord-bot/store"
+	"github.com/bwmarrin/discordgo"
+)
+
+const newsletterEmailInput = "email"
+
+// newsletter is an announcement being turned into an email for the mailing list
+type newsletter struct {
+	ID        int64
+	Subject   string
+	ChannelID string
+	MessageID string
+	Status    string
+	SentAt    sql.NullTime // When the last email was sent, or sending started
+}
+
+// Preview an announcement as a newsletter before sending it to the mailing list
+func newsletterCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if config.GetString("api.public_url") == "" || config.GetString("newsletter.secret") == "" {
+		InteractionResponseError(s, i, "api.public_url and newsletter.secret must be configured to send newsletters", false)
+		return
+	}
+	args := optionMap(i.ApplicationCommandData().Options)
+	subject := "UCC Netsoc Newsletter"
+	if opt, ok := args["subject"]; ok {
+		subject = opt.StringValue()
+	}
+	channelID, messageID, err := parseMessageReference(args["message"].StringValue(), i.ChannelID)
+	if err != nil {
+		InteractionResponseError(s, i, err.Error(), false)
+		return
+	}
+	message, err := s.ChannelMessage(channelID, messageID)
+	if err != nil {
+		InteractionResponseError(s, i, "Couldn't find that message", false)
+		return
+	}
+
+	var id int64
+	err = store.DB.QueryRow(
+		"INSERT INTO newsletters(subject, channel_id, message_id, author_id, status) VALUES($1, $2, $3, $4, 'draft') RETURNING id;",
+		subject, channelID, messageID, i.Member.User.ID,
+	).Scan(&id)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to store newsletter draft")
+		InteractionResponseError(s, i, "Couldn't save the newsletter", true)
+		return
+	}
+
+	recipients, err := newsletterRecipients(id)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to get newsletter recipients")
+		InteractionResponseError(s, i, "Couldn't get the mailing list", true)
+		return
+	}
+	emb := embed.NewEmbed().
+		SetTitle(subject).
+		SetDescription(newsletterContent(s, message)).
+		SetFooter(fmt.Sprintf("Newsletter #%d will be sent to %d recipients", id, len(recipients)))
+	if img := newsletterImage(message); img != "" {
+		emb.SetImage(img)
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{emb.MessageEmbed},
+			Flags:  discordgo.MessageFlagsEphemeral,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.Button{Label: "Send test", Style: discordgo.SecondaryButton, CustomID: fmt.Sprintf("newsletter_test:%d", id)},
+						discordgo.Button{Label: "Send to mailing list", Style: discordgo.SuccessButton, CustomID: fmt.Sprintf("newsletter_send:%d", id)},
+						discordgo.Button{Label: "Cancel", Style: discordgo.DangerButton, CustomID: fmt.Sprintf("newsletter_cancel:%d", id)},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+// Ask where the test newsletter should go
+func newsletterTest(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, id := splitCustomID(i.MessageComponentData().CustomID)
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: "newsletter_test_send:" + id,
+			Title:    "Send a test newsletter",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID: newsletterEmailInput,
+							Label:    "Your verified email address",
+							Style:    discordgo.TextInputShort,
+							Required: true,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+func newsletterTestSend(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, id := splitCustomID(i.ModalSubmitData().CustomID)
+	letter, err := getNewsletter(id)
+	if err != nil {
+		InteractionResponseError(s, i, err.Error(), false)
+		return
+	}
+	to := strings.ToLower(strings.TrimSpace(modalValue(i.ModalSubmitData(), newsletterEmailInput)))
+	allowed, err := newsletterTester(i.Member.User.ID, to)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to check newsletter tester")
+		InteractionResponseError(s, i, "Couldn't check that address", true)
+		return
+	}
+	if !allowed {
+		InteractionResponseError(s, i, "Tests can only go to the address you verified with /verify, or one listed in newsletter.testers", false)
+		return
+	}
+	if _, err = sendNewsletter(s, letter, []string{to}, "[TEST] ", nil); err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to send test newsletter")
+		InteractionResponseError(s, i, err.Error(), true)
+		return
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("Test sent to %s", to),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+func newsletterSend(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, id := splitCustomID(i.MessageComponentData().CustomID)
+	letter, err := getNewsletter(id)
+	if err != nil {
+		InteractionResponseError(s, i, err.Error(), false)
+		return
+	}
+	res, err := store.DB.Exec(
+		"UPDATE newsletters SET status = 'sending', sent_at = NOW() WHERE id = $1 AND (status IN ('draft', 'failed') OR status = 'sending' AND sent_at < $2);",
+		letter.ID, newsletterStalled(),
+	)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to claim newsletter")
+		InteractionResponseError(s, i, "Couldn't send the newsletter", true)
+		return
+	}
+	if claimed, _ := res.RowsAffected(); claimed == 0 {
+		InteractionResponseError(s, i, "This newsletter is already being sent", false)
+		return
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+		// Nothing was sent, so it can be sent again straight away
+		if _, err = store.DB.Exec("UPDATE newsletters SET status = 'failed' WHERE id = $1 AND status = 'sending';", letter.ID); err != nil {
+			log.WithContext(ctx).WithError(err).Error("Failed to release newsletter")
+		}
+		return
+	}
+
+	// A retry after a failure only goes to those who didn't get it the first time.
+	// Each delivery is recorded as it's sent, so a retry after the bot stops part way doesn't email anyone twice.
+	recipients, err := newsletterRecipients(letter.ID)
+	delivered := []string{}
+	if err == nil {
+		delivered, err = sendNewsletter(s, letter, recipients, "", func(to string) error {
+			_, err := store.DB.Exec("INSERT INTO newsletter_deliveries(newsletter_id, email) VALUES($1, $2) ON CONFLICT DO NOTHING;", letter.ID, to)
+			if err == nil {
+				_, err = store.DB.Exec("UPDATE newsletters SET sent_at = NOW() WHERE id = $1;", letter.ID)
+			}
+			return err
+		})
+	}
+	status := "sent"
+	edit := &discordgo.WebhookEdit{Components: &[]discordgo.MessageComponent{}}
+	content := fmt.Sprintf("Newsletter #%d sent to %d recipients", letter.ID, len(delivered))
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to send newsletter")
+		// The buttons are kept so sending can be retried
+		status = "failed"
+		edit.Components = nil
+		content = fmt.Sprintf("Encountered error: %v\n%d of %d recipients were sent newsletter #%d, sending again only emails the rest", err, len(delivered), len(recipients), letter.ID)
+	}
+	_, err = store.DB.Exec(
+		"UPDATE newsletters SET status = $1, sent_count = (SELECT COUNT(*) FROM newsletter_deliveries WHERE newsletter_id = $2), sent_at = NOW() WHERE id = $2;",
+		status, letter.ID,
+	)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to update newsletter status")
+	}
+	edit.Content = &content
+	if _, err = s.InteractionResponseEdit(i.Interaction, edit); err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+func newsletterCancel(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	_, id := splitCustomID(i.MessageComponentData().CustomID)
+	res, err := store.DB.Exec(
+		"UPDATE newsletters SET status = 'cancelled' WHERE id = $1 AND (status IN ('draft', 'failed') OR status = 'sending' AND sent_at < $2);",
+		id, newsletterStalled(),
+	)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to cancel newsletter")
+		InteractionResponseError(s, i, "Couldn't cancel the newsletter", true)
+		return
+	}
+	if cancelled, _ := res.RowsAffected(); cancelled == 0 {
+		InteractionResponseError(s, i, "This newsletter is being sent or has already been sent", false)
+		return
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    "Newsletter cancelled",
+			Embeds:     []*discordgo.MessageEmbed{},
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+// sendNewsletter emails the announcement to each recipient with their own unsubscribe link,
+// returning who it was delivered to even when some failed.
+// sent is called after each delivery if it isn't nil, sending stops if it fails.
+func sendNewsletter(s *discordgo.Session, letter *newsletter, recipients []string, subjectPrefix string, sent func(to string) error) ([]string, error) {
+	delivered := []string{}
+	message, err := s.ChannelMessage(letter.ChannelID, letter.MessageID)
+	if err != nil {
+		return delivered, errors.New("couldn't fetch the announcement, was it deleted?")
+	}
+	mailer, err := emails.Backend()
+	if err != nil {
+		return delivered, err
+	}
+	content := newsletterContent(s, message)
+	image := newsletterImage(message)
+
+	failed := 0
+	for _, to := range recipients {
+		unsubscribe, err := emails.UnsubscribeURL(to)
+		if err != nil {
+			return delivered, err
+		}
+		rendered, err := emails.Render(emails.NewsletterTemplate, emails.NewsletterData{
+			Subject:        subjectPrefix + letter.Subject,
+			Content:        content,
+			ImageURL:       image,
+			UnsubscribeURL: unsubscribe,
+		})
+		if err != nil {
+			return delivered, err
+		}
+		err = mailer.Send(&emails.Message{
+			FromName: config.GetString("newsletter.from_name"),
+			From:     config.GetString("newsletter.from"),
+			To:       to,
+			Subject:  rendered.Subject,
+			Text:     rendered.Text,
+			HTML:     rendered.HTML,
+			Headers: map[string]string{
+				"List-Unsubscribe":      "<" + unsubscribe + ">",
+				"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+			},
+		})
+		if err != nil {
+			failed++
+			log.WithError(err).WithFields(log.Fields{"newsletter": letter.ID}).Error("Failed to send newsletter email")
+			continue
+		}
+		delivered = append(delivered, to)
+		if sent != nil {
+			if err = sent(to); err != nil {
+				return delivered, fmt.Errorf("couldn't record the email sent to %s: %w", to, err)
+			}
+		}
+	}
+	if failed > 0 {
+		return delivered, fmt.Errorf("%d of %d emails failed to send", failed, len(recipients))
+	}
+	return delivered, nil
+}
+
+// newsletterTester checks a test newsletter is going to the member's own verified address, or an allowed tester
+func newsletterTester(userID, address string) (bool, error) {
+	for _, tester := range strings.Split(config.GetString("newsletter.testers"), ",") {
+		if address != "" && strings.EqualFold(strings.TrimSpace(tester), address) {
+			return true, nil
+		}
+	}
+	var verifiedUser string
+	err := store.DB.QueryRow("SELECT user_id FROM verified_members WHERE email_hash = $1;", verifyHash(address)).Scan(&verifiedUser)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return verifiedUser == userID, err
+}
+
+// newsletterRecipients is the configured mailing list minus anyone who unsubscribed or was already sent the newsletter
+func newsletterRecipients(letterID int64) ([]string, error) {
+	unsubscribed, err := emails.Unsubscribed()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := store.DB.Query("SELECT email FROM newsletter_deliveries WHERE newsletter_id = $1;", letterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var email string
+		if err = rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		unsubscribed[email] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	recipients := []string{}
+	for _, email := range strings.Split(config.GetString("newsletter.recipients"), ",") {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email != "" && !unsubscribed[email] {
+			recipients = append(recipients, email)
+		}
+	}
+	return recipients, nil
+}
+
+func newsletterContent(s *discordgo.Session, message *discordgo.Message) string {
+	content, err := message.ContentWithMoreMentionsReplaced(s)
+	if err != nil {
+		content = message.ContentWithMentionsReplaced()
+	}
+	for _, symbol := range config.GetStringSlice("api.remove_symbols") {
+		content = strings.ReplaceAll(content, symbol, "")
+	}
+	return strings.TrimSpace(content)
+}
+
+func newsletterImage(message *discordgo.Message) string {
+	for _, attachment := range message.Attachments {
+		if attachment.Width > 0 {
+			return attachment.URL
+		}
+	}
+	return ""
+}
+
+func getNewsletter(id string) (*newsletter, error) {
+	letterID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid newsletter")
+	}
+	letter := &newsletter{}
+	err = store.DB.QueryRow(
+		"SELECT id, subject, channel_id, message_id, status, sent_at FROM newsletters WHERE id = $1;", letterID,
+	).Scan(&letter.ID, &letter.Subject, &letter.ChannelID, &letter.MessageID, &letter.Status, &letter.SentAt)
+	if err != nil {
+		return nil, errors.New("couldn't find that newsletter")
+	}
+	stalled := letter.Status == "sending" && letter.SentAt.Valid && letter.SentAt.Time.Before(newsletterStalled())
+	if letter.Status == "sending" && !stalled {
+		return nil, fmt.Errorf("newsletter #%d is being sent", letter.ID)
+	}
+	if letter.Status != "draft" && letter.Status != "failed" && !stalled {
+		return nil, fmt.Errorf("newsletter #%d has already been %s", letter.ID, letter.Status)
+	}
+	return letter, nil
+}
+
+// newsletterStalled is the time before which a newsletter still being sent is assumed to have stopped,
+// such as when the bot restarted part way through
+func newsletterStalled() time.Time {
+	return time.Now().Add(-config.GetDuration("newsletter.send_timeout"))
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/UCCNetsoc/discord-bot/config"
 	"github.com/UCCNetsoc/discord-bot/embed"
 	"github.com/bwmarrin/discordgo"
-	"github.com/spf13/viper"
 )
 
 func nitroAnnounce(s *discordgo.Session, m *discordgo.MessageCreate) {
@@ -16,12 +15,12 @@ func nitroAnnounce(s *discordgo.Session, m *discordgo.MessageCreate) {
 	em.SetTitle("New Nitro Boost 🎉")
 	em.SetDescription(fmt.Sprintf("Thank you %s for boosting the server!", m.Author.Mention()))
 	em.SetColor(0xdccb01)
-	channels := viper.Get("discord.channels").(*config.Channels)
+	channels := config.Get().Channels()
 	s.ChannelMessageSendEmbed(channels.PublicGeneral, em.MessageEmbed)
 }
 
 func boostersCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
-	servers := viper.Get("discord.servers").(*config.Servers)
+	servers := config.Get().Servers()
 	if err := s.RequestGuildMembers(servers.PublicServer, "", 0, "", false); err != nil {
 		log.WithContext(ctx).WithError(err).Error("Couldn't query server members")
 		return
@@ -3,147 +3,238 @@ package commands
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/UCCNetsoc/discord-bot/embed"
+	"github.com/UCCNetsoc/discord-bot/minecraft"
 	"github.com/bwmarrin/discordgo"
-	"github.com/spf13/viper"
+	"github.com/vincent-petithory/dataurl"
 )
 
-// https://wiki.vg/Server_List_Ping
-// 1B - VarInt - Size of packet (length excluding this byte)
-// 00 - VarInt - Packet ID (Handshaking)
-// E0 05 - VarInt - Protocol version (734)
-// 14 - VarInt - Server address string length
-// 6D 69 6E 65 63 72 61 66 74 2E 6E 65 74 73 6F 63 2E 63 6F 2E - String - minecraft.netsoc.co.
-// 04 AA - Unsigned Short - Port (1194)
-// 01 - VarInt - Next state (1 for status)
-var handshake = []byte{
-	0x1b, 0x00, 0xe0, 0x05, 0x14, 0x6d, 0x69, 0x6e, 0x65, 0x63, 0x72, 0x61, 0x66, 0x74,
-	0x2e, 0x6e, 0x65, 0x74, 0x73, 0x6f, 0x63, 0x2e, 0x63, 0x6f, 0x2e, 0x04, 0xaa, 0x01}
-
-// Response of Server List Ping query
-type Response struct {
-	Version     Version
-	Players     Players
-	Description Description
-	Favicon     string
+// GameServer is a Minecraft server players can join
+type GameServer struct {
+	Name string
+	Host string
 }
 
-// Version ...
-type Version struct {
-	Name     string
-	Protocol int
-}
+// Discord select menus have at most 25 options
+const maxServerOptions = 25
 
-// Players ...
-type Players struct {
-	Max    int
-	Online int
-	Sample []Player
+// ServerStatus is the result of querying a game server
+type ServerStatus struct {
+	Server   GameServer
+	Response *minecraft.Response
+	Err      error
 }
 
-// Player ...
-type Player struct {
-	Name string
-	ID   string
+// GameServers parses minecraft.servers, a comma separated list of name=host pairs.
+// When it isn't set, minecraft.host is the only server.
+func GameServers() []GameServer {
+	servers := []GameServer{}
+	for _, entry := range strings.Split(config.GetString("minecraft.servers"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, host, ok := strings.Cut(entry, "=")
+		if !ok {
+			name, host = serverName(entry), entry
+		}
+		servers = append(servers, GameServer{Name: strings.TrimSpace(name), Host: strings.TrimSpace(host)})
+	}
+	if len(servers) == 0 {
+		host := config.GetString("minecraft.host")
+		servers = append(servers, GameServer{Name: serverName(host), Host: host})
+	}
+	return servers
 }
 
-// Description ...
-type Description struct {
-	Text string
+func serverName(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
 }
 
-// Get the names of the users who are online on minecraft.netsoc.co
-func who(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
-	response, err := Query()
+// Show a server's players, MOTD and version, with a selector to switch between servers
+func onlineCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	servers := GameServers()
+	status := QueryGameServer(ctx, servers[0])
+	data := onlineResponse(status, servers, 0)
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
 	if err != nil {
-		InteractionResponseError(s, i, "Unable to check who is online at the moment. @sysadmins if issues persist", false)
-	} else {
-		var respMsg string
-		if len(response.Players.Sample) > 0 {
-			names := []string{}
-			for _, player := range response.Players.Sample {
-				names = append(names, player.Name)
-			}
-			respMsg = fmt.Sprintf("%d Players online right now:\n`%s`", len(names), strings.Join(names, "\n"))
-		} else {
-			respMsg = "There is no-one online right now"
-		}
-		err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: respMsg,
-			},
-		})
-		if err != nil {
-			log.WithContext(ctx).WithError(err)
-		}
+		log.WithContext(ctx).WithError(err)
 	}
 }
 
-// Query Server List Ping
-func Query() (Response, error) {
-	res := Response{}
-
-	conn, err := net.Dial("tcp", viper.GetString("minecraft.host"))
+func onlineSelect(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	values := i.MessageComponentData().Values
+	servers := GameServers()
+	// Options are the index of the server, as names needn't be unique
+	selected := -1
+	if len(values) > 0 {
+		if idx, err := strconv.Atoi(values[0]); err == nil && idx >= 0 && idx < len(servers) {
+			selected = idx
+		}
+	}
+	if selected == -1 {
+		InteractionResponseError(s, i, "That server no longer exists", false)
+		return
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
 	if err != nil {
-		return res, err
+		log.WithContext(ctx).WithError(err)
+		return
 	}
-	defer conn.Close()
-
-	// Handshake - https://wiki.vg/Server_List_Ping#Handshake
-	conn.SetDeadline(time.Now().Add(time.Second * 5))
-	_, err = conn.Write(handshake)
+	data := onlineResponse(QueryGameServer(ctx, servers[selected]), servers, selected)
+	// Interaction edits can't remove attachments, so the previous server's favicon is replaced with a message edit
+	_, err = s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:          i.Message.ID,
+		Channel:     i.ChannelID,
+		Embeds:      data.Embeds,
+		Components:  data.Components,
+		Files:       data.Files,
+		Attachments: &[]*discordgo.MessageAttachment{},
+	})
 	if err != nil {
-		return res, err
+		log.WithContext(ctx).WithError(err).Error("Failed to switch server")
 	}
+}
 
-	// Request - https://wiki.vg/Server_List_Ping#Request
-	_, err = conn.Write([]byte{0x01, 0x00})
+// onlineResponse shows the status of servers[selected], with a menu of the first maxServerOptions servers
+func onlineResponse(status ServerStatus, servers []GameServer, selected int) *discordgo.InteractionResponseData {
+	data := &discordgo.InteractionResponseData{}
+	emb := embed.NewEmbed().SetTitle(status.Server.Name)
+	if status.Err != nil {
+		emb.SetDescription(fmt.Sprintf("`%s` is unreachable right now. @sysadmins if issues persist", status.Server.Host))
+	} else {
+		res := status.Response
+		emb.SetDescription(res.Description.Text).
+			AddField("Players", fmt.Sprintf("%d/%d", res.Players.Online, res.Players.Max)).
+			AddField("Version", res.Version.Name).
+			AddField("Address", fmt.Sprintf("`%s`", status.Server.Host))
+		if res.Latency > 0 {
+			emb.AddField("Latency", res.Latency.Round(time.Millisecond).String())
+		}
+		if names := playerNames(res); len(names) > 0 {
+			emb.AddField("Online now", fmt.Sprintf("`%s`", strings.Join(names, "\n")))
+		}
+		if favicon, err := dataurl.DecodeString(res.Favicon); err == nil {
+			data.Files = []*discordgo.File{{Name: "favicon.png", ContentType: favicon.ContentType(), Reader: bytes.NewReader(favicon.Data)}}
+			emb.SetThumbnail("attachment://favicon.png")
+		}
+	}
+	data.Embeds = []*discordgo.MessageEmbed{emb.MessageEmbed}
+
+	if len(servers) > 1 {
+		options := []discordgo.SelectMenuOption{}
+		for idx, server := range servers[:min(len(servers), maxServerOptions)] {
+			options = append(options, discordgo.SelectMenuOption{
+				Label:   server.Name,
+				Value:   strconv.Itoa(idx),
+				Default: idx == selected,
+			})
+		}
+		data.Components = []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.SelectMenu{CustomID: "online_select", Placeholder: "Choose a server", Options: options},
+				},
+			},
+		}
+	}
+	return data
+}
 
+// Get the names of the users who are online on every server
+func who(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	statuses := QueryGameServers(ctx)
+	links, err := MinecraftLinks()
 	if err != nil {
-		return res, err
+		log.WithContext(ctx).WithError(err).Error("Failed to get Minecraft links")
 	}
-
-	// Calculate VarInt length of packet
-	var buf bytes.Buffer
-	pktLen := int64(0)
-	for shift := int64(0); ; shift++ {
-		_, err := io.CopyN(&buf, conn, 1)
-		if err != nil {
-			return res, err
+	lines := []string{}
+	reachable := false
+	for _, status := range statuses {
+		if status.Err != nil {
+			log.WithContext(ctx).WithError(status.Err).WithFields(log.Fields{"server": status.Server.Host}).Error("Failed to query Minecraft server")
+			continue
 		}
-		b := int64(buf.Next(1)[0])
-		value := b & 0b01111111
-		pktLen = (value << (shift * 7)) | pktLen
-		if b>>7 == 0 {
-			break
+		reachable = true
+		if players := status.Response.Players.Sample; len(players) > 0 {
+			names := []string{}
+			for _, player := range players {
+				if userID, ok := links[player.ID]; ok {
+					names = append(names, fmt.Sprintf("`%s` <@%s>", player.Name, userID))
+				} else {
+					names = append(names, fmt.Sprintf("`%s`", player.Name))
+				}
+			}
+			lines = append(lines, fmt.Sprintf("%d Players online on %s right now:\n%s", len(names), status.Server.Name, strings.Join(names, "\n")))
 		}
 	}
-
-	// Server response - https://wiki.vg/Server_List_Ping#Response
-	_, err = io.CopyN(&buf, conn, pktLen)
+	if !reachable {
+		InteractionResponseError(s, i, "Unable to check who is online at the moment. @sysadmins if issues persist", false)
+		return
+	}
+	respMsg := strings.Join(lines, "\n")
+	if len(lines) == 0 {
+		respMsg = "There is no-one online right now"
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:         respMsg,
+			AllowedMentions: &discordgo.MessageAllowedMentions{Parse: []discordgo.AllowedMentionType{}},
+		},
+	})
 	if err != nil {
-		return res, err
+		log.WithContext(ctx).WithError(err)
 	}
+}
 
-	// Packet starts with two VarInts; Packet ID and Data Length
-	// https://wiki.vg/Protocol#VarInt_and_VarLong
-	for skip := 0; skip < 2; skip++ {
-		for buf.Next(1)[0]>>7 != 0 {
-		}
+func playerNames(res *minecraft.Response) []string {
+	names := []string{}
+	for _, player := range res.Players.Sample {
+		names = append(names, player.Name)
 	}
+	return names
+}
 
-	err = json.Unmarshal(buf.Bytes(), &res)
-	if err != nil {
-		return res, err
+// QueryGameServers queries every configured server concurrently
+func QueryGameServers(ctx context.Context) []ServerStatus {
+	servers := GameServers()
+	statuses := make([]ServerStatus, len(servers))
+	wg := sync.WaitGroup{}
+	for idx, server := range servers {
+		wg.Add(1)
+		go func(idx int, server GameServer) {
+			defer wg.Done()
+			statuses[idx] = QueryGameServer(ctx, server)
+		}(idx, server)
 	}
+	wg.Wait()
+	return statuses
+}
 
-	return res, nil
+// QueryGameServer pings a server with the configured protocol version
+func QueryGameServer(ctx context.Context, server GameServer) ServerStatus {
+	client := &minecraft.Client{
+		Protocol: int32(config.GetInt("minecraft.protocol")),
+		Timeout:  5 * time.Second,
+	}
+	res, err := client.Query(ctx, server.Host)
+	return ServerStatus{Server: server, Response: res, Err: err}
 }
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestOnlineResponseMenu(t *testing.T) {
+	servers := []GameServer{}
+	for n := 0; n < 30; n++ {
+		servers = append(servers, GameServer{Name: fmt.Sprintf("Server %d", n), Host: fmt.Sprintf("mc%d.netsoc.co", n)})
+	}
+	// The same name on different hosts
+	servers[3].Name = servers[2].Name
+
+	data := onlineResponse(ServerStatus{Server: servers[3], Err: errors.New("unreachable")}, servers, 3)
+	menu := data.Components[0].(discordgo.ActionsRow).Components[0].(discordgo.SelectMenu)
+	if len(menu.Options) != maxServerOptions {
+		t.Fatalf("%d options for %d servers", len(menu.Options), len(servers))
+	}
+	values := map[string]bool{}
+	defaults := []int{}
+	for idx, option := range menu.Options {
+		if values[option.Value] {
+			t.Errorf("option %d repeats the value %s", idx, option.Value)
+		}
+		values[option.Value] = true
+		if option.Label != servers[idx].Name {
+			t.Errorf("option %d labelled %s", idx, option.Label)
+		}
+		if option.Default {
+			defaults = append(defaults, idx)
+		}
+	}
+	if len(defaults) != 1 || defaults[0] != 3 || menu.Options[3].Value != "3" {
+		t.Errorf("selected %v", defaults)
+	}
+
+	if data = onlineResponse(ServerStatus{Server: servers[0], Err: errors.New("unreachable")}, servers[:1], 0); len(data.Components) != 0 {
+		t.Error("menu shown for a single server")
+	}
+}
@@ -4,11 +4,16 @@ import (
 	"fmt"
 
 	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/UCCNetsoc/discord-bot/corona"
 	"github.com/bwmarrin/discordgo"
-	"github.com/spf13/viper"
 )
 
 var (
+	minecraftMinDays float64 = 1
+	feedsMinLimit    float64 = 1
+	coronaMinDays    float64 = 1
+
 	publicCommands = []discordgo.ApplicationCommand{
 		{
 			Name:        "ping",
@@ -63,10 +68,11 @@ var (
 					},
 				},
 				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "domain",
-					Description: "Domain name",
-					Required:    true,
+					Type:         discordgo.ApplicationCommandOptionString,
+					Name:         "domain",
+					Description:  "Domain name",
+					Required:     true,
+					Autocomplete: true,
 				},
 				{
 					Type:        discordgo.ApplicationCommandOptionString,
@@ -81,16 +87,60 @@ var (
 			Description: "Gives current stats on corona case numbers",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "country",
-					Description: "Query by country",
-					Required:    false,
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "stats",
+					Description: "Cases and deaths for a country, along with global stats",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         "country",
+							Description:  "Query by country",
+							Required:     false,
+							Autocomplete: true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "days",
+							Description: "Compare with the numbers this many days ago",
+							Required:    false,
+							MinValue:    &coronaMinDays,
+							MaxValue:    365,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "average",
+							Description: "Show 7-day rolling averages",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "per100k",
+							Description: "Show rates per 100,000 people",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "compare",
+					Description: "Compare cases and deaths per 100,000 people in up to five countries",
+					Options:     coronaCompareOptions(),
 				},
 			},
 		},
 		{
 			Name:        "vaccines",
 			Description: "Gives current stats on the COVID-19 vaccine rollout",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "days",
+					Description: "Compare with the rollout this many days ago, rather than the previous update",
+					Required:    false,
+					MinValue:    &coronaMinDays,
+					MaxValue:    365,
+				},
+			},
 		},
 		{
 			Name:        "boosters",
@@ -102,15 +152,102 @@ var (
 		},
 		{
 			Name:        "online",
-			Description: "See how many people are online in minecraft.netsoc.co",
+			Description: "See who is online, the MOTD and version of our game servers",
 		},
 		{
 			Name:        "who",
-			Description: "See how many people are online in minecraft.netsoc.co",
+			Description: "See who is online on our game servers",
+		},
+		{
+			Name:        "minecraft",
+			Description: "Minecraft server statistics and account linking",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "stats",
+					Description: "Peak players, daily or weekly active players and the playtime leaderboard",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "server",
+							Description: "Server name, the first server if not given",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "days",
+							Description: "How many days back to look, 7 by default",
+							Required:    false,
+							MinValue:    &minecraftMinDays,
+							MaxValue:    90,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "link",
+					Description: "Link your Discord account to your Minecraft username, you'll be sent a code in game",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "username",
+							Description: "Your Minecraft username, you must be playing on one of our servers",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "verify",
+					Description: "Finish linking your Minecraft username with the code sent in game",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "code",
+							Description: "The code whispered to you in game",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "unlink",
+					Description: "Unlink your Minecraft username",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "notify",
+					Description: "Announce when you join one of our servers",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "enabled",
+							Description: "Whether to announce your joins",
+							Required:    true,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "verify",
+			Description: "Verify your UCC email address to get the verified role",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "email",
+					Description: "Your UCC email address",
+					Required:    true,
+				},
+			},
 		},
 	}
 
 	committeeCommands = []discordgo.ApplicationCommand{
+		{
+			Name: "Cross-post announcement",
+			Type: discordgo.MessageApplicationCommand,
+		},
 		{
 			Name:        "up",
 			Description: "Check the status of various Netsoc hosted websites",
@@ -142,22 +279,163 @@ var (
 					Type:        discordgo.ApplicationCommandOptionSubCommand,
 					Name:        "delete",
 					Description: "Delete a shortened URL",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         "shortened-slug",
+							Description:  "Shortened Slug",
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "List all shortened URL's",
+				},
+			},
+		},
+		{
+			Name:        "announce",
+			Description: "Schedule announcements for the public server",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "schedule",
+					Description: "Schedule an announcement, opens an editor unless a message is given",
 					Options: []*discordgo.ApplicationCommandOption{
 						{
 							Type:        discordgo.ApplicationCommandOptionString,
-							Name:        "shortened-slug",
-							Description: "Shortened Slug",
+							Name:        "time",
+							Description: "When to post, e.g. 2h30m or 2006-01-02 15:04 (Irish time)",
 							Required:    true,
 						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "message",
+							Description: "Link or ID of a message to post, attachments included",
+							Required:    false,
+						},
 					},
 				},
 				{
 					Type:        discordgo.ApplicationCommandOptionSubCommand,
 					Name:        "list",
-					Description: "List all shortened URL's",
+					Description: "List pending announcements",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "edit",
+					Description: "Edit a pending announcement, opens an editor unless a new time is given",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "id",
+							Description: "Announcement number from /announce list",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "time",
+							Description: "New time to post",
+							Required:    false,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "cancel",
+					Description: "Cancel a pending announcement",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "id",
+							Description: "Announcement number from /announce list",
+							Required:    true,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "newsletter",
+			Description: "Email an announcement to the mailing list",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "message",
+					Description: "Link or ID of the announcement",
+					Required:    true,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "subject",
+					Description: "Email subject",
+					Required:    false,
+				},
+			},
+		},
+		{
+			Name:        "feeds",
+			Description: "Post new entries from RSS and Atom feeds to channels",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "add",
+					Description: "Subscribe a channel to a feed",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "url",
+							Description: "RSS or Atom feed URL",
+							Required:    true,
+						},
+						{
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							Name:         "channel",
+							Description:  "Channel to post new entries in",
+							Required:     true,
+							ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "filter",
+							Description: "Only post entries whose title or summary match this regular expression",
+							Required:    false,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "limit",
+							Description: "Most entries posted per poll, the rest wait for the next poll",
+							Required:    false,
+							MinValue:    &feedsMinLimit,
+							MaxValue:    10,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "list",
+					Description: "List feed subscriptions",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "remove",
+					Description: "Unsubscribe from a feed",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionInteger,
+							Name:         "id",
+							Description:  "Feed number from /feeds list",
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
 				},
 			},
-		}, {
+		},
+		{
 			Name: "upcoming",
 			Options: []*discordgo.ApplicationCommandOption{
 				{
@@ -186,19 +464,34 @@ func RegisterCommands(s *discordgo.Session) {
 	/* TODO: Edit permissions for public commands, currently not supported by discordGo, might need to manually send a bulk edit request
 	(https://discord.com/developers/docs/interactions/application-commands#batch-edit-application-command-permissions)*/
 	for _, command := range publicCommands {
-		_, err := s.ApplicationCommandCreate(s.State.User.ID, viper.GetString("discord.public.server"), &command)
+		_, err := s.ApplicationCommandCreate(s.State.User.ID, config.GetString("discord.public.server"), &command)
 		if err != nil {
 			log.WithError(err).Error(fmt.Sprintf("Cannot create slash command %q: %v", command.Name, err))
 		}
-		_, err = s.ApplicationCommandCreate(s.State.User.ID, viper.GetString("discord.committee.server"), &command)
+		_, err = s.ApplicationCommandCreate(s.State.User.ID, config.GetString("discord.committee.server"), &command)
 		if err != nil {
 			log.WithError(err).Error(fmt.Sprintf("Cannot create slash command %q: %v", command.Name, err))
 		}
 	}
 	for _, command := range committeeCommands {
-		_, err := s.ApplicationCommandCreate(s.State.User.ID, viper.GetString("discord.committee.server"), &command)
+		_, err := s.ApplicationCommandCreate(s.State.User.ID, config.GetString("discord.committee.server"), &command)
 		if err != nil {
 			log.WithError(err).Error(fmt.Sprintf("Cannot create slash command %q: %v", command.Name, err))
 		}
 	}
 }
+
+// Two countries are needed to compare, up to corona.MaxCompare
+func coronaCompareOptions() []*discordgo.ApplicationCommandOption {
+	options := []*discordgo.ApplicationCommandOption{}
+	for n := 1; n <= corona.MaxCompare; n++ {
+		options = append(options, &discordgo.ApplicationCommandOption{
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         fmt.Sprintf("country%d", n),
+			Description:  "Country to compare",
+			Required:     n <= 2,
+			Autocomplete: true,
+		})
+	}
+	return options
+}
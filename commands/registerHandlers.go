@@ -3,14 +3,17 @@ package commands
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/corona"
 	"github.com/UCCNetsoc/discord-bot/prometheus"
 	"github.com/bwmarrin/discordgo"
 )
 
 var (
-	commandsMap = make(map[string]func(context.Context, *discordgo.Session, *discordgo.InteractionCreate))
+	commandsMap     = make(map[string]func(context.Context, *discordgo.Session, *discordgo.InteractionCreate))
+	autocompleteMap = make(map[string]choicesFunc)
 )
 
 type commandFunc func(context.Context, *discordgo.Session, *discordgo.InteractionCreate)
@@ -19,10 +22,16 @@ func command(name string, function commandFunc) {
 	commandsMap[name] = function
 }
 
+// autocomplete suggests values for a command's option marked with Autocomplete
+func autocomplete(name, option string, function choicesFunc) {
+	autocompleteMap[name+" "+option] = function
+}
+
 // Register command handlers
 func RegisterHandlers(s *discordgo.Session) {
 	// TODO: Clean up repetition in registering commands and registering command handlers (e.g declaring command names both here and in the registerCommands.go)
 	RegisterCommands(s)
+	createTables()
 	// Public commands
 	command("ping", ping)
 	command("version", version)
@@ -32,14 +41,45 @@ func RegisterHandlers(s *discordgo.Session) {
 	command("vaccines", vaccines)
 	command("boosters", boostersCommand)
 	command("upcoming", upcomingEvent)
-	command("online", who)
+	command("online", onlineCommand)
 	command("who", who)
+	command("verify", verifyCommand)
+	command("minecraft", minecraftCommand)
 	// Committee commands
 	command("up", checkUpCommand)
 	command("shorten", shortenCommand)
+	command("Cross-post announcement", crosspostCommand)
+	command("announce", announceCommand)
+	command("newsletter", newsletterCommand)
+	command("feeds", feedsCommand)
+	// Message components
+	command("crosspost_approve", crosspostApprove)
+	command("crosspost_discard", crosspostDiscard)
+	command("newsletter_test", newsletterTest)
+	command("newsletter_send", newsletterSend)
+	command("newsletter_cancel", newsletterCancel)
+	command("verify_code", verifyCodeButton)
+	command("online_select", onlineSelect)
+	// Modals
+	command("announce_schedule", announceScheduleSubmit)
+	command("announce_edit", announceEditSubmit)
+	command("newsletter_test_send", newsletterTestSend)
+	command("verify_submit", verifySubmit)
+	// Autocompletion
+	autocomplete("corona", "country", coronaCountryChoices)
+	for n := 1; n <= corona.MaxCompare; n++ {
+		autocomplete("corona", fmt.Sprintf("country%d", n), coronaCompareChoices)
+	}
+	autocomplete("dig", "domain", digDomainChoices)
+	autocomplete("shorten", "shortened-slug", shortenSlugChoices)
+	autocomplete("feeds", "id", feedChoices)
 
 	// Setup Interaction Handlers
 	s.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+			callAutocomplete(s, i)
+			return
+		}
 		callCommand(s, i)
 	})
 
@@ -77,10 +117,20 @@ func extractCommandContent(i *discordgo.InteractionCreate) (commandAuthor *disco
 			}
 		}
 	case discordgo.InteractionMessageComponent:
-		commandName = i.MessageComponentData().CustomID
+		var arg string
+		commandName, arg = splitCustomID(i.MessageComponentData().CustomID)
+		if arg != "" {
+			commandBody = append(commandBody, fmt.Sprintf("id : %s", arg))
+		}
 		for idx, value := range i.MessageComponentData().Values {
 			commandBody = append(commandBody, fmt.Sprintf("value %d : %s", idx, value))
 		}
+	case discordgo.InteractionModalSubmit:
+		var arg string
+		commandName, arg = splitCustomID(i.ModalSubmitData().CustomID)
+		if arg != "" {
+			commandBody = append(commandBody, fmt.Sprintf("id : %s", arg))
+		}
 	}
 	return
 }
@@ -111,6 +161,24 @@ func callCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	}
 }
 
+// Autocompletion happens on every keystroke, so it isn't logged like commands
+func callAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	name := i.ApplicationCommandData().Name
+	for _, option := range focusedOptions(i.ApplicationCommandData().Options) {
+		function, ok := autocompleteMap[name+" "+option.Name]
+		if !ok {
+			continue
+		}
+		ctx := context.WithValue(context.Background(), log.Key, log.Fields{
+			"guild_id": i.GuildID,
+			"command":  name,
+			"option":   option.Name,
+		})
+		respondChoices(ctx, s, i, function, fmt.Sprintf("%v", option.Value))
+		return
+	}
+}
+
 func memberLeave(s *discordgo.Session, m *discordgo.GuildMemberRemove) {
 	prometheus.MemberJoinLeave()
 }
@@ -121,3 +189,12 @@ func messageDelete(s *discordgo.Session, m *discordgo.MessageDelete) {
 		prometheus.MessageDelete(m.GuildID, m.ChannelID)
 	}
 }
+
+// Component custom IDs are of the form name:argument so one handler can serve many messages
+func splitCustomID(customID string) (name string, arg string) {
+	parts := strings.SplitN(customID, ":", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return parts[0], ""
+}
@@ -8,19 +8,28 @@ import (
 	"io/ioutil"
 	"net/http"
 	"regexp"
+	"time"
 
 	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
 	"github.com/UCCNetsoc/discord-bot/embed"
 	"github.com/bwmarrin/discordgo"
-	"github.com/spf13/viper"
+	"github.com/patrickmn/go-cache"
 )
 
+// Links are cached briefly for autocompletion, which happens on every keystroke
+var shortenCache = cache.New(time.Minute, time.Minute)
+
 type Link struct {
 	Slug string `json:"slug"`
 	URL  string `json:"url"`
 }
 
 func shortenCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if config.Get().Shorten.Host == "" {
+		InteractionResponseError(s, i, "The URL shortener isn't set up", false)
+		return
+	}
 	topLevelArgs := i.ApplicationCommandData().Options[0]
 	subLevelArgs := topLevelArgs.Options
 	var method string
@@ -53,7 +62,7 @@ func shortenCommand(ctx context.Context, s *discordgo.Session, i *discordgo.Inte
 			return
 		}
 
-		req, err := http.NewRequest(method, viper.GetString("shorten.host"), bytes.NewBuffer((encoded)))
+		req, err := http.NewRequest(method, config.GetString("shorten.host"), bytes.NewBuffer((encoded)))
 		if err != nil {
 			log.WithContext(ctx).WithError(err).Error("Failed to make request object")
 			InteractionResponseError(s, i, "Could not create request", true)
@@ -61,7 +70,7 @@ func shortenCommand(ctx context.Context, s *discordgo.Session, i *discordgo.Inte
 		}
 
 		req.Header.Set("Content-Type", "application/json")
-		req.SetBasicAuth(viper.GetString("shorten.username"), viper.GetString("shorten.password"))
+		req.SetBasicAuth(config.GetString("shorten.username"), config.GetString("shorten.password"))
 
 		client := http.Client{}
 		resp, err := client.Do(req)
@@ -73,6 +82,7 @@ func shortenCommand(ctx context.Context, s *discordgo.Session, i *discordgo.Inte
 
 		switch resp.StatusCode {
 		case http.StatusCreated:
+			shortenCache.Delete("links")
 			bd, err := ioutil.ReadAll(resp.Body)
 			if err != nil {
 				log.WithContext(ctx).WithError(err)
@@ -90,7 +100,7 @@ func shortenCommand(ctx context.Context, s *discordgo.Session, i *discordgo.Inte
 
 			emb := embed.NewEmbed().SetTitle(link.Slug)
 			emb.AddField("Original URL", link.URL)
-			emb.AddField("Shortened URL", viper.GetString("shorten.public.host")+"/"+link.Slug)
+			emb.AddField("Shortened URL", config.GetString("shorten.public.host")+"/"+link.Slug)
 
 			err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 				Type: discordgo.InteractionResponseChannelMessageWithSource,
@@ -112,7 +122,7 @@ func shortenCommand(ctx context.Context, s *discordgo.Session, i *discordgo.Inte
 			log.WithContext(ctx).WithFields(log.Fields{
 				"method":       method,
 				"originalUrl":  originalURL,
-				"shortenedUrl": viper.GetString("shorten.public.host") + "/" + shortenedURL,
+				"shortenedUrl": config.GetString("shorten.public.host") + "/" + shortenedURL,
 				"responseCode": resp.Status,
 			}).Error("Error while trying to shorten URL!")
 			InteractionResponseError(s, i, resp.Status, true)
@@ -122,14 +132,14 @@ func shortenCommand(ctx context.Context, s *discordgo.Session, i *discordgo.Inte
 
 	case "delete":
 		method = "DELETE"
-		req, err := http.NewRequest(method, fmt.Sprintf("%s/%v", viper.GetString("shorten.host"), subLevelArgs[0].Value), nil)
+		req, err := http.NewRequest(method, fmt.Sprintf("%s/%v", config.GetString("shorten.host"), subLevelArgs[0].Value), nil)
 		if err != nil {
 			log.WithContext(ctx).WithError(err).Error("Failed to make request object")
 			InteractionResponseError(s, i, "Could not create request", true)
 			return
 		}
 
-		req.SetBasicAuth(viper.GetString("shorten.username"), viper.GetString("shorten.password"))
+		req.SetBasicAuth(config.GetString("shorten.username"), config.GetString("shorten.password"))
 		client := http.Client{}
 		resp, err := client.Do(req)
 		if err != nil {
@@ -140,6 +150,7 @@ func shortenCommand(ctx context.Context, s *discordgo.Session, i *discordgo.Inte
 
 		switch resp.StatusCode {
 		case http.StatusAccepted:
+			shortenCache.Delete("links")
 			err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 				Type: discordgo.InteractionResponseChannelMessageWithSource,
 				Data: &discordgo.InteractionResponseData{
@@ -161,28 +172,10 @@ func shortenCommand(ctx context.Context, s *discordgo.Session, i *discordgo.Inte
 		}
 
 	default:
-		req, err := http.NewRequest("GET", viper.GetString("shorten.host")+"/links", nil)
+		data, err := shortenLinks(ctx)
 		if err != nil {
-			log.WithContext(ctx).WithError(err).Error("Failed to make request object")
-			InteractionResponseError(s, i, "Could not create request", true)
-			return
-		}
-
-		req.SetBasicAuth(viper.GetString("shorten.username"), viper.GetString("shorten.password"))
-		client := http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			log.WithContext(ctx).WithError(err).Error("Error communicating with server")
-			InteractionResponseError(s, i, "Could not reach URL shortening server", true)
-			return
-		}
-
-		data := []Link{}
-		err = json.NewDecoder(resp.Body).Decode(&data)
-
-		if err != nil {
-			log.WithContext(ctx).WithError(err).Error("Failed to unmarshall json data")
-			InteractionResponseError(s, i, "Could not parse data", true)
+			log.WithContext(ctx).WithError(err).Error("Failed to list shortened links")
+			InteractionResponseError(s, i, "Could not list the shortened links", true)
 			return
 		}
 
@@ -203,3 +196,44 @@ func shortenCommand(ctx context.Context, s *discordgo.Session, i *discordgo.Inte
 		}
 	}
 }
+
+func shortenLinks(ctx context.Context) ([]Link, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", config.GetString("shorten.host")+"/links", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(config.GetString("shorten.username"), config.GetString("shorten.password"))
+	client := http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing links returned %s", resp.Status)
+	}
+	data := []Link{}
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	return data, err
+}
+
+// Slugs of the shortened links, showing where they lead
+func shortenSlugChoices(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) ([]*discordgo.ApplicationCommandOptionChoice, error) {
+	if config.Get().Shorten.Host == "" {
+		return nil, nil
+	}
+	links, ok := shortenCache.Get("links")
+	if !ok {
+		fetched, err := shortenLinks(ctx)
+		if err != nil {
+			return nil, err
+		}
+		shortenCache.SetDefault("links", fetched)
+		links = fetched
+	}
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, link := range links.([]Link) {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: fmt.Sprintf("%s → %s", link.Slug, link.URL), Value: link.Slug})
+	}
+	return choices, nil
+}
@@ -8,11 +8,11 @@ import (
 	"time"
 
 	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
 	"github.com/UCCNetsoc/discord-bot/embed"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/matryer/try"
-	"github.com/spf13/viper"
 )
 
 type statusCheck struct {
@@ -24,7 +24,7 @@ type statusCheck struct {
 
 // Up command to check the status of various websites hosted on Netsoc servers
 func checkUpCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
-	sites := strings.Split(viper.GetString("netsoc.sites"), ",")
+	sites := strings.Split(config.GetString("netsoc.sites"), ",")
 	// Run on a separate goroutine to not block bot
 	checkStatuses(s, i, sites)
 }
@@ -96,3 +96,18 @@ func checkStatus(site string, retryCount int, statuses chan statusCheck) {
 	})
 	statuses <- statusCheck{site, timeTaken, err == nil, err}
 }
+
+// SitesUp checks netsoc.sites, returning how many of them are up
+func SitesUp() (up int, total int) {
+	sites := strings.Split(config.GetString("netsoc.sites"), ",")
+	statuses := make(chan statusCheck)
+	for _, site := range sites {
+		go checkStatus(site, 1, statuses)
+	}
+	for range sites {
+		if (<-statuses).Success {
+			up++
+		}
+	}
+	return up, len(sites)
+}
@@ -2,8 +2,15 @@ package commands
 
 import (
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
 
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/corona"
+	"github.com/UCCNetsoc/discord-bot/emails"
 	"github.com/UCCNetsoc/discord-bot/embed"
+	"github.com/UCCNetsoc/discord-bot/store"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -26,3 +33,92 @@ func InteractionResponseError(s *discordgo.Session, i *discordgo.InteractionCrea
 		},
 	})
 }
+
+// createTables for commands which keep state between restarts
+func createTables() {
+	err := store.CreateTables(
+		"CREATE TABLE IF NOT EXISTS crossposts(id SERIAL PRIMARY KEY, channel_id VARCHAR(32) NOT NULL, message_id VARCHAR(32) NOT NULL, author_id VARCHAR(32) NOT NULL, status VARCHAR(16) NOT NULL, approved_by VARCHAR(32), published_id VARCHAR(32), created_at TIMESTAMPTZ NOT NULL DEFAULT NOW());",
+		"CREATE TABLE IF NOT EXISTS newsletters(id SERIAL PRIMARY KEY, subject TEXT NOT NULL, channel_id VARCHAR(32) NOT NULL, message_id VARCHAR(32) NOT NULL, author_id VARCHAR(32) NOT NULL, status VARCHAR(16) NOT NULL, sent_count INT NOT NULL DEFAULT 0, sent_at TIMESTAMPTZ);",
+		"CREATE TABLE IF NOT EXISTS newsletter_deliveries(newsletter_id INT NOT NULL REFERENCES newsletters(id), email VARCHAR(320) NOT NULL, sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), PRIMARY KEY (newsletter_id, email));",
+		"CREATE TABLE IF NOT EXISTS scheduled_announcements(id SERIAL PRIMARY KEY, content TEXT NOT NULL, source_channel VARCHAR(32), source_message VARCHAR(32), author_id VARCHAR(32) NOT NULL, post_at TIMESTAMPTZ NOT NULL, status VARCHAR(16) NOT NULL, attempts INT NOT NULL DEFAULT 0, posted_id VARCHAR(32));",
+		"CREATE TABLE IF NOT EXISTS verifications(user_id VARCHAR(32) PRIMARY KEY, email_hash CHAR(64) NOT NULL, code_hash CHAR(64) NOT NULL, expires_at TIMESTAMPTZ NOT NULL, attempts INT NOT NULL DEFAULT 0, sent_at TIMESTAMPTZ NOT NULL);",
+		"CREATE TABLE IF NOT EXISTS minecraft_polls(server VARCHAR(64) NOT NULL, polled_at TIMESTAMPTZ NOT NULL, online INT NOT NULL, max_players INT NOT NULL, PRIMARY KEY (server, polled_at));",
+		"CREATE TABLE IF NOT EXISTS minecraft_players(server VARCHAR(64) NOT NULL, polled_at TIMESTAMPTZ NOT NULL, player_id VARCHAR(36) NOT NULL, name VARCHAR(16) NOT NULL, PRIMARY KEY (server, polled_at, player_id));",
+		"CREATE TABLE IF NOT EXISTS minecraft_links(user_id VARCHAR(32) PRIMARY KEY, player_id VARCHAR(36) NOT NULL UNIQUE, name VARCHAR(16) NOT NULL, notify BOOLEAN NOT NULL DEFAULT FALSE);",
+		"CREATE TABLE IF NOT EXISTS minecraft_link_codes(user_id VARCHAR(32) PRIMARY KEY, player_id VARCHAR(36) NOT NULL, name VARCHAR(16) NOT NULL, code_hash CHAR(64) NOT NULL, expires_at TIMESTAMPTZ NOT NULL, attempts INT NOT NULL DEFAULT 0, sent_at TIMESTAMPTZ NOT NULL);",
+		"CREATE TABLE IF NOT EXISTS verified_members(email_hash CHAR(64) PRIMARY KEY, user_id VARCHAR(32) NOT NULL UNIQUE, verified_at TIMESTAMPTZ NOT NULL DEFAULT NOW());",
+	)
+	if err == nil {
+		err = emails.CreateTables()
+	}
+	if err == nil {
+		err = corona.CreateTables()
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to create command tables")
+	}
+}
+
+// reuploadAttachments downloads a message's attachments so they can be sent again as files.
+// The returned function closes the downloads once the files have been sent.
+func reuploadAttachments(message *discordgo.Message) ([]*discordgo.File, func(), error) {
+	files := []*discordgo.File{}
+	bodies := []io.Closer{}
+	closeAll := func() {
+		for _, body := range bodies {
+			body.Close()
+		}
+	}
+	for _, attachment := range message.Attachments {
+		resp, err := http.Get(attachment.URL)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("couldn't download %s", attachment.Filename)
+		}
+		bodies = append(bodies, resp.Body)
+		files = append(files, &discordgo.File{
+			Name:        attachment.Filename,
+			ContentType: attachment.ContentType,
+			Reader:      resp.Body,
+		})
+	}
+	return files, closeAll, nil
+}
+
+// optionMap indexes command options by name
+func optionMap(options []*discordgo.ApplicationCommandInteractionDataOption) map[string]*discordgo.ApplicationCommandInteractionDataOption {
+	opts := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(options))
+	for _, opt := range options {
+		opts[opt.Name] = opt
+	}
+	return opts
+}
+
+// modalValue returns the value of a modal's text input
+func modalValue(data discordgo.ModalSubmitInteractionData, customID string) string {
+	for _, row := range data.Components {
+		actions, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, component := range actions.Components {
+			if input, ok := component.(*discordgo.TextInput); ok && input.CustomID == customID {
+				return input.Value
+			}
+		}
+	}
+	return ""
+}
+
+// parseMessageReference accepts a message link or an ID of a message in the given channel
+func parseMessageReference(reference, channelID string) (string, string, error) {
+	reference = strings.TrimSpace(reference)
+	if strings.HasPrefix(reference, "https://") {
+		parts := strings.Split(strings.TrimRight(reference, "/"), "/")
+		if len(parts) < 3 {
+			return "", "", fmt.Errorf("%q is not a message link", reference)
+		}
+		return parts[len(parts)-2], parts[len(parts)-1], nil
+	}
+	return channelID, reference, nil
+}
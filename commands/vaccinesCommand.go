@@ -2,23 +2,42 @@ package commands
 
 import (
 	"context"
+	"time"
 
 	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/charts"
 	"github.com/UCCNetsoc/discord-bot/corona"
 	"github.com/bwmarrin/discordgo"
 )
 
+// Show the vaccine rollout compared with the previous update, or the update the given number of days ago
 func vaccines(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
-	vaccines, err := corona.GetVaccines()
+	vaccines, err := corona.Data.Vaccines(ctx)
 	if err != nil {
 		log.WithContext(ctx).WithError(err)
 		InteractionResponseError(s, i, "Error querying vaccines from arcgis API", false)
 		return
 	}
+	if err = corona.SaveSnapshot(vaccines); err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to save vaccine snapshot")
+	}
+	compareTo := vaccines.Date.Add(-time.Second)
+	if opt, ok := optionMap(i.ApplicationCommandData().Options)["days"]; ok {
+		compareTo = vaccines.Date.AddDate(0, 0, -int(opt.IntValue()))
+	}
+	previous, err := corona.SnapshotAt(compareTo)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to get previous vaccine snapshot")
+	}
+	emb, graphs, err := corona.VaccinesReport(vaccines, previous)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to chart vaccine snapshots")
+	}
 	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Embeds: []*discordgo.MessageEmbed{vaccines.Embed(nil)},
+			Embeds: []*discordgo.MessageEmbed{emb},
+			Files:  charts.Files(graphs...),
 		},
 	})
 	if err != nil {
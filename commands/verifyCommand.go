@@ -0,0 +1,268 @@
+package commands
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/UCCNetsoc/discord-bot/emails"
+	"github.com/UCCNetsoc/discord-bot/store"
+	"github.com/bwmarrin/discordgo"
+)
+
+const verifyCodeInput = "code"
+
+// Email a one time code to a university address, which grants the verified role once entered
+func verifyCommand(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if config.GetString("verify.role") == "" || config.GetString("verify.secret") == "" {
+		InteractionResponseError(s, i, "verify.role and verify.secret must be configured to verify members", false)
+		return
+	}
+	userID := i.Member.User.ID
+	address, err := verifyAddress(optionMap(i.ApplicationCommandData().Options)["email"].StringValue())
+	if err != nil {
+		InteractionResponseError(s, i, err.Error(), false)
+		return
+	}
+	emailHash := verifyHash(address)
+
+	var verifiedUser string
+	err = store.DB.QueryRow("SELECT user_id FROM verified_members WHERE email_hash = $1;", emailHash).Scan(&verifiedUser)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.WithContext(ctx).WithError(err).Error("Failed to check verified members")
+		InteractionResponseError(s, i, "Couldn't start verification", true)
+		return
+	}
+	if verifiedUser == userID {
+		// Already verified, they may have left and rejoined
+		if err = verifyGrantRole(s, userID); err != nil {
+			log.WithContext(ctx).WithError(err).Error("Failed to add verified role")
+			InteractionResponseError(s, i, "Couldn't give you the verified role", true)
+			return
+		}
+		verifyRespond(ctx, s, i, "You're already verified, your role has been restored.", nil)
+		return
+	}
+	if verifiedUser != "" {
+		InteractionResponseError(s, i, "That email address has already been used to verify another account", false)
+		return
+	}
+
+	var sentAt time.Time
+	err = store.DB.QueryRow("SELECT sent_at FROM verifications WHERE user_id = $1;", userID).Scan(&sentAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.WithContext(ctx).WithError(err).Error("Failed to check pending verification")
+		InteractionResponseError(s, i, "Couldn't start verification", true)
+		return
+	}
+	if wait := time.Until(sentAt.Add(config.GetDuration("verify.resend_cooldown"))); wait > 0 {
+		InteractionResponseError(s, i, fmt.Sprintf("A code was sent recently, please wait %s before requesting another", wait.Round(time.Second)), false)
+		return
+	}
+
+	code, err := verifyCode()
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to generate verification code")
+		InteractionResponseError(s, i, "Couldn't start verification", true)
+		return
+	}
+	expiry := config.GetDuration("verify.code_expiry")
+	// Requesting a new code replaces the previous one and resets the attempts
+	_, err = store.DB.Exec(
+		`INSERT INTO verifications(user_id, email_hash, code_hash, expires_at, attempts, sent_at) VALUES($1, $2, $3, $4, 0, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET email_hash = $2, code_hash = $3, expires_at = $4, attempts = 0, sent_at = NOW();`,
+		userID, emailHash, verifyHash(code), time.Now().Add(expiry),
+	)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to store verification code")
+		InteractionResponseError(s, i, "Couldn't start verification", true)
+		return
+	}
+
+	if err = sendVerification(address, code, expiry); err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to send verification email")
+		store.DB.Exec("DELETE FROM verifications WHERE user_id = $1;", userID)
+		InteractionResponseError(s, i, "Couldn't send the verification email", true)
+		return
+	}
+
+	verifyRespond(ctx, s, i, fmt.Sprintf("A code has been sent to %s. It expires in %s.", address, formatDuration(expiry)), []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: "Enter code", Style: discordgo.PrimaryButton, CustomID: "verify_code"},
+			},
+		},
+	})
+}
+
+// Ask for the code which was emailed
+func verifyCodeButton(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: "verify_submit",
+			Title:    "Verify your email",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:  verifyCodeInput,
+							Label:     "Code from the email",
+							Style:     discordgo.TextInputShort,
+							Required:  true,
+							MinLength: 6,
+							MaxLength: 6,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
+
+func verifySubmit(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID := i.Member.User.ID
+	code := strings.TrimSpace(modalValue(i.ModalSubmitData(), verifyCodeInput))
+
+	var (
+		emailHash, codeHash string
+		expiresAt           time.Time
+		attempts            int
+	)
+	// Count the attempt before checking it so concurrent submissions can't exceed the limit
+	err := store.DB.QueryRow(
+		"UPDATE verifications SET attempts = attempts + 1 WHERE user_id = $1 RETURNING email_hash, code_hash, expires_at, attempts;", userID,
+	).Scan(&emailHash, &codeHash, &expiresAt, &attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		InteractionResponseError(s, i, "You don't have a pending verification, use /verify first", false)
+		return
+	}
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to load verification")
+		InteractionResponseError(s, i, "Couldn't check your code", true)
+		return
+	}
+	if time.Now().After(expiresAt) {
+		store.DB.Exec("DELETE FROM verifications WHERE user_id = $1;", userID)
+		InteractionResponseError(s, i, "That code has expired, use /verify to get a new one", false)
+		return
+	}
+	maxAttempts := config.GetInt("verify.max_attempts")
+	if attempts > maxAttempts {
+		InteractionResponseError(s, i, "Too many incorrect attempts, use /verify to get a new code once the cooldown has passed", false)
+		return
+	}
+	if !hmac.Equal([]byte(verifyHash(code)), []byte(codeHash)) {
+		InteractionResponseError(s, i, fmt.Sprintf("That code is incorrect, %d attempt(s) left", maxAttempts-attempts), false)
+		return
+	}
+
+	// The unique email hash stops one address verifying many accounts, even if two codes were sent to it
+	_, err = store.DB.Exec(
+		"INSERT INTO verified_members(email_hash, user_id) VALUES($1, $2) ON CONFLICT (user_id) DO UPDATE SET email_hash = $1, verified_at = NOW();",
+		emailHash, userID,
+	)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to store verified member")
+		InteractionResponseError(s, i, "That email address has already been used to verify another account", false)
+		return
+	}
+	if _, err = store.DB.Exec("DELETE FROM verifications WHERE user_id = $1;", userID); err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to remove verification code")
+	}
+	if err = verifyGrantRole(s, userID); err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to add verified role")
+		InteractionResponseError(s, i, "You're verified but the role couldn't be added, run /verify again to retry", true)
+		return
+	}
+	verifyRespond(ctx, s, i, "You're verified, welcome!", nil)
+}
+
+// verifyAddress normalises an email address and checks it belongs to one of verify.domains
+func verifyAddress(input string) (string, error) {
+	parsed, err := mail.ParseAddress(strings.TrimSpace(input))
+	if err != nil {
+		return "", fmt.Errorf("%q is not a valid email address", input)
+	}
+	address := strings.ToLower(parsed.Address)
+	domain := address[strings.LastIndex(address, "@")+1:]
+	allowed := []string{}
+	for _, d := range strings.Split(config.GetString("verify.domains"), ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			if d == domain {
+				return address, nil
+			}
+			allowed = append(allowed, d)
+		}
+	}
+	return "", fmt.Errorf("Only %s email addresses can be used to verify", strings.Join(allowed, ", "))
+}
+
+// verifyHash keys hashes with verify.secret so stored email addresses and codes can't be brute forced offline
+func verifyHash(value string) string {
+	mac := hmac.New(sha256.New, []byte(config.GetString("verify.secret")))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func verifyCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func sendVerification(address, code string, expiry time.Duration) error {
+	rendered, err := emails.Render(emails.VerificationTemplate, emails.VerificationData{
+		Code:    code,
+		Expires: formatDuration(expiry),
+	})
+	if err != nil {
+		return err
+	}
+	mailer, err := emails.Backend()
+	if err != nil {
+		return err
+	}
+	return mailer.Send(&emails.Message{
+		FromName: config.GetString("verify.from_name"),
+		From:     config.GetString("verify.from"),
+		To:       address,
+		Subject:  rendered.Subject,
+		Text:     rendered.Text,
+		HTML:     rendered.HTML,
+	})
+}
+
+func verifyGrantRole(s *discordgo.Session, userID string) error {
+	return s.GuildMemberRoleAdd(config.GetString("discord.public.server"), userID, config.GetString("verify.role"))
+}
+
+func verifyRespond(ctx context.Context, s *discordgo.Session, i *discordgo.InteractionCreate, content string, components []discordgo.MessageComponent) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: components,
+			Flags:      discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.WithContext(ctx).WithError(err)
+	}
+}
@@ -1,9 +1,20 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/Strum355/log"
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 )
 
@@ -20,48 +31,406 @@ type Channels struct {
 	PrivateEvents       string `json:"private_events"`       // On committee server
 }
 
+// Config is the typed configuration, from the defaults, an optional YAML file, the environment and Consul.
+// Settings it doesn't cover are read with GetString and the other getters.
+type Config struct {
+	Bot        BotConfig
+	Discord    DiscordConfig
+	Email      EmailConfig
+	Newsletter NewsletterConfig
+	SQL        SQLConfig
+	API        APIConfig
+	Prom       PromConfig
+	Corona     CoronaConfig
+	RSS        RSSConfig
+	Shorten    ShortenConfig
+}
+
+// BotConfig describes the running bot
+type BotConfig struct {
+	Version string
+}
+
+// DiscordConfig is how the bot connects to Discord, and the servers and channels it uses
+type DiscordConfig struct {
+	Token        string
+	Public       PublicConfig
+	Committee    CommitteeConfig
+	Autoregister bool
+	Charlimit    int
+}
+
+// PublicConfig is the public server and its channels
+type PublicConfig struct {
+	Server  string
+	Channel string
+	General string
+	Welcome string // Comma separated
+	Corona  string
+}
+
+// CommitteeConfig is the committee server and its channel
+type CommitteeConfig struct {
+	Server  string
+	Channel string
+}
+
+// EmailConfig chooses how emails are sent
+type EmailConfig struct {
+	Backend string
+}
+
+// NewsletterConfig is the mailing list newsletters are sent to
+type NewsletterConfig struct {
+	Recipients string // Comma separated
+	Secret     string
+}
+
+// SQLConfig is the postgres connection
+type SQLConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	DBName   string
+}
+
+// APIConfig is the REST API
+type APIConfig struct {
+	Port      int
+	PublicURL string `mapstructure:"public_url"`
+	Webhooks  struct {
+		URLs   []string
+		Secret string
+	}
+}
+
+// PromConfig is the prometheus exporter
+type PromConfig struct {
+	Port   int
+	DBName string
+}
+
+// CoronaConfig is where covid numbers come from and how often they're posted
+type CoronaConfig struct {
+	Default  string
+	Provider string
+	Interval time.Duration
+}
+
+// RSSConfig applies to every feed subscription
+type RSSConfig struct {
+	Interval time.Duration
+	Limit    int
+}
+
+// ShortenConfig is the URL shortener
+type ShortenConfig struct {
+	Host     string
+	Username string
+	Password string
+	Public   struct {
+		Host string
+	}
+}
+
+// Servers configured for the bot
+func (c *Config) Servers() Servers {
+	return Servers{PublicServer: c.Discord.Public.Server, CommitteeServer: c.Discord.Committee.Server}
+}
+
+// Channels configured for events and announcements
+func (c *Config) Channels() Channels {
+	return Channels{PublicAnnouncements: c.Discord.Public.Channel, PrivateEvents: c.Discord.Committee.Channel, PublicGeneral: c.Discord.Public.General}
+}
+
+// WelcomeMessages for new members of the public server
+func (c *Config) WelcomeMessages() []string {
+	return strings.Split(c.Discord.Public.Welcome, ",")
+}
+
+// Validate reports every missing or invalid value at once
+func (c *Config) Validate() error {
+	type setting[T any] struct {
+		key   string
+		value T
+	}
+	errs := []error{}
+	for _, required := range []setting[string]{
+		{"discord.token", c.Discord.Token},
+		{"discord.public.server", c.Discord.Public.Server},
+		{"discord.committee.server", c.Discord.Committee.Server},
+	} {
+		if required.value == "" {
+			errs = append(errs, fmt.Errorf("%s is required, set %s or %s in the config file", required.key, envName(required.key), required.key))
+		}
+	}
+	if strings.TrimSpace(c.Newsletter.Recipients) != "" && c.Newsletter.Secret == "" {
+		errs = append(errs, fmt.Errorf("newsletter.secret is required to sign unsubscribe links, set %s or unset newsletter.recipients", envName("newsletter.secret")))
+	}
+	if strings.TrimSpace(strings.Join(c.API.Webhooks.URLs, "")) != "" && c.API.Webhooks.Secret == "" {
+		errs = append(errs, fmt.Errorf("api.webhooks.secret is required to sign webhooks, set %s or unset api.webhooks.urls", envName("api.webhooks.secret")))
+	}
+	for _, port := range []setting[int]{{"sql.port", c.SQL.Port}, {"api.port", c.API.Port}, {"prom.port", c.Prom.Port}} {
+		if port.value < 1 || port.value > 65535 {
+			errs = append(errs, fmt.Errorf("%s must be a port from 1 to 65535, not %d", port.key, port.value))
+		}
+	}
+	if c.Email.Backend != "sendgrid" && c.Email.Backend != "smtp" {
+		errs = append(errs, fmt.Errorf("email.backend must be sendgrid or smtp, not %q", c.Email.Backend))
+	}
+	if c.Corona.Provider != "http" && c.Corona.Provider != "fixtures" {
+		errs = append(errs, fmt.Errorf("corona.provider must be http or fixtures, not %q", c.Corona.Provider))
+	}
+	if c.Corona.Interval <= 0 {
+		errs = append(errs, errors.New("corona.interval must be positive"))
+	}
+	if c.RSS.Interval <= 0 {
+		errs = append(errs, errors.New("rss.interval must be positive"))
+	}
+	if c.RSS.Limit < 1 {
+		errs = append(errs, errors.New("rss.limit must be at least 1"))
+	}
+	for _, link := range []setting[string]{{"api.public_url", c.API.PublicURL}, {"shorten.host", c.Shorten.Host}, {"shorten.public.host", c.Shorten.Public.Host}} {
+		if link.value == "" {
+			continue
+		}
+		if u, err := url.Parse(link.value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s must be an http or https URL, not %q", link.key, link.value))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Keys only read at startup, changing them needs a restart. Keys ending in . cover a whole section.
+var restartKeys = []string{
+	"discord.token", "discord.public.server", "discord.committee.server", "discord.autoregister", "discord.public.corona",
+	"sql.", "api.port", "prom.", "corona.provider", "corona.covid19api.", "corona.hpsc.", "consul.",
+}
+
 const limitChars = 8
 
-// InitConfig sets up viper and consul.
-func InitConfig() error {
-	// Viper
-	initDefaults()
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_")) // For gamers only
-	viper.AutomaticEnv()
-	viper.Set(
-		"discord.servers",
-		&Servers{PublicServer: viper.GetString("discord.public.server"), CommitteeServer: viper.GetString("discord.committee.server")},
-	)
-	viper.Set(
-		"discord.channels",
-		&Channels{PublicAnnouncements: viper.GetString("discord.public.channel"), PrivateEvents: viper.GetString("discord.committee.channel"), PublicGeneral: viper.GetString("discord.public.general")},
-	)
-	welcomeMessages := []string{}
-	for _, message := range strings.Split(viper.GetString("discord.public.welcome"), ",") {
-		welcomeMessages = append(welcomeMessages, message)
-	}
-	viper.Set("discord.welcome_messages", &welcomeMessages)
+var (
+	current     atomic.Pointer[Config]
+	settings    atomic.Pointer[viper.Viper] // Never changed once stored, reloads store a new one
+	configFile  string
+	reloadMu    sync.Mutex
+	reloadHooks []func(*Config)
+)
 
+// InitConfig sets up viper and consul, and loads the config with the YAML file at file if it isn't empty
+func InitConfig(file string) error {
+	configFile = file
+	if err := setup(viper.GetViper()); err != nil {
+		return err
+	}
+	cfg, err := load(viper.GetViper())
+	if err != nil {
+		return err
+	}
+	settings.Store(viper.GetViper())
+	current.Store(cfg)
 	printAll()
 	return nil
 }
 
+// Get the current config, which changes when it is reloaded
+func Get() *Config {
+	return current.Load()
+}
+
+// loaded is the viper holding the current settings, the global one until the config is loaded, such as in tests
+func loaded() *viper.Viper {
+	if v := settings.Load(); v != nil {
+		return v
+	}
+	return viper.GetViper()
+}
+
+// GetString setting, from the current config
+func GetString(key string) string {
+	return loaded().GetString(key)
+}
+
+// GetInt setting, from the current config
+func GetInt(key string) int {
+	return loaded().GetInt(key)
+}
+
+// GetBool setting, from the current config
+func GetBool(key string) bool {
+	return loaded().GetBool(key)
+}
+
+// GetDuration setting, from the current config
+func GetDuration(key string) time.Duration {
+	return loaded().GetDuration(key)
+}
+
+// GetStringSlice setting, from the current config
+func GetStringSlice(key string) []string {
+	return loaded().GetStringSlice(key)
+}
+
+// OnReload calls hook with the new config after each reload
+func OnReload(hook func(*Config)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadHooks = append(reloadHooks, hook)
+}
+
+// Reload the config file, environment and Consul keys. Nothing changes if the new config is invalid,
+// and changes to keys only read at startup are logged rather than applied.
+// The settings are read into a new viper, which replaces the current one once it is complete,
+// so nothing reading the config sees it change part way.
+func Reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	fresh := viper.New()
+	if err := setup(fresh); err != nil {
+		return err
+	}
+	if _, err := load(fresh); err != nil {
+		return err
+	}
+	previous := loaded()
+	changed := []string{}
+	restart := []string{}
+	// Keys only in the previous settings were removed, such as a deleted Consul key with no default
+	keys := append(fresh.AllKeys(), previous.AllKeys()...)
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		value := previous.Get(key)
+		if reflect.DeepEqual(fresh.Get(key), value) {
+			continue
+		}
+		if needsRestart(key) {
+			restart = append(restart, key)
+			fresh.Set(key, value)
+			continue
+		}
+		changed = append(changed, key)
+	}
+	if len(restart) > 0 {
+		log.WithFields(log.Fields{"keys": restart}).Warn("Restart the bot to apply these config changes")
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	cfg, err := load(fresh)
+	if err != nil {
+		return err
+	}
+	settings.Store(fresh)
+	current.Store(cfg)
+	log.WithFields(log.Fields{"keys": changed}).Info("Reloaded config")
+	for _, hook := range reloadHooks {
+		hook(cfg)
+	}
+	return nil
+}
+
+// Watch reloads the config on SIGHUP, and whenever the config file or Consul keys change
+func Watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reload("SIGHUP")
+		}
+	}()
+	if consul := consulFrom(loaded()); consul != nil {
+		go watchConsul(consul)
+	}
+	if configFile == "" {
+		return
+	}
+	// A separate viper watches the file, the settings only change once the new config is valid
+	watcher := viper.New()
+	watcher.SetConfigFile(configFile)
+	watcher.OnConfigChange(func(fsnotify.Event) { reload("file changed") })
+	watcher.WatchConfig()
+}
+
+func reload(reason string) {
+	if err := Reload(); err != nil {
+		log.WithError(err).WithFields(log.Fields{"reason": reason}).Error("Config not reloaded, keeping the current config")
+	}
+}
+
+// setup layers Consul over the environment, over the config file, over the defaults
+func setup(v *viper.Viper) error {
+	initDefaults(v)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_")) // For gamers only
+	v.AutomaticEnv()
+	if configFile == "" {
+		return readConsul(v)
+	}
+	v.SetConfigFile(configFile)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("couldn't read config file %s: %w", configFile, err)
+	}
+	return readConsul(v)
+}
+
+func load(v *viper.Viper) (*Config, error) {
+	cfg := &Config{}
+	if err := v.Unmarshal(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return cfg, nil
+}
+
+func needsRestart(key string) bool {
+	for _, restartKey := range restartKeys {
+		if key == restartKey || strings.HasSuffix(restartKey, ".") && strings.HasPrefix(key, restartKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// envName is the environment variable setting a key
+func envName(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
 func printAll() {
 	store := log.Fields{}
-	for k, v := range viper.AllSettings() {
-		localStore := map[string]interface{}{}
-		for sk, sv := range v.(map[string]interface{}) {
-			if strval, ok := sv.(string); ok {
-				if len(strval) > limitChars {
-					localStore[sk] = strval[:limitChars] + "..."
-				} else {
-					localStore[sk] = strval
-				}
-			} else {
-				localStore[sk] = sv
+	for k, v := range loaded().AllSettings() {
+		store[k] = redact(k, v)
+	}
+	log.WithFields(store).Info("discord bot startup config values")
+}
+
+// Keys containing these are left out of logs entirely
+var secretKeys = []string{"token", "secret", "password", "key"}
+
+// redact secrets at any depth, and shorten other strings in case they're sensitive
+func redact(key string, value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		redacted := map[string]interface{}{}
+		for k, v := range value {
+			redacted[k] = redact(k, v)
+		}
+		return redacted
+	case string:
+		for _, secret := range secretKeys {
+			if value != "" && strings.Contains(strings.ToLower(key), secret) {
+				return "[redacted]"
 			}
 		}
-		store[k] = localStore
+		if len(value) > limitChars {
+			return value[:limitChars] + "..."
+		}
 	}
-	log.WithFields(store).Info("discord bot startup config values")
+	return value
 }
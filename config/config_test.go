@@ -0,0 +1,105 @@
+package config
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Strum355/log"
+	"github.com/spf13/viper"
+)
+
+func TestMain(m *testing.M) {
+	log.InitSimpleLogger(&log.Config{Output: io.Discard})
+	os.Exit(m.Run())
+}
+
+const requiredYAML = `
+discord:
+  token: test
+  public:
+    server: "1"
+  committee:
+    server: "2"
+`
+
+// initTestConfig loads the config from a file holding the required keys and extra, returning the file to rewrite
+func initTestConfig(t *testing.T, extra string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, file, extra)
+	t.Cleanup(func() {
+		viper.Reset()
+		settings.Store(nil)
+		current.Store(nil)
+		reloadHooks = nil
+	})
+	if err := InitConfig(file); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func writeConfig(t *testing.T, file, extra string) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(requiredYAML+extra), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	file := initTestConfig(t, "rss:\n  limit: 5\nsql:\n  host: old\n")
+	reloads := []*Config{}
+	OnReload(func(cfg *Config) { reloads = append(reloads, cfg) })
+
+	// Readers carry on through the reload, run with -race to check they don't race it
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for idx := 0; idx < 4; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if limit := GetInt("rss.limit"); limit != 5 && limit != 10 {
+					t.Errorf("read rss.limit %d during reload", limit)
+				}
+				_ = Get().RSS.Limit
+				_ = GetString("sql.host")
+			}
+		}()
+	}
+
+	writeConfig(t, file, "rss:\n  limit: 10\nsql:\n  host: new\n")
+	err := Reload()
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if GetInt("rss.limit") != 10 || Get().RSS.Limit != 10 {
+		t.Errorf("rss.limit %d, typed %d after reloading, want 10", GetInt("rss.limit"), Get().RSS.Limit)
+	}
+	// The database is only connected to at startup
+	if GetString("sql.host") != "old" || Get().SQL.Host != "old" {
+		t.Errorf("sql.host %q, typed %q after reloading, want old", GetString("sql.host"), Get().SQL.Host)
+	}
+	if len(reloads) != 1 || reloads[0] != Get() {
+		t.Errorf("hooks called %d times, want once with the new config", len(reloads))
+	}
+
+	// An invalid config is ignored
+	writeConfig(t, file, "rss:\n  limit: 0\n")
+	if err = Reload(); err == nil {
+		t.Error("reloaded an invalid config")
+	}
+	if GetInt("rss.limit") != 10 || Get().RSS.Limit != 10 || len(reloads) != 1 {
+		t.Errorf("invalid config applied, rss.limit %d", GetInt("rss.limit"))
+	}
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/spf13/viper"
+)
+
+// Variables so tests can shorten them
+var (
+	// How long reading the keys at startup or on reload may take
+	consulTimeout = 10 * time.Second
+	// Watches ask Consul to hold the request this long before replying with no change
+	consulWait = 5 * time.Minute
+)
+
+// Consul reads config keys from a KV prefix, such as discord-bot/discord/public/channel for discord.public.channel
+type Consul struct {
+	Address string
+	Token   string
+	Prefix  string
+	Client  *http.Client
+}
+
+type consulPair struct {
+	Key   string
+	Value []byte // Base64 in the JSON, null for folders
+}
+
+// consulFrom v's consul settings, nil when no address is set
+func consulFrom(v *viper.Viper) *Consul {
+	address := v.GetString("consul.address")
+	if address == "" {
+		return nil
+	}
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	return &Consul{
+		Address: strings.TrimSuffix(address, "/"),
+		Token:   v.GetString("consul.token"),
+		Prefix:  strings.Trim(v.GetString("consul.prefix"), "/"),
+		Client:  &http.Client{},
+	}
+}
+
+// Values under the prefix, keyed like viper
+func (c *Consul) Values(ctx context.Context) (map[string]string, error) {
+	values, _, err := c.get(ctx, 0)
+	return values, err
+}
+
+// Wait blocks until the keys change from those at index, or Consul's wait passes.
+// It returns the index to wait on next, start with 0 to get the current index straight away.
+func (c *Consul) Wait(ctx context.Context, index uint64) (uint64, error) {
+	// Consul adds up to wait/16 to the wait, so a reply is overdue after that and the usual timeout.
+	// Without a deadline a half-open connection would block the watch forever.
+	timeout := consulTimeout
+	if index > 0 {
+		timeout += consulWait + consulWait/16
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	_, next, err := c.get(ctx, index)
+	return next, err
+}
+
+func (c *Consul) get(ctx context.Context, index uint64) (map[string]string, uint64, error) {
+	query := url.Values{"recurse": {"true"}}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", consulWait.String())
+	}
+	// Recursing matches any key starting with the path, so the slash keeps out siblings like discord-bot-staging
+	path := c.Prefix
+	if path != "" {
+		path += "/"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/v1/kv/%s?%s", c.Address, path, query.Encode()), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	values := map[string]string{}
+	// No keys under the prefix yet
+	if resp.StatusCode == http.StatusNotFound {
+		return values, next, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("consul returned %s", resp.Status)
+	}
+	pairs := []consulPair{}
+	if err = json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, 0, err
+	}
+	for _, pair := range pairs {
+		key := strings.Trim(strings.TrimPrefix(pair.Key, c.Prefix), "/")
+		if key == "" || strings.HasSuffix(pair.Key, "/") {
+			continue
+		}
+		values[strings.ToLower(strings.ReplaceAll(key, "/", "."))] = string(pair.Value)
+	}
+	return values, next, nil
+}
+
+// readConsul sets v's keys from Consul, over the environment, file and defaults
+func readConsul(v *viper.Viper) error {
+	consul := consulFrom(v)
+	if consul == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), consulTimeout)
+	defer cancel()
+	values, err := consul.Values(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't read config from consul at %s: %w", consul.Address, err)
+	}
+	for key, value := range values {
+		v.Set(key, value)
+	}
+	return nil
+}
+
+// watchConsul reloads the config whenever the keys under the prefix change
+func watchConsul(consul *Consul) {
+	index := uint64(0)
+	backoff := time.Second
+	for {
+		start := time.Now()
+		next, err := consul.Wait(context.Background(), index)
+		if err != nil {
+			log.WithError(err).Error("Failed to watch consul for config changes")
+			time.Sleep(backoff)
+			backoff = min(backoff*2, time.Minute)
+			continue
+		}
+		backoff = time.Second
+		// The index can go backwards, such as when Consul restores a snapshot, so the watch starts over
+		if next < index {
+			next = 0
+		}
+		if index != 0 && next != index {
+			reload("consul changed")
+		}
+		index = next
+		// Consul can reply straight away, such as when the index is 0, so it isn't asked more than once a second
+		if elapsed := time.Since(start); elapsed < time.Second {
+			time.Sleep(time.Second - elapsed)
+		}
+	}
+}
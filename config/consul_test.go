@@ -0,0 +1,255 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConsul is a KV store answering recursive reads like Consul, including blocking on an index
+type fakeConsul struct {
+	lock    sync.Mutex
+	keys    map[string]string
+	index   uint64
+	changed chan struct{}
+	token   string
+}
+
+func newFakeConsul(t *testing.T, token string, keys map[string]string) (*fakeConsul, string) {
+	t.Helper()
+	fake := &fakeConsul{keys: keys, index: 10, changed: make(chan struct{}), token: token}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server.URL
+}
+
+// set a key, or delete it when value is nil
+func (f *fakeConsul) set(key string, value *string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if value == nil {
+		delete(f.keys, key)
+	} else {
+		f.keys[key] = *value
+	}
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Consul-Token") != f.token {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+	if r.URL.Query().Get("recurse") != "true" {
+		http.Error(w, "only recursive reads are faked", http.StatusBadRequest)
+		return
+	}
+	f.lock.Lock()
+	if index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); index > 0 && index >= f.index {
+		changed := f.changed
+		f.lock.Unlock()
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+		f.lock.Lock()
+	}
+	defer f.lock.Unlock()
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	pairs := []consulPair{}
+	for key, value := range f.keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		pair := consulPair{Key: key}
+		// Folders have no value
+		if !strings.HasSuffix(key, "/") {
+			pair.Value = []byte(value)
+		}
+		pairs = append(pairs, pair)
+	}
+	if len(pairs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	json.NewEncoder(w).Encode(pairs)
+}
+
+func TestConsulValues(t *testing.T) {
+	_, address := newFakeConsul(t, "acl", map[string]string{
+		"discord-bot/":                       "",
+		"discord-bot/discord/public/channel": "123",
+		"discord-bot/RSS/Limit":              "7",
+		"discord-bot/rss/":                   "",
+		"discord-bot-staging/discord/token":  "staging",
+		"other/discord/token":                "other",
+	})
+	consul := &Consul{Address: address, Token: "acl", Prefix: "discord-bot", Client: &http.Client{}}
+	values, err := consul.Values(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"discord.public.channel": "123", "rss.limit": "7"}
+	if len(values) != len(want) {
+		t.Errorf("got %v, want %v", values, want)
+	}
+	for key, value := range want {
+		if values[key] != value {
+			t.Errorf("%s is %q, want %q", key, values[key], value)
+		}
+	}
+
+	// Nothing under the prefix yet
+	consul.Prefix = "discord-bot-prod"
+	if values, err = consul.Values(context.Background()); err != nil || len(values) != 0 {
+		t.Errorf("got %v, %v for an empty prefix", values, err)
+	}
+
+	consul.Token = "wrong"
+	if _, err = consul.Values(context.Background()); err == nil {
+		t.Error("read keys with the wrong token")
+	}
+}
+
+func TestConsulWait(t *testing.T) {
+	fake, address := newFakeConsul(t, "", map[string]string{"discord-bot/rss/limit": "7"})
+	consul := &Consul{Address: address, Prefix: "discord-bot", Client: &http.Client{}}
+
+	index, err := consul.Wait(context.Background(), 0)
+	if err != nil || index != 10 {
+		t.Fatalf("got index %d, %v, want 10 straight away", index, err)
+	}
+
+	// Blocks until a key changes
+	done := make(chan uint64)
+	go func() {
+		next, err := consul.Wait(context.Background(), index)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- next
+	}()
+	select {
+	case next := <-done:
+		t.Fatalf("returned index %d before anything changed", next)
+	case <-time.After(50 * time.Millisecond):
+	}
+	limit := "8"
+	fake.set("discord-bot/rss/limit", &limit)
+	select {
+	case next := <-done:
+		if next != 11 {
+			t.Errorf("got index %d after the change, want 11", next)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("still waiting after a key changed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = consul.Wait(ctx, 11); err == nil {
+		t.Error("waited past the context")
+	}
+}
+
+func TestConsulWaitTimeout(t *testing.T) {
+	previousWait, previousTimeout := consulWait, consulTimeout
+	consulWait, consulTimeout = 160*time.Millisecond, 100*time.Millisecond
+	t.Cleanup(func() { consulWait, consulTimeout = previousWait, previousTimeout })
+
+	// Accepts connections and never replies, like a half-open connection
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := make(chan net.Conn, 10)
+	t.Cleanup(func() {
+		listener.Close()
+		for {
+			select {
+			case conn := <-conns:
+				conn.Close()
+			default:
+				return
+			}
+		}
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	consul := &Consul{Address: "http://" + listener.Addr().String(), Prefix: "discord-bot", Client: &http.Client{}}
+	for _, test := range []struct {
+		index uint64
+		want  time.Duration
+	}{
+		{0, consulTimeout},
+		// The wait, Consul's jitter of up to wait/16, then the usual timeout
+		{11, consulWait + consulWait/16 + consulTimeout},
+	} {
+		start := time.Now()
+		if _, err = consul.Wait(context.Background(), test.index); err == nil {
+			t.Errorf("index %d: waited without a reply", test.index)
+		}
+		if elapsed := time.Since(start); elapsed < test.want || elapsed > test.want+time.Second {
+			t.Errorf("index %d: gave up after %s, want %s", test.index, elapsed, test.want)
+		}
+	}
+}
+
+func TestConsulReload(t *testing.T) {
+	limit, channel := "7", "consul-channel"
+	fake, address := newFakeConsul(t, "", map[string]string{
+		"discord-bot/rss/limit":              limit,
+		"discord-bot/discord/public/channel": channel,
+	})
+	t.Setenv("CONSUL_ADDRESS", address)
+	t.Setenv("DISCORD_PUBLIC_CHANNEL", "env-channel")
+	initTestConfig(t, "")
+	if GetInt("rss.limit") != 7 || Get().RSS.Limit != 7 || Get().Discord.Public.Channel != "consul-channel" {
+		t.Fatalf("rss.limit %d and channel %q from consul", GetInt("rss.limit"), Get().Discord.Public.Channel)
+	}
+
+	// Deleted keys fall back to the environment, then the defaults
+	fake.set("discord-bot/rss/limit", nil)
+	fake.set("discord-bot/discord/public/channel", nil)
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if GetInt("rss.limit") != 3 || Get().RSS.Limit != 3 {
+		t.Errorf("rss.limit %d after deleting it, want the default 3", GetInt("rss.limit"))
+	}
+	if GetString("discord.public.channel") != "env-channel" || Get().Discord.Public.Channel != "env-channel" {
+		t.Errorf("channel %q after deleting it, want env-channel", GetString("discord.public.channel"))
+	}
+
+	// Invalid values aren't applied
+	zero := "0"
+	fake.set("discord-bot/rss/limit", &zero)
+	if err := Reload(); err == nil {
+		t.Error("reloaded an invalid limit from consul")
+	}
+	if GetInt("rss.limit") != 3 {
+		t.Errorf("rss.limit %d after an invalid change", GetInt("rss.limit"))
+	}
+}
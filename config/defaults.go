@@ -2,64 +2,134 @@ package config
 
 import "github.com/spf13/viper"
 
-func initDefaults() {
+// initDefaults on v, the global viper or a fresh one being reloaded
+func initDefaults(v *viper.Viper) {
 	// Bot
-	viper.SetDefault("bot.prefix", "!")
-	viper.SetDefault("bot.quote.default_message_weight", 1)
-	viper.SetDefault("bot.version", "development")
+	v.SetDefault("bot.prefix", "!")
+	v.SetDefault("bot.quote.default_message_weight", 1)
+	v.SetDefault("bot.version", "development")
+	// Consul KV, keys under the prefix override the environment
+	v.SetDefault("consul.address", "") // Consul isn't used when empty
+	v.SetDefault("consul.token", "")
+	v.SetDefault("consul.prefix", "discord-bot")
 	// Discord
-	viper.SetDefault("discord.token", "") // GitHub scrapers be like -.-
-	viper.SetDefault("discord.servers", &Servers{})
-	viper.SetDefault("discord.channels", &Channels{})
+	v.SetDefault("discord.token", "") // GitHub scrapers be like -.-
 
-	viper.SetDefault("discord.public.server", "")
-	viper.SetDefault("discord.public.channel", "")
-	viper.SetDefault("discord.public.general", "")
-	viper.SetDefault("discord.public.welcome", "")
-	viper.SetDefault("discord.public.corona", "")
-	viper.SetDefault("discord.committee.server", "")
-	viper.SetDefault("discord.committee.channel", "")
+	v.SetDefault("discord.public.server", "")
+	v.SetDefault("discord.public.channel", "")
+	v.SetDefault("discord.public.general", "")
+	v.SetDefault("discord.public.welcome", "")
+	v.SetDefault("discord.public.corona", "")
+	v.SetDefault("discord.committee.server", "")
+	v.SetDefault("discord.committee.channel", "")
 
-	viper.SetDefault("discord.welcome_messages", &[]string{})
-
-	viper.SetDefault("discord.roles", "")
-	viper.SetDefault("discord.autoregister", true)
-	viper.SetDefault("discord.charlimit", 280) // Limit for event description
-	viper.SetDefault("discord.quote_blacklist", &[]string{})
+	v.SetDefault("discord.roles", "")
+	v.SetDefault("discord.autoregister", true)
+	v.SetDefault("discord.charlimit", 280) // Limit for event description
+	v.SetDefault("discord.quote_blacklist", &[]string{})
 	// Sendgrid
-	viper.SetDefault("sendgrid.token", "")
+	v.SetDefault("sendgrid.token", "")
+	// Email
+	v.SetDefault("email.backend", "sendgrid") // sendgrid or smtp
+	v.SetDefault("email.smtp.host", "localhost")
+	v.SetDefault("email.smtp.port", 1025)
+	v.SetDefault("email.smtp.username", "")
+	v.SetDefault("email.smtp.password", "")
+	// Newsletter
+	v.SetDefault("newsletter.from", "newsletter@netsoc.co")
+	v.SetDefault("newsletter.from_name", "UCC Netsoc")
+	v.SetDefault("newsletter.recipients", "")      // Comma separated mailing list
+	v.SetDefault("newsletter.secret", "")          // Signs unsubscribe links
+	v.SetDefault("newsletter.testers", "")         // Comma separated addresses tests can go to, besides the sender's own verified address
+	v.SetDefault("newsletter.send_timeout", "10m") // A send with no deliveries for this long is assumed to have stopped, and can be retried
+	// Student email verification
+	v.SetDefault("verify.domains", "umail.ucc.ie") // Comma separated
+	v.SetDefault("verify.role", "")                // Role given on the public server once verified
+	v.SetDefault("verify.secret", "")              // Keys the stored email and code hashes
+	v.SetDefault("verify.from", "verify@netsoc.co")
+	v.SetDefault("verify.from_name", "UCC Netsoc")
+	v.SetDefault("verify.code_expiry", "15m")
+	v.SetDefault("verify.max_attempts", 5)
+	v.SetDefault("verify.resend_cooldown", "1m")
 	// Twitter
-	viper.SetDefault("twitter.key", "")
-	viper.SetDefault("twitter.secret", "")
-	viper.SetDefault("twitter.access.key", "")
-	viper.SetDefault("twitter.access.secret", "")
+	v.SetDefault("twitter.key", "")
+	v.SetDefault("twitter.secret", "")
+	v.SetDefault("twitter.access.key", "")
+	v.SetDefault("twitter.access.secret", "")
 	// Google Calendar
-	viper.SetDefault("google.calendar.public.ics", "")
-	viper.SetDefault("google.calendar.committee.ics", "")
-	viper.SetDefault("google.calendar.image.default", "")
+	v.SetDefault("google.calendar.public.ics", "")
+	v.SetDefault("google.calendar.committee.ics", "")
+	v.SetDefault("google.calendar.image.default", "")
+	v.SetDefault("google.calendar.timezone", "Europe/Dublin")
 	// Rest API
-	viper.SetDefault("api.port", 80)
-	viper.SetDefault("api.event_query_limit", 20)
-	viper.SetDefault("api.announcement_query_limit", 20)
-	viper.SetDefault("api.public_message_cutoff", 10)
-	viper.SetDefault("api.remove_symbols", []string{"@everyone", "@here"})
+	v.SetDefault("api.port", 80)
+	v.SetDefault("api.public_url", "") // Where this API is reachable publicly, used in links sent out
+	v.SetDefault("api.event_query_limit", 20)
+	v.SetDefault("api.announcement_query_limit", 20)
+	v.SetDefault("api.announcement_history", 500) // Messages read back through the announcements channel
+	v.SetDefault("api.public_message_cutoff", 10)
+	v.SetDefault("api.remove_symbols", []string{"@everyone", "@here"})
+	v.SetDefault("api.cors.origins", []string{"*"})
+	v.SetDefault("api.webhooks.urls", []string{}) // Receive signed POSTs for new announcements and event changes
+	v.SetDefault("api.webhooks.secret", "")
+	v.SetDefault("api.push.calendar_interval", "5m")
+
+	v.SetDefault("github.secret", "") // Webhook secret, deliveries are rejected until it is set
+	v.SetDefault("github.organisation", "UCCNetsoc")
+	v.SetDefault("github.channel", "") // Where events go when no route matches
+	v.SetDefault("github.routes", "")  // Comma separated repo/event=channel rules, either side may be *
 	// Up sites
-	viper.SetDefault("netsoc.sites", "https://uccexpress.ie,http://netsoc.co,https://motley.ie,https://hlm.netsoc.co,https://uccnetsoc.netsoc.co,https://wiki.netsoc.co")
-	viper.SetDefault("minecraft.host", "minecraft.netsoc.co:1194")
+	v.SetDefault("netsoc.sites", "https://uccexpress.ie,http://netsoc.co,https://motley.ie,https://hlm.netsoc.co,https://uccnetsoc.netsoc.co,https://wiki.netsoc.co")
+	v.SetDefault("minecraft.host", "minecraft.netsoc.co:1194") // Without a port the SRV record is used
+	v.SetDefault("minecraft.servers", "")                      // Comma separated name=host pairs, minecraft.host when empty
+	v.SetDefault("minecraft.protocol", -1)                     // Handshake protocol version, -1 when unknown
+	v.SetDefault("minecraft.history_days", 90)                 // How long player history is kept
+	v.SetDefault("minecraft.join_channel", "")                 // Where opted in players' joins are announced
+	v.SetDefault("minecraft.rcon.port", 25575)                 // RCON port on each server's host, after following SRV records
+	v.SetDefault("minecraft.rcon.password", "")                // Needed to link accounts, players are whispered a code over RCON
+	// Bot presence, rotated through in order
+	v.SetDefault("status.providers", "minecraft,event,members,uptime")
+	v.SetDefault("status.retries", 3)
+	v.SetDefault("status.backoff", "10s")
+	v.SetDefault("status.minecraft.template", "Minecraft {{.Online}} {{.Players}} online {{.Server}}")
+	v.SetDefault("status.minecraft.activity", "playing")
+	v.SetDefault("status.minecraft.interval", "1m")
+	v.SetDefault("status.event.template", "{{.Title}} in {{.Countdown}}")
+	v.SetDefault("status.event.activity", "watching")
+	v.SetDefault("status.event.interval", "1m")
+	v.SetDefault("status.members.template", "{{.Members}} members")
+	v.SetDefault("status.members.activity", "watching")
+	v.SetDefault("status.members.interval", "30s")
+	v.SetDefault("status.uptime.template", "{{.Up}}/{{.Total}} sites up")
+	v.SetDefault("status.uptime.activity", "watching")
+	v.SetDefault("status.uptime.interval", "30s")
 	// Prometheus exporter
-	viper.SetDefault("prom.port", 2112)
-	viper.SetDefault("prom.dbname", "promexporter")
+	v.SetDefault("prom.port", 2112)
+	v.SetDefault("prom.dbname", "promexporter")
 	// Database
-	viper.SetDefault("sql.host", "postgres.netsoc.local")
-	viper.SetDefault("sql.port", 5432)
-	viper.SetDefault("sql.username", "root")
-	viper.SetDefault("sql.password", "password")
+	v.SetDefault("sql.host", "postgres.netsoc.local")
+	v.SetDefault("sql.port", 5432)
+	v.SetDefault("sql.username", "root")
+	v.SetDefault("sql.password", "password")
+	v.SetDefault("sql.dbname", "discordbot")
 	// Corona
-	viper.SetDefault("corona.default", "ireland")
-	viper.SetDefault("corona.webhook", "https://events.netsoc.dev/corona")
-	viper.SetDefault("freeimage.key", "6d207e02198a847aa98d0a2a901485a5")
+	v.SetDefault("corona.default", "ireland")
+	v.SetDefault("corona.webhook", "https://events.netsoc.dev/corona")
+	v.SetDefault("corona.interval", "3m")   // How often the HSE feeds are polled
+	v.SetDefault("corona.provider", "http") // http, or fixtures to use recorded data offline
+	v.SetDefault("corona.covid19api.url", "https://api.covid19api.com")
+	v.SetDefault("corona.covid19api.insecure", true) // Skips TLS verification, its certificate has been broken
+	v.SetDefault("corona.hpsc.cases_url", "https://services1.arcgis.com/eNO7HHeQ3rUcBllm/arcgis/rest/services")
+	v.SetDefault("corona.hpsc.vaccines_url", "https://services-eu1.arcgis.com/z6bHNio59iTqqSUY/arcgis/rest/services")
+	v.SetDefault("corona.hpsc.insecure", false)
+	// RSS and Atom subscriptions
+	v.SetDefault("rss.interval", "15m")
+	v.SetDefault("rss.limit", 3) // Default for the most entries posted per poll
 
-	viper.SetDefault("shorten.domain", "links.netsoc.co")
-	viper.SetDefault("shorten.username", "")
-	viper.SetDefault("shorten.password", "")
+	// URL shortener
+	v.SetDefault("shorten.host", "") // Admin API of the shortener, /shorten is unavailable until it is set
+	v.SetDefault("shorten.public.host", "https://links.netsoc.co")
+	v.SetDefault("shorten.domain", "links.netsoc.co")
+	v.SetDefault("shorten.username", "")
+	v.SetDefault("shorten.password", "")
 }
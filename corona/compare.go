@@ -0,0 +1,183 @@
+package corona
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UCCNetsoc/discord-bot/charts"
+	"github.com/UCCNetsoc/discord-bot/embed"
+	"github.com/bwmarrin/discordgo"
+	"github.com/wcharczuk/go-chart"
+)
+
+// MaxCompare is the most countries compared at once
+const MaxCompare = 5
+
+// How far back comparisons are plotted
+const compareDays = 90
+
+// CountryRates are a country's daily cases and deaths per 100k people, as 7-day rolling averages
+type CountryRates struct {
+	Country    CountrySummary
+	Population int
+	Dates      []time.Time
+	Cases      []float64
+	Deaths     []float64
+	// Totals per 100k at the end of the history
+	TotalCases  float64
+	TotalDeaths float64
+}
+
+// FindCountry matches a slug, name or country code, ignoring case
+func (t *TotalSummary) FindCountry(input string) *CountrySummary {
+	input = strings.TrimSpace(input)
+	slug := strings.ToLower(strings.ReplaceAll(input, " ", "-"))
+	for _, country := range t.Countries {
+		if country.Slug == slug || strings.EqualFold(country.Country, input) || strings.EqualFold(country.CountryCode, input) {
+			return &country
+		}
+	}
+	return nil
+}
+
+// Rates gets the histories of each country at once, and converts them to rates per 100k
+func Rates(ctx context.Context, countries []CountrySummary) ([]CountryRates, error) {
+	// Every population is checked before fetching anything
+	populations := make([]int, len(countries))
+	for idx, country := range countries {
+		population, ok := CountryPopulation(country.Slug)
+		if !ok {
+			return nil, fmt.Errorf("the population of %s isn't known", country.Country)
+		}
+		populations[idx] = population
+	}
+	rates := make([]CountryRates, len(countries))
+	errs := make([]error, len(countries))
+	wg := sync.WaitGroup{}
+	for idx, country := range countries {
+		wg.Add(1)
+		go func(idx int, country CountrySummary) {
+			defer wg.Done()
+			history, err := Data.History(ctx, country.Slug)
+			if err != nil {
+				errs[idx] = fmt.Errorf("couldn't get the history of %s: %w", country.Country, err)
+				return
+			}
+			rates[idx] = countryRates(country, populations[idx], history)
+		}(idx, country)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rates, nil
+}
+
+func countryRates(country CountrySummary, population int, history []CountryDaily) CountryRates {
+	rates := CountryRates{Country: country, Population: population}
+	if len(history) == 0 {
+		return rates
+	}
+	last := history[len(history)-1]
+	rates.TotalCases = Per100k(float64(last.Cases), population)
+	rates.TotalDeaths = Per100k(float64(last.Deaths), population)
+
+	daily := Daily(history)
+	cases := []float64{}
+	deaths := []float64{}
+	for _, day := range daily {
+		rates.Dates = append(rates.Dates, day.Date)
+		cases = append(cases, Per100k(float64(day.Cases), population))
+		deaths = append(deaths, Per100k(float64(day.Deaths), population))
+	}
+	rates.Cases = RollingAverage(cases, averageDays)
+	rates.Deaths = RollingAverage(deaths, averageDays)
+
+	// Only the recent history is plotted, after averaging so the first days shown are full averages
+	start := 0
+	if len(rates.Dates) > 0 {
+		cutoff := rates.Dates[len(rates.Dates)-1].AddDate(0, 0, -compareDays)
+		for start < len(rates.Dates) && rates.Dates[start].Before(cutoff) {
+			start++
+		}
+	}
+	rates.Dates, rates.Cases, rates.Deaths = rates.Dates[start:], rates.Cases[start:], rates.Deaths[start:]
+	return rates
+}
+
+// CompareGraph overlays each country's cases per 100k, with deaths dashed on the right axis
+func CompareGraph(rates []CountryRates) (*charts.Attachment, error) {
+	series := []chart.Series{}
+	for idx, country := range rates {
+		if len(country.Dates) < 2 {
+			continue
+		}
+		series = append(series,
+			chart.TimeSeries{
+				Name:    country.Country.Country,
+				Style:   charts.Line(charts.Colour(idx), 3),
+				XValues: country.Dates,
+				YValues: country.Cases,
+			},
+			// Left out of the legend, the table explains the dashed lines
+			chart.TimeSeries{
+				Style:   charts.Dashed(charts.Colour(idx), 2),
+				YAxis:   chart.YAxisSecondary,
+				XValues: country.Dates,
+				YValues: country.Deaths,
+			},
+		)
+	}
+	if len(series) == 0 {
+		return nil, errors.New("not enough history to compare")
+	}
+	graph := chart.Chart{
+		Title: "Cases and deaths per 100k people, 7-day average",
+		XAxis: chart.XAxis{
+			Name:           "Date",
+			ValueFormatter: chart.TimeDateValueFormatter,
+		},
+		YAxis: chart.YAxis{
+			Name:           "Cases per 100k",
+			ValueFormatter: func(v interface{}) string { return chart.FloatValueFormatterWithFormat(v, "%.0f") },
+		},
+		YAxisSecondary: chart.YAxis{
+			Name:           "Deaths per 100k",
+			ValueFormatter: func(v interface{}) string { return chart.FloatValueFormatterWithFormat(v, "%.2f") },
+		},
+		Series: series,
+	}
+	charts.Dark(&graph)
+	graph.Background.Padding = chart.Box{Top: 50, Left: 20, Right: 20, Bottom: 20}
+	graph.Elements = []chart.Renderable{chart.LegendThin(&graph)}
+	return charts.Render("compare", graph)
+}
+
+// CompareTable lists the latest and total rates of each country
+func CompareTable(rates []CountryRates) *discordgo.MessageEmbed {
+	table := &strings.Builder{}
+	fmt.Fprintf(table, "%-14s %8s %7s %8s %6s\n", "", "Cases", "Deaths", "Total", "Total")
+	fmt.Fprintf(table, "%-14s %8s %7s %8s %6s\n", "Country", "per day", "per day", "cases", "deaths")
+	for _, country := range rates {
+		name := country.Country.Country
+		if len([]rune(name)) > 14 {
+			name = string([]rune(name)[:13]) + "…"
+		}
+		var cases, deaths float64
+		if n := len(country.Cases); n > 0 {
+			cases, deaths = country.Cases[n-1], country.Deaths[n-1]
+		}
+		fmt.Fprintf(table, "%-14s %8.1f %7.2f %8.0f %6.0f\n", name, cases, deaths, country.TotalCases, country.TotalDeaths)
+	}
+	return embed.NewEmbed().
+		SetTitle("Covid-19 per 100k people").
+		SetDescription(fmt.Sprintf("```\n%s```\nDaily numbers are 7-day averages. Deaths are dashed on the chart, against the right axis", table.String())).
+		SetColor(0x9b12f1).
+		MessageEmbed
+}
@@ -1,42 +1,22 @@
 package corona
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
 	"time"
 
 	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/charts"
 	"github.com/UCCNetsoc/discord-bot/embed"
 	"github.com/bwmarrin/discordgo"
-	"github.com/spf13/viper"
-	"github.com/vincent-petithory/dataurl"
 	"github.com/wcharczuk/go-chart"
-	"github.com/wcharczuk/go-chart/drawing"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 )
 
-const (
-	covidSummary      = "https://api.covid19api.com/summary"
-	covidDayOne       = "https://api.covid19api.com/total/dayone/country/%s/status/confirmed"
-	imgHost           = "https://freeimage.host/api/1/upload"
-	arcgis            = "https://services1.arcgis.com/eNO7HHeQ3rUcBllm/arcgis/rest/services/CovidStatisticsProfileHPSCIrelandOpenData/FeatureServer/0/query?f=json&where=1%3D1&returnGeometry=false&spatialRel=esriSpatialRelIntersects&outFields=*&orderByFields=Date%20asc&resultOffset=0&resultRecordCount=32000&resultType=standard&cacheHint=true"
-	covidVaccines     = "https://services-eu1.arcgis.com/z6bHNio59iTqqSUY/arcgis/rest/services/Covid19_Vaccine_Administration_Hosted_View/FeatureServer/0/query?f=json&where=1=1&outFields=*&returnGeometry=false"
-	covidVaccinesType = "https://services-eu1.arcgis.com/z6bHNio59iTqqSUY/arcgis/rest/services/Covid19_Vaccine_Administration_VaccineTypeHostedView_V2/FeatureServer/0/query?f=json&where=1%3D1&outFields=*&returnGeometry=false"
-	layoutIE          = "02/01/06"
-	sleepTime         = time.Duration(3 * time.Minute)
-)
-
-var (
-	currentDate     *time.Time
-	currentVaccines *Vaccines
-)
+const layoutIE = "02/01/06"
 
 // CountryBase is the basic country stats.
 type CountryBase struct {
@@ -64,97 +44,22 @@ type CountrySummary struct {
 	TotalRecovered int
 }
 
-// Get Arcgis data.
-func GetArcgis() (daily []CountryDaily, summary *CountrySummary, err error) {
-	var resp *http.Response
-	if resp, err = http.Get(arcgis); err != nil {
-		return
-	}
-	data := struct {
-		Features []struct {
-			Attributes struct {
-				Date                     int64
-				ConfirmedCovidCases      int
-				TotalConfirmedCovidCases int
-				ConfirmedCovidDeaths     int
-				TotalCovidDeaths         int
-			} `json:"attributes"`
-		} `json:"features"`
-	}{}
-	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return
-	}
-	for _, attrs := range data.Features {
-		country := attrs.Attributes
-		daily = append(daily, CountryDaily{
-			CountryBase: CountryBase{
-				Date:        time.Unix(country.Date/1000, 0),
-				Country:     "Ireland",
-				CountryCode: "IE",
-			},
-			Cases:  country.TotalConfirmedCovidCases,
-			Deaths: country.TotalCovidDeaths,
-		})
-	}
-	if len(data.Features) > 0 {
-		last := data.Features[len(data.Features)-1].Attributes
-		summary = &CountrySummary{
-			CountryBase: CountryBase{
-				Country:     "Ireland",
-				CountryCode: "IE",
-				Date:        time.Unix(last.Date/1000, 0),
-			},
-			Slug:           "ireland",
-			NewConfirmed:   last.ConfirmedCovidCases,
-			NewDeaths:      last.ConfirmedCovidDeaths,
-			TotalConfirmed: last.TotalConfirmedCovidCases,
-			TotalDeaths:    last.TotalCovidDeaths,
-		}
-	} else {
-		err = errors.New("No data received from arcgis")
-	}
-	return
-}
-
-func (c *CountrySummary) getHistory() ([]CountryDaily, error) {
-	if c.Slug == viper.GetString("corona.default") {
-		daily, _, err := GetArcgis()
-		if err != nil {
-			return nil, err
-		}
-		return daily, nil
-	}
-	resp, err := http.Get(fmt.Sprintf(covidDayOne, c.Slug))
-	if err != nil {
-		return nil, err
+// Graph generates a chart of historic cases to attach to a message.
+// With average, 7-day rolling averages are plotted rather than single days.
+func (c *CountrySummary) Graph(history []CountryDaily, month, average bool) (*charts.Attachment, error) {
+	if month && len(history) < 33 || len(history) < 2 {
+		return nil, errors.New("not enough history for a graph")
 	}
-	country := []CountryDaily{}
-	if err = json.NewDecoder(resp.Body).Decode(&country); err != nil {
-		return nil, err
-	}
-	return country, nil
-}
-
-// Graph generated a graph of historic cases.
-func (c *CountrySummary) Graph(month bool) (*bytes.Buffer, error) {
-	history, err := c.getHistory()
-	if err != nil {
-		return nil, err
-	}
-	var first CountryDaily
+	// The day before the graph starts is the baseline, as histories don't always start from zero
 	if month {
-		first = history[len(history)-33]
-		history = history[len(history)-32:]
+		history = history[len(history)-33:]
 	}
+	first, history := history[0], history[1:]
 	dates := []time.Time{}
 	totalCases := []float64{}
 	totalDeaths := []float64{}
-	aggregate := 0
-	aggregateDeaths := 0
-	if month {
-		aggregate = first.Cases
-		aggregateDeaths = first.Deaths
-	}
+	aggregate := first.Cases
+	aggregateDeaths := first.Deaths
 	for _, cases := range history {
 		newCases := float64(cases.Cases - aggregate)
 		if newCases < 0 {
@@ -167,83 +72,47 @@ func (c *CountrySummary) Graph(month bool) (*bytes.Buffer, error) {
 		if newDeaths < 0 {
 			continue
 		}
-		totalDeaths = append([]float64{newDeaths}, totalDeaths...)
+		totalDeaths = append(totalDeaths, newDeaths)
 		aggregateDeaths = cases.Deaths
-		totalCases = append([]float64{newCases}, totalCases...)
+		totalCases = append(totalCases, newCases)
 		aggregate = cases.Cases
-		dates = append([]time.Time{cases.Date}, dates...)
+		dates = append(dates, cases.Date)
+	}
+	name := "cases"
+	if month {
+		name = "cases-month"
+	}
+	title := fmt.Sprintf("Cases per day for %s", c.Country)
+	if average {
+		totalCases = RollingAverage(totalCases, averageDays)
+		totalDeaths = RollingAverage(totalDeaths, averageDays)
+		title = fmt.Sprintf("7-day average cases per day for %s", c.Country)
 	}
 	graph := chart.Chart{
-		Canvas: chart.Style{
-			StrokeWidth: 0,
-			FillColor:   drawing.ColorFromHex("2f3136"),
-			Show:        true,
-		},
-
-		Background: chart.Style{
-			StrokeWidth: 0,
-			FillColor:   drawing.ColorFromHex("2f3136"),
-			Show:        true,
-		},
-		Title: fmt.Sprintf("Cases per day for %s", c.Country),
+		Title: title,
 		XAxis: chart.XAxis{
-			Name: "Date",
-			TickStyle: chart.Style{
-				StrokeWidth: 1,
-				StrokeColor: drawing.ColorFromHex("ffffff"),
-				FillColor:   drawing.ColorFromHex("2f3136"),
-				Show:        true,
-			},
-			Style: chart.Style{
-				FontColor: drawing.ColorFromHex("ffffff"),
-				FillColor: drawing.ColorFromHex("2f3136"),
-				Show:      true,
-			},
+			Name:           "Date",
 			ValueFormatter: chart.TimeDateValueFormatter,
 		},
 		YAxis: chart.YAxis{
 			Name:           "New Cases",
 			ValueFormatter: func(v interface{}) string { return chart.FloatValueFormatterWithFormat(v, "%.0f") },
-			TickStyle: chart.Style{
-				StrokeWidth: 1,
-				StrokeColor: drawing.ColorFromHex("ffffff"),
-				FillColor:   drawing.ColorFromHex("2f3136"),
-				Show:        true,
-			},
-			Style: chart.Style{
-				FontColor: drawing.ColorFromHex("ffffff"),
-				FillColor: drawing.ColorFromHex("2f3136"),
-				Show:      true,
-			},
 		},
 		Series: []chart.Series{
 			chart.TimeSeries{
-				Style: chart.Style{
-					StrokeWidth: 5,
-					StrokeColor: drawing.ColorFromHex("ffffff"),
-					FillColor:   drawing.ColorFromHex("2f3136"),
-					Show:        true,
-				},
+				Style:   charts.Line(charts.Foreground, 5),
 				XValues: dates,
 				YValues: totalCases,
 			},
 			chart.TimeSeries{
-				Style: chart.Style{
-					StrokeWidth: 2,
-					StrokeColor: drawing.ColorFromHex("ffffff"),
-					FillColor:   drawing.ColorFromHex("2f3136"),
-					Show:        true,
-				},
+				Style:   charts.Line(charts.Foreground, 2),
 				XValues: dates,
 				YValues: totalDeaths,
 			},
 		},
 	}
-	buffer := bytes.NewBuffer([]byte{})
-	if err = graph.Render(chart.PNG, buffer); err != nil {
-		return nil, err
-	}
-	return buffer, nil
+	charts.Dark(&graph)
+	return charts.Render(name, graph)
 }
 
 // TotalSummary contains global data.
@@ -262,31 +131,15 @@ func (t *TotalSummary) GetCountry(slug string) *CountrySummary {
 	return nil
 }
 
-// GetCorona give you corona.
-func GetCorona() (total *TotalSummary, err error, raw bytes.Buffer) {
-	var resp *http.Response
-	resp, err = http.Get(covidSummary)
-	if err != nil {
-		return
-	}
-	total = &TotalSummary{}
-	if err = json.NewDecoder(io.TeeReader(resp.Body, &raw)).Decode(total); err != nil {
-		return
-	}
-	temp := make(map[string]interface{})
-	for col, val := range total.Global {
-		if f, ok := val.(float64); ok {
-			temp[col] = int(f)
-		}
-	}
-	total.Global = temp
-	return
-}
-
-// CreateEmbed sends a corona embed to the specified channel.
-func CreateEmbed(country *CountrySummary, s *discordgo.Session, ctx context.Context) ([]*discordgo.MessageEmbed, error) {
+// CreateEmbed builds the corona embeds, along with the charts they show which must be sent with them.
+func CreateEmbed(country *CountrySummary, ctx context.Context, opts Options) ([]*discordgo.MessageEmbed, []*charts.Attachment, error) {
 	var embeds []*discordgo.MessageEmbed
 	title := "Covid-19 Stats for"
+	history, err := Data.History(ctx, country.Slug)
+	if err != nil {
+		log.WithError(err).WithContext(ctx).Error("Error occured getting history")
+		return nil, nil, errors.New("error occured getting history")
+	}
 	p := message.NewPrinter(language.English)
 	body := "**New**\n"
 	body += p.Sprintf("Cases: %d\n", country.NewConfirmed)
@@ -294,110 +147,74 @@ func CreateEmbed(country *CountrySummary, s *discordgo.Session, ctx context.Cont
 	body += "\n**Total**\n"
 	body += p.Sprintf("Cases: %d\n", country.TotalConfirmed)
 	body += p.Sprintf("Deaths: %d\n", country.TotalDeaths)
+	body += analysis(country, history, opts)
 
 	emb := embed.NewEmbed()
 	emb.SetTitle(strings.Join([]string{title, strings.Title(strings.ReplaceAll(country.Slug, "-", " "))}, " "))
 	emb.SetDescription(body)
 	emb.SetFooter(fmt.Sprintf("As of %s", country.Date.Format(layoutIE)))
 	emb.SetColor(0x9b12f1)
-	// Upload graph to freeimage.
-	graph, err := country.Graph(false)
+	graph, err := country.Graph(history, false, opts.Average)
 	if err != nil {
 		log.WithError(err).WithContext(ctx).Error("Error occured generating graph")
-		return nil, errors.New("error occured generating graph")
+		return nil, nil, errors.New("error occured generating graph")
 	}
-	img, err := upload(graph)
-	if err != nil {
-		log.WithError(err).WithContext(ctx).Error("Error occured uploading graph")
-		return nil, errors.New("error occured uploading graph")
-	}
-	emb.SetImage(img)
+	emb.SetImage(graph.URL())
 	embeds = append(embeds, emb.MessageEmbed)
 
 	// monthly graph embed
-	monthlyGraph, err := country.Graph(true)
+	monthlyGraph, err := country.Graph(history, true, opts.Average)
 	if err != nil {
 		log.WithError(err).WithContext(ctx).Error("Error occured generating graph")
-		return nil, errors.New("error occured generating graph")
-	}
-	monthlyImg, err := upload(monthlyGraph)
-	if err != nil {
-		log.WithError(err).WithContext(ctx).Error("Error occured uploading graph")
-		return nil, errors.New("error occured uploading graph")
+		return nil, nil, errors.New("error occured generating graph")
 	}
 	monthlyEmb := embed.NewEmbed()
-	monthlyEmb.SetImage(monthlyImg)
+	monthlyEmb.SetImage(monthlyGraph.URL())
 	monthlyEmb.SetTitle(fmt.Sprintf("Last 31 days cases for %s", strings.Title(strings.ReplaceAll(country.Slug, "-", " "))))
 	monthlyEmb.SetColor(0x9b12f1)
 	embeds = append(embeds, monthlyEmb.MessageEmbed)
-	return embeds, nil
+	return embeds, []*charts.Attachment{graph, monthlyGraph}, nil
 }
 
-func upload(b *bytes.Buffer) (string, error) {
-	img := dataurl.EncodeBytes(b.Bytes())
-	img = img[22:]
-	var apiKey string
-	if apiKey = viper.GetString("freeimage.key"); apiKey == "" {
-		return "", errors.New("No freeimage key")
-	}
-	resp, err := http.PostForm(imgHost, map[string][]string{
-		"key":    {apiKey},
-		"source": {img},
-	})
-	if err != nil {
-		return "", err
+// analysis is the extra sections of the embed asked for by the options
+func analysis(country *CountrySummary, history []CountryDaily, opts Options) string {
+	p := message.NewPrinter(language.English)
+	body := ""
+	if opts.Average && len(history) > 0 {
+		averages := AverageAt(history, len(history)-1)
+		body += "\n**7-day average**\n"
+		body += p.Sprintf("Cases: %.0f per day\n", averages.Cases)
+		body += p.Sprintf("Deaths: %.1f per day\n", averages.Deaths)
+	}
+	if opts.Per100k {
+		body += "\n**Per 100k people**\n"
+		if population, ok := CountryPopulation(country.Slug); ok && len(history) > 0 {
+			averages := AverageAt(history, len(history)-1)
+			body += p.Sprintf("Cases in the last 7 days: %.1f\n", Per100k(averages.Cases*averageDays, population))
+			body += p.Sprintf("Total cases: %.0f\n", Per100k(float64(country.TotalConfirmed), population))
+			body += p.Sprintf("Total deaths: %.1f\n", Per100k(float64(country.TotalDeaths), population))
+		} else {
+			body += "Population isn't known for this country\n"
+		}
 	}
-	imgResp := struct {
-		Image struct {
-			URL string `json:"url"`
-		} `json:"image"`
-	}{}
-	if err = json.NewDecoder(resp.Body).Decode(&imgResp); err != nil {
-		return "", err
+	if opts.CompareDays > 0 {
+		comparison, err := Compare(history, opts.CompareDays)
+		if err != nil {
+			body += fmt.Sprintf("\nThere isn't %d days of history to compare with\n", opts.CompareDays)
+			return body
+		}
+		body += fmt.Sprintf("\n**Since %s (%d days ago)**\n", comparison.Then.Date.Format(layoutIE), comparison.Days)
+		body += p.Sprintf("Cases: +%d\n", comparison.Now.Cases-comparison.Then.Cases)
+		body += p.Sprintf("Deaths: +%d\n", comparison.Now.Deaths-comparison.Then.Deaths)
+		body += p.Sprintf("7-day average cases: %.0f → %.0f%s\n", comparison.AverageThen.Cases, comparison.AverageNow.Cases, change(comparison.AverageThen.Cases, comparison.AverageNow.Cases))
+		body += p.Sprintf("7-day average deaths: %.1f → %.1f%s\n", comparison.AverageThen.Deaths, comparison.AverageNow.Deaths, change(comparison.AverageThen.Deaths, comparison.AverageNow.Deaths))
 	}
-	return imgResp.Image.URL, nil
+	return body
 }
 
-// Listen for new covid cases.
-func Listen(s *discordgo.Session) error {
-	channelID := viper.GetString("discord.public.corona")
-	for {
-		_, data, err := GetArcgis()
-		if err != nil {
-			log.WithError(err).Error("error occured listening for HSE corona updates")
-			time.Sleep(30 * time.Second)
-			continue
-		}
-		if currentDate == nil {
-			currentDate = &data.Date
-		} else if data.Date.Unix() > currentDate.Unix() {
-			// New data found.
-			currentDate = &data.Date
-			log.WithFields(log.Fields{"arcGis": *data}).Info("Found new COVID cases from the HSE")
-			s.ChannelMessageSend(channelID, "The HSE has released new case numbers for Ireland:")
-			coronaEmbeds, err := CreateEmbed(data, s, context.Background())
-			if err != nil {
-				s.ChannelMessageSend(channelID, err.Error())
-			} else {
-				for _, coronaEmbed := range coronaEmbeds {
-					s.ChannelMessageSendEmbed(channelID, coronaEmbed)
-				}
-			}
-		}
-		vaccines, err := GetVaccines()
-		if err != nil {
-			log.WithError(err).Error("error occured listening for HSE vaccine updates")
-			time.Sleep(30 * time.Second)
-			continue
-		}
-		if currentVaccines == nil {
-			currentVaccines = vaccines
-		} else if vaccines.Date.Unix() > currentVaccines.Date.Unix() {
-			// New vaccines found.
-			s.ChannelMessageSend(channelID, "The HSE has released new vaccine numbers for Ireland:")
-			s.ChannelMessageSendEmbed(channelID, vaccines.Embed(currentVaccines))
-			currentVaccines = vaccines
-		}
-		<-time.After(sleepTime)
+func change(a, b float64) string {
+	if percent, ok := percentChange(a, b); ok {
+		return fmt.Sprintf(" (%+.0f%%)", percent)
 	}
+	return ""
 }
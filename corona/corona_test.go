@@ -0,0 +1,239 @@
+package corona
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/charts"
+)
+
+func TestMain(m *testing.M) {
+	log.InitSimpleLogger(&log.Config{Output: io.Discard})
+	os.Exit(m.Run())
+}
+
+// useFixtures as the provider for the test
+func useFixtures(t *testing.T) Provider {
+	t.Helper()
+	previous := Data
+	Data = Fixtures()
+	t.Cleanup(func() { Data = previous })
+	return Data
+}
+
+func checkPNG(t *testing.T, attachment *charts.Attachment) {
+	t.Helper()
+	if !strings.HasSuffix(attachment.Name, ".png") || !bytes.HasPrefix(attachment.Data, []byte("\x89PNG\r\n\x1a\n")) {
+		t.Errorf("attachment %s isn't a PNG", attachment.Name)
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	ctx := context.Background()
+	data := useFixtures(t)
+	summary, err := data.Summary(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Countries) != 7 {
+		t.Errorf("got %d countries, want 7", len(summary.Countries))
+	}
+	if country := summary.FindCountry("United States of America"); country == nil || country.Slug != "united-states" {
+		t.Errorf("found %+v for the US", country)
+	}
+
+	// Ireland comes from the HPSC, the rest from covid19api
+	for _, slug := range []string{"ireland", "germany"} {
+		country, err := data.Country(ctx, slug)
+		if err != nil {
+			t.Fatalf("%s: %v", slug, err)
+		}
+		if country.Slug != slug || !country.Date.Equal(time.Date(2021, 9, 30, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: got %s as of %s", slug, country.Slug, country.Date)
+		}
+		history, err := data.History(ctx, slug)
+		if err != nil {
+			t.Fatalf("%s: %v", slug, err)
+		}
+		if len(history) != 90 || !history[0].Date.Before(history[89].Date) || history[89].Cases != country.TotalConfirmed {
+			t.Errorf("%s: %d days of history ending with %d cases, want 90 oldest first ending with %d", slug, len(history), history[len(history)-1].Cases, country.TotalConfirmed)
+		}
+	}
+
+	if _, err = data.Country(ctx, "narnia"); !errors.Is(err, ErrUnknownCountry) {
+		t.Errorf("unknown country got %v", err)
+	}
+	if _, err = data.History(ctx, "narnia"); err == nil {
+		t.Error("got history for an unknown country")
+	}
+}
+
+func TestCreateEmbed(t *testing.T) {
+	ctx := context.Background()
+	data := useFixtures(t)
+	tests := []struct {
+		slug  string
+		opts  Options
+		title string
+		want  []string
+	}{
+		{"ireland", Options{}, "Covid-19 Stats for Ireland", []string{"**New**\nCases: 948\nDeaths: 9\n", "**Total**\nCases: 390,313\nDeaths: 5,848\n"}},
+		{"united-kingdom", Options{Average: true, Per100k: true}, "Covid-19 Stats for United Kingdom", []string{"**7-day average**", "**Per 100k people**\nCases in the last 7 days: "}},
+		{"germany", Options{CompareDays: 7}, "Covid-19 Stats for Germany", []string{"**Since 23/09/21 (7 days ago)**", "7-day average cases: "}},
+		{"germany", Options{CompareDays: 365}, "Covid-19 Stats for Germany", []string{"There isn't 365 days of history to compare with"}},
+	}
+	for _, test := range tests {
+		t.Run(test.slug, func(t *testing.T) {
+			country, err := data.Country(ctx, test.slug)
+			if err != nil {
+				t.Fatal(err)
+			}
+			embeds, attachments, err := CreateEmbed(country, ctx, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(embeds) != 2 || len(attachments) != 2 {
+				t.Fatalf("got %d embeds and %d attachments, want 2 of each", len(embeds), len(attachments))
+			}
+			if embeds[0].Title != test.title {
+				t.Errorf("title %q, want %q", embeds[0].Title, test.title)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(embeds[0].Description, want) {
+					t.Errorf("description %q doesn't contain %q", embeds[0].Description, want)
+				}
+			}
+			if embeds[0].Footer.Text != "As of 30/09/21" {
+				t.Errorf("footer %q", embeds[0].Footer.Text)
+			}
+			// Each embed shows the chart sent with it
+			for idx, attachment := range attachments {
+				checkPNG(t, attachment)
+				if embeds[idx].Image.URL != attachment.URL() {
+					t.Errorf("embed %d shows %s, not %s", idx, embeds[idx].Image.URL, attachment.URL())
+				}
+			}
+		})
+	}
+}
+
+func TestGraph(t *testing.T) {
+	ctx := context.Background()
+	data := useFixtures(t)
+	country, err := data.Country(ctx, "france")
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := data.History(ctx, "france")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		month, average bool
+		name           string
+	}{{false, false, "cases"}, {true, false, "cases-month"}, {false, true, "cases"}, {true, true, "cases-month"}} {
+		graph, err := country.Graph(history, test.month, test.average)
+		if err != nil {
+			t.Fatalf("month %t, average %t: %v", test.month, test.average, err)
+		}
+		if !strings.HasPrefix(graph.Name, test.name+".") {
+			t.Errorf("month %t, average %t: named %s", test.month, test.average, graph.Name)
+		}
+		checkPNG(t, graph)
+	}
+	// A month needs 33 days, the day before the month and a day after it for the first new numbers
+	if _, err = country.Graph(history[:32], true, false); err == nil {
+		t.Error("graphed a month from 32 days")
+	}
+	if _, err = country.Graph(history[:1], false, false); err == nil {
+		t.Error("graphed a single day")
+	}
+}
+
+// countingProvider counts the histories fetched
+type countingProvider struct {
+	Provider
+	histories atomic.Int32
+}
+
+func (c *countingProvider) History(ctx context.Context, slug string) ([]CountryDaily, error) {
+	c.histories.Add(1)
+	return c.Provider.History(ctx, slug)
+}
+
+func TestRates(t *testing.T) {
+	ctx := context.Background()
+	counting := &countingProvider{Provider: useFixtures(t)}
+	Data = counting
+	summary, err := Data.Summary(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every fixture country can be compared
+	for _, country := range summary.Countries {
+		if _, ok := CountryPopulation(country.Slug); !ok {
+			t.Errorf("population of %s isn't known", country.Slug)
+		}
+	}
+
+	rates, err := Rates(ctx, summary.Countries[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 2 || counting.histories.Load() != 2 || rates[1].Country.Slug != summary.Countries[1].Slug || len(rates[1].Dates) < 2 {
+		t.Errorf("got %d rates from %d histories", len(rates), counting.histories.Load())
+	}
+
+	// Unknown populations are rejected before any history is fetched, wherever they are in the list
+	counting.histories.Store(0)
+	narnia := CountrySummary{CountryBase: CountryBase{Country: "Narnia"}, Slug: "narnia"}
+	if _, err = Rates(ctx, append(summary.Countries[:2:2], narnia)); err == nil || !strings.Contains(err.Error(), "Narnia") {
+		t.Errorf("got %v for an unknown population", err)
+	}
+	if counting.histories.Load() != 0 {
+		t.Errorf("fetched %d histories before rejecting the comparison", counting.histories.Load())
+	}
+}
+
+func TestVaccinesEmbed(t *testing.T) {
+	vaccines, err := useFixtures(t).Vaccines(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	emb := vaccines.Embed(nil)
+	for _, want := range []string{
+		"**First installment**: 3,650,000 (91.71% of 12+ population)",
+		"**Fully vaccinated**: 3,650,000 (91.71% of 12+ population)",
+		"**Total Administered**: 7,210,000",
+		"***J&J/Janssen***: 230,000",
+	} {
+		if !strings.Contains(emb.Description, want) {
+			t.Errorf("description %q doesn't contain %q", emb.Description, want)
+		}
+	}
+	if emb.Title != "Vaccines Rollout in Ireland" || emb.Footer.Text != "As of 30/09/21" {
+		t.Errorf("embed %q with footer %q", emb.Title, emb.Footer.Text)
+	}
+
+	prev := *vaccines
+	prev.First -= 12345
+	prev.Pfizer -= 1000
+	prev.Date = prev.Date.AddDate(0, 0, -1)
+	emb = vaccines.Embed(&prev)
+	for _, want := range []string{"**First installment**: 3,650,000 (+12,345)", "**Second installment**: 3,420,000 (+0)", "***Pfizer***: 5,200,000 (+1,000)"} {
+		if !strings.Contains(emb.Description, want) {
+			t.Errorf("description %q doesn't contain %q", emb.Description, want)
+		}
+	}
+	if emb.Footer.Text != "As of 30/09/21, compared with 29/09/21" {
+		t.Errorf("footer %q", emb.Footer.Text)
+	}
+}
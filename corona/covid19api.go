@@ -0,0 +1,101 @@
+package corona
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrUnknownCountry is returned when a provider has no data for a country
+var ErrUnknownCountry = errors.New("unknown country")
+
+// Covid19API provides global case numbers from api.covid19api.com
+type Covid19API struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// Summary implements Provider
+func (c *Covid19API) Summary(ctx context.Context) (*TotalSummary, error) {
+	total := &TotalSummary{}
+	if err := getJSON(ctx, c.Client, c.BaseURL+"/summary", total); err != nil {
+		return nil, err
+	}
+	temp := make(map[string]interface{})
+	for col, val := range total.Global {
+		if f, ok := val.(float64); ok {
+			temp[col] = int(f)
+		}
+	}
+	total.Global = temp
+	return total, nil
+}
+
+// Country implements Provider
+func (c *Covid19API) Country(ctx context.Context, slug string) (*CountrySummary, error) {
+	total, err := c.Summary(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if country := total.GetCountry(slug); country != nil {
+		return country, nil
+	}
+	return nil, ErrUnknownCountry
+}
+
+// History implements Provider
+func (c *Covid19API) History(ctx context.Context, slug string) ([]CountryDaily, error) {
+	days := []struct {
+		Country     string
+		CountryCode string
+		Confirmed   int
+		Deaths      int
+		Date        time.Time
+	}{}
+	if err := getJSON(ctx, c.Client, fmt.Sprintf("%s/total/dayone/country/%s", c.BaseURL, slug), &days); err != nil {
+		return nil, err
+	}
+	if len(days) == 0 {
+		return nil, ErrUnknownCountry
+	}
+	history := []CountryDaily{}
+	for _, day := range days {
+		history = append(history, CountryDaily{
+			CountryBase: CountryBase{Country: day.Country, CountryCode: day.CountryCode, Date: day.Date},
+			Cases:       day.Confirmed,
+			Deaths:      day.Deaths,
+		})
+	}
+	return history, nil
+}
+
+// Vaccines implements Provider
+func (c *Covid19API) Vaccines(ctx context.Context) (*Vaccines, error) {
+	return nil, errUnsupported
+}
+
+// RegisterWebhook asks covid19api to POST its summary to url whenever it updates
+func (c *Covid19API) RegisterWebhook(ctx context.Context, url string) error {
+	body, err := json.Marshal(struct{ URL string }{url})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/webhook", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook registration returned %s", resp.Status)
+	}
+	return nil
+}
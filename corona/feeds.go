@@ -0,0 +1,70 @@
+package corona
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/charts"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/UCCNetsoc/discord-bot/feeds"
+	"github.com/bwmarrin/discordgo"
+)
+
+// CasesSource is a feed of the HSE's daily case numbers for Ireland
+type CasesSource struct{}
+
+// Items implements feeds.Source
+func (CasesSource) Items(ctx context.Context) ([]feeds.Item, error) {
+	summary, err := Data.Country(ctx, config.GetString("corona.default"))
+	if err != nil {
+		return nil, err
+	}
+	return []feeds.Item{{
+		Version: strconv.FormatInt(summary.Date.Unix(), 10),
+		Message: func() (*discordgo.MessageSend, error) {
+			embeds, graphs, err := CreateEmbed(summary, ctx, Options{})
+			if err != nil {
+				return nil, err
+			}
+			return &discordgo.MessageSend{
+				Content: "The HSE has released new case numbers for Ireland:",
+				Embeds:  embeds,
+				Files:   charts.Files(graphs...),
+			}, nil
+		},
+	}}, nil
+}
+
+// VaccinesSource is a feed of the HSE's vaccine rollout numbers, compared to the previous snapshot stored
+type VaccinesSource struct{}
+
+// Items implements feeds.Source
+func (VaccinesSource) Items(ctx context.Context) ([]feeds.Item, error) {
+	vaccines, err := Data.Vaccines(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = SaveSnapshot(vaccines); err != nil {
+		log.WithError(err).Error("Failed to save vaccine snapshot")
+	}
+	return []feeds.Item{{
+		Version: strconv.FormatInt(vaccines.Date.Unix(), 10),
+		Message: func() (*discordgo.MessageSend, error) {
+			previous, err := SnapshotAt(vaccines.Date.Add(-time.Second))
+			if err != nil {
+				log.WithError(err).Error("Failed to get previous vaccine snapshot")
+			}
+			emb, graphs, err := VaccinesReport(vaccines, previous)
+			if err != nil {
+				log.WithError(err).Error("Failed to chart vaccine snapshots")
+			}
+			return &discordgo.MessageSend{
+				Content: "The HSE has released new vaccine numbers for Ireland:",
+				Embeds:  []*discordgo.MessageEmbed{emb},
+				Files:   charts.Files(graphs...),
+			}, nil
+		},
+	}}, nil
+}
@@ -0,0 +1,141 @@
+package corona
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ArcGIS queries, relative to the HPSC provider's base URLs
+const (
+	hpscCasesQuery        = "/CovidStatisticsProfileHPSCIrelandOpenData/FeatureServer/0/query?f=json&where=1%3D1&returnGeometry=false&spatialRel=esriSpatialRelIntersects&outFields=*&orderByFields=Date%20asc&resultOffset=0&resultRecordCount=32000&resultType=standard&cacheHint=true"
+	hpscVaccinesQuery     = "/Covid19_Vaccine_Administration_Hosted_View/FeatureServer/0/query?f=json&where=1=1&outFields=*&returnGeometry=false"
+	hpscVaccineTypesQuery = "/Covid19_Vaccine_Administration_VaccineTypeHostedView_V2/FeatureServer/0/query?f=json&where=1%3D1&outFields=*&returnGeometry=false"
+)
+
+// HPSC provides Ireland's case and vaccine numbers from the HPSC and HSE ArcGIS services
+type HPSC struct {
+	CasesURL    string
+	VaccinesURL string
+	Client      *http.Client
+}
+
+// Summary implements Provider
+func (h *HPSC) Summary(ctx context.Context) (*TotalSummary, error) {
+	country, err := h.Country(ctx, "ireland")
+	if err != nil {
+		return nil, err
+	}
+	return &TotalSummary{Global: map[string]interface{}{}, Countries: []CountrySummary{*country}}, nil
+}
+
+// Country implements Provider
+func (h *HPSC) Country(ctx context.Context, slug string) (*CountrySummary, error) {
+	_, summary, err := h.cases(ctx, slug)
+	return summary, err
+}
+
+// History implements Provider
+func (h *HPSC) History(ctx context.Context, slug string) ([]CountryDaily, error) {
+	daily, _, err := h.cases(ctx, slug)
+	return daily, err
+}
+
+func (h *HPSC) cases(ctx context.Context, slug string) (daily []CountryDaily, summary *CountrySummary, err error) {
+	if slug != "ireland" {
+		return nil, nil, ErrUnknownCountry
+	}
+	data := struct {
+		Features []struct {
+			Attributes struct {
+				Date                     int64
+				ConfirmedCovidCases      int
+				TotalConfirmedCovidCases int
+				ConfirmedCovidDeaths     int
+				TotalCovidDeaths         int
+			} `json:"attributes"`
+		} `json:"features"`
+	}{}
+	if err = getJSON(ctx, h.Client, h.CasesURL+hpscCasesQuery, &data); err != nil {
+		return
+	}
+	for _, attrs := range data.Features {
+		country := attrs.Attributes
+		daily = append(daily, CountryDaily{
+			CountryBase: CountryBase{
+				Date:        time.Unix(country.Date/1000, 0),
+				Country:     "Ireland",
+				CountryCode: "IE",
+			},
+			Cases:  country.TotalConfirmedCovidCases,
+			Deaths: country.TotalCovidDeaths,
+		})
+	}
+	if len(data.Features) == 0 {
+		return nil, nil, errors.New("No data received from arcgis")
+	}
+	last := data.Features[len(data.Features)-1].Attributes
+	summary = &CountrySummary{
+		CountryBase: CountryBase{
+			Country:     "Ireland",
+			CountryCode: "IE",
+			Date:        time.Unix(last.Date/1000, 0),
+		},
+		Slug:           "ireland",
+		NewConfirmed:   last.ConfirmedCovidCases,
+		NewDeaths:      last.ConfirmedCovidDeaths,
+		TotalConfirmed: last.TotalConfirmedCovidCases,
+		TotalDeaths:    last.TotalCovidDeaths,
+	}
+	return
+}
+
+// Vaccines implements Provider
+func (h *HPSC) Vaccines(ctx context.Context) (*Vaccines, error) {
+	vaccines := &struct {
+		Features []struct {
+			Attributes struct {
+				First   int `json:"firstDose"`
+				Second  int `json:"secondDose"`
+				Total   int `json:"totalAdministered"`
+				Date    int `json:"relDate"`
+				Pfizer  int `json:"pf"`
+				Moderna int `json:"modern"`
+				Az      int `json:"az"`
+			} `json:"attributes"`
+		} `json:"features"`
+	}{}
+	if err := getJSON(ctx, h.Client, h.VaccinesURL+hpscVaccinesQuery, vaccines); err != nil {
+		return nil, err
+	}
+	vaccineTypes := &struct {
+		Features []struct {
+			Attributes struct {
+				Date    int `json:"relDate"`
+				Pfizer  int `json:"pf"`
+				Moderna int `json:"modern"`
+				Az      int `json:"az"`
+				Janssen int `json:"janssen"`
+			} `json:"attributes"`
+		} `json:"features"`
+	}{}
+	if err := getJSON(ctx, h.Client, h.VaccinesURL+hpscVaccineTypesQuery, vaccineTypes); err != nil {
+		return nil, err
+	}
+
+	if len(vaccines.Features) < 1 || len(vaccineTypes.Features) < 1 {
+		return nil, errors.New("no features")
+	}
+	return &Vaccines{
+		First:       vaccines.Features[0].Attributes.First,
+		Second:      vaccines.Features[0].Attributes.Second,
+		Total:       vaccines.Features[0].Attributes.Second + vaccineTypes.Features[0].Attributes.Janssen,
+		TotalAdmin:  vaccines.Features[0].Attributes.Total,
+		Pfizer:      vaccineTypes.Features[0].Attributes.Pfizer,
+		Moderna:     vaccineTypes.Features[0].Attributes.Moderna,
+		AstraZeneca: vaccineTypes.Features[0].Attributes.Az,
+		Janssen:     vaccineTypes.Features[0].Attributes.Janssen,
+		Date:        time.Unix(int64(vaccines.Features[0].Attributes.Date)/1000, 0),
+	}, nil
+}
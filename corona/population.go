@@ -0,0 +1,200 @@
+package corona
+
+// Mid-2020 populations by covid19api slug, for per 100k rates
+var populations = map[string]int{
+	"afghanistan":                      38928346,
+	"albania":                          2877797,
+	"algeria":                          43851044,
+	"andorra":                          77265,
+	"angola":                           32866272,
+	"antigua-and-barbuda":              97929,
+	"argentina":                        45195774,
+	"armenia":                          2963243,
+	"australia":                        25499884,
+	"austria":                          9006398,
+	"azerbaijan":                       10139177,
+	"bahamas":                          393244,
+	"bahrain":                          1701575,
+	"bangladesh":                       164689383,
+	"barbados":                         287375,
+	"belarus":                          9449323,
+	"belgium":                          11589623,
+	"belize":                           397628,
+	"benin":                            12123200,
+	"bhutan":                           771608,
+	"bolivia":                          11673021,
+	"bosnia-and-herzegovina":           3280819,
+	"botswana":                         2351627,
+	"brazil":                           212559417,
+	"brunei":                           437479,
+	"bulgaria":                         6948445,
+	"burkina-faso":                     20903273,
+	"burundi":                          11890784,
+	"cambodia":                         16718965,
+	"cameroon":                         26545863,
+	"canada":                           37742154,
+	"cape-verde":                       555987,
+	"central-african-republic":         4829767,
+	"chad":                             16425864,
+	"chile":                            19116201,
+	"china":                            1439323776,
+	"colombia":                         50882891,
+	"comoros":                          869601,
+	"congo-brazzaville":                5518087,
+	"congo-kinshasa":                   89561403,
+	"costa-rica":                       5094118,
+	"cote-divoire":                     26378274,
+	"croatia":                          4105267,
+	"cuba":                             11326616,
+	"cyprus":                           1207359,
+	"czech-republic":                   10708981,
+	"denmark":                          5792202,
+	"djibouti":                         988000,
+	"dominica":                         71986,
+	"dominican-republic":               10847910,
+	"ecuador":                          17643054,
+	"egypt":                            102334404,
+	"el-salvador":                      6486205,
+	"equatorial-guinea":                1402985,
+	"eritrea":                          3546421,
+	"estonia":                          1326535,
+	"ethiopia":                         114963588,
+	"fiji":                             896445,
+	"finland":                          5540720,
+	"france":                           65273511,
+	"gabon":                            2225734,
+	"gambia":                           2416668,
+	"georgia":                          3989167,
+	"germany":                          83783942,
+	"ghana":                            31072940,
+	"greece":                           10423054,
+	"grenada":                          112523,
+	"guatemala":                        17915568,
+	"guinea":                           13132795,
+	"guinea-bissau":                    1968001,
+	"guyana":                           786552,
+	"haiti":                            11402528,
+	"holy-see-vatican-city-state":      801,
+	"honduras":                         9904607,
+	"hungary":                          9660351,
+	"iceland":                          341243,
+	"india":                            1380004385,
+	"indonesia":                        273523615,
+	"iran":                             83992949,
+	"iraq":                             40222493,
+	"ireland":                          4937786,
+	"israel":                           8655535,
+	"italy":                            60461826,
+	"jamaica":                          2961167,
+	"japan":                            126476461,
+	"jordan":                           10203134,
+	"kazakhstan":                       18776707,
+	"kenya":                            53771296,
+	"korea-south":                      51269185,
+	"kuwait":                           4270571,
+	"kyrgyzstan":                       6524195,
+	"lao-pdr":                          7275560,
+	"latvia":                           1886198,
+	"lebanon":                          6825445,
+	"lesotho":                          2142249,
+	"liberia":                          5057681,
+	"libya":                            6871292,
+	"liechtenstein":                    38128,
+	"lithuania":                        2722289,
+	"luxembourg":                       625978,
+	"macedonia":                        2083374,
+	"madagascar":                       27691018,
+	"malawi":                           19129952,
+	"malaysia":                         32365999,
+	"maldives":                         540544,
+	"mali":                             20250833,
+	"malta":                            441543,
+	"marshall-islands":                 59190,
+	"mauritania":                       4649658,
+	"mauritius":                        1271768,
+	"mexico":                           128932753,
+	"micronesia":                       548914,
+	"moldova":                          4033963,
+	"monaco":                           39242,
+	"mongolia":                         3278290,
+	"montenegro":                       628066,
+	"morocco":                          36910560,
+	"mozambique":                       31255435,
+	"myanmar":                          54409800,
+	"namibia":                          2540905,
+	"nepal":                            29136808,
+	"netherlands":                      17134872,
+	"new-zealand":                      4822233,
+	"nicaragua":                        6624554,
+	"niger":                            24206644,
+	"nigeria":                          206139589,
+	"norway":                           5421241,
+	"oman":                             5106626,
+	"pakistan":                         220892340,
+	"palestine":                        5101414,
+	"panama":                           4314767,
+	"papua-new-guinea":                 8947024,
+	"paraguay":                         7132538,
+	"peru":                             32971854,
+	"philippines":                      109581078,
+	"poland":                           37846611,
+	"portugal":                         10196709,
+	"qatar":                            2881053,
+	"romania":                          19237691,
+	"russia":                           145934462,
+	"rwanda":                           12952218,
+	"saint-kitts-and-nevis":            53199,
+	"saint-lucia":                      183627,
+	"saint-vincent-and-the-grenadines": 110940,
+	"samoa":                            198414,
+	"san-marino":                       33931,
+	"sao-tome-and-principe":            219159,
+	"saudi-arabia":                     34813871,
+	"senegal":                          16743927,
+	"serbia":                           8737371,
+	"seychelles":                       98347,
+	"sierra-leone":                     7976983,
+	"singapore":                        5850342,
+	"slovakia":                         5459642,
+	"slovenia":                         2078938,
+	"solomon-islands":                  686884,
+	"somalia":                          15893222,
+	"south-africa":                     59308690,
+	"south-sudan":                      11193725,
+	"spain":                            46754778,
+	"sri-lanka":                        21413249,
+	"sudan":                            43849260,
+	"suriname":                         586632,
+	"swaziland":                        1160164,
+	"sweden":                           10099265,
+	"switzerland":                      8654622,
+	"syria":                            17500658,
+	"taiwan":                           23816775,
+	"tajikistan":                       9537645,
+	"tanzania":                         59734218,
+	"thailand":                         69799978,
+	"timor-leste":                      1318445,
+	"togo":                             8278724,
+	"trinidad-and-tobago":              1399488,
+	"tunisia":                          11818619,
+	"turkey":                           84339067,
+	"uganda":                           45741007,
+	"ukraine":                          43733762,
+	"united-arab-emirates":             9890402,
+	"united-kingdom":                   67886011,
+	"united-states":                    331002651,
+	"uruguay":                          3473730,
+	"uzbekistan":                       33469203,
+	"vanuatu":                          307145,
+	"venezuela-bolivarian":             28435940,
+	"viet-nam":                         97338579,
+	"yemen":                            29825964,
+	"zambia":                           18383955,
+	"zimbabwe":                         14862924,
+}
+
+// CountryPopulation for a covid19api slug, false when it isn't known
+func CountryPopulation(slug string) (int, bool) {
+	population, ok := populations[slug]
+	return population, ok
+}
@@ -0,0 +1,116 @@
+package corona
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/UCCNetsoc/discord-bot/config"
+)
+
+// errUnsupported is returned by providers which don't have a kind of data
+var errUnsupported = errors.New("not provided by this source")
+
+// Provider is a source of case and vaccine data
+type Provider interface {
+	// Summary is the latest numbers for every country
+	Summary(ctx context.Context) (*TotalSummary, error)
+	// Country is the latest numbers for one country
+	Country(ctx context.Context, slug string) (*CountrySummary, error)
+	// History is a country's cumulative daily numbers, oldest first
+	History(ctx context.Context, slug string) ([]CountryDaily, error)
+	// Vaccines is the latest rollout numbers for Ireland
+	Vaccines(ctx context.Context) (*Vaccines, error)
+}
+
+// Data is the provider used by the bot, set up by Configure
+var Data Provider
+
+// Configure chooses the provider from corona.provider, either http or fixtures
+func Configure() error {
+	switch config.GetString("corona.provider") {
+	case "http":
+		Data = &Combined{
+			Global: &Covid19API{
+				BaseURL: config.GetString("corona.covid19api.url"),
+				Client:  newClient(config.GetBool("corona.covid19api.insecure"), nil),
+			},
+			Local: &HPSC{
+				CasesURL:    config.GetString("corona.hpsc.cases_url"),
+				VaccinesURL: config.GetString("corona.hpsc.vaccines_url"),
+				Client:      newClient(config.GetBool("corona.hpsc.insecure"), nil),
+			},
+			LocalSlug: config.GetString("corona.default"),
+		}
+	case "fixtures":
+		Data = Fixtures()
+	default:
+		return fmt.Errorf("unknown corona provider %q", config.GetString("corona.provider"))
+	}
+	return nil
+}
+
+// newClient for a single provider, so skipping TLS verification for one doesn't affect the rest of the bot
+func newClient(insecure bool, transport http.RoundTripper) *http.Client {
+	if transport == nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		if insecure {
+			t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+		transport = t
+	}
+	return &http.Client{Timeout: 30 * time.Second, Transport: transport}
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Combined uses a local provider for one country and the global provider for the rest
+type Combined struct {
+	Global    Provider
+	Local     Provider
+	LocalSlug string
+}
+
+// Summary implements Provider
+func (c *Combined) Summary(ctx context.Context) (*TotalSummary, error) {
+	return c.Global.Summary(ctx)
+}
+
+// Country implements Provider
+func (c *Combined) Country(ctx context.Context, slug string) (*CountrySummary, error) {
+	if slug == c.LocalSlug {
+		return c.Local.Country(ctx, slug)
+	}
+	return c.Global.Country(ctx, slug)
+}
+
+// History implements Provider
+func (c *Combined) History(ctx context.Context, slug string) ([]CountryDaily, error) {
+	if slug == c.LocalSlug {
+		return c.Local.History(ctx, slug)
+	}
+	return c.Global.History(ctx, slug)
+}
+
+// Vaccines implements Provider
+func (c *Combined) Vaccines(ctx context.Context) (*Vaccines, error) {
+	return c.Local.Vaccines(ctx)
+}
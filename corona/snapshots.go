@@ -0,0 +1,120 @@
+package corona
+
+import (
+	"time"
+
+	"github.com/UCCNetsoc/discord-bot/charts"
+	"github.com/UCCNetsoc/discord-bot/store"
+	"github.com/bwmarrin/discordgo"
+	"github.com/wcharczuk/go-chart"
+	"github.com/wcharczuk/go-chart/drawing"
+)
+
+// How far back the vaccine chart goes
+const snapshotChartDays = 90
+
+// CreateTables for the vaccine snapshots
+func CreateTables() error {
+	return store.CreateTables(
+		"CREATE TABLE IF NOT EXISTS vaccine_snapshots(reported_at TIMESTAMPTZ PRIMARY KEY, first INT NOT NULL, second INT NOT NULL, total INT NOT NULL, total_admin INT NOT NULL, pfizer INT NOT NULL, moderna INT NOT NULL, astrazeneca INT NOT NULL, janssen INT NOT NULL);",
+	)
+}
+
+// SaveSnapshot stores the numbers from an HSE update, the HSE updates once a day
+func SaveSnapshot(v *Vaccines) error {
+	_, err := store.DB.Exec(
+		`INSERT INTO vaccine_snapshots(reported_at, first, second, total, total_admin, pfizer, moderna, astrazeneca, janssen) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (reported_at) DO UPDATE SET first = $2, second = $3, total = $4, total_admin = $5, pfizer = $6, moderna = $7, astrazeneca = $8, janssen = $9;`,
+		v.Date, v.First, v.Second, v.Total, v.TotalAdmin, v.Pfizer, v.Moderna, v.AstraZeneca, v.Janssen,
+	)
+	return err
+}
+
+// SnapshotAt is the latest snapshot reported at or before t, nil if there isn't one
+func SnapshotAt(t time.Time) (*Vaccines, error) {
+	snapshots, err := querySnapshots("SELECT reported_at, first, second, total, total_admin, pfizer, moderna, astrazeneca, janssen FROM vaccine_snapshots WHERE reported_at <= $1 ORDER BY reported_at DESC LIMIT 1;", t)
+	if err != nil || len(snapshots) == 0 {
+		return nil, err
+	}
+	return &snapshots[0], nil
+}
+
+// Snapshots reported since t, oldest first
+func Snapshots(since time.Time) ([]Vaccines, error) {
+	return querySnapshots("SELECT reported_at, first, second, total, total_admin, pfizer, moderna, astrazeneca, janssen FROM vaccine_snapshots WHERE reported_at >= $1 ORDER BY reported_at;", since)
+}
+
+func querySnapshots(query string, args ...interface{}) ([]Vaccines, error) {
+	rows, err := store.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	snapshots := []Vaccines{}
+	for rows.Next() {
+		v := Vaccines{}
+		if err = rows.Scan(&v.Date, &v.First, &v.Second, &v.Total, &v.TotalAdmin, &v.Pfizer, &v.Moderna, &v.AstraZeneca, &v.Janssen); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, v)
+	}
+	return snapshots, rows.Err()
+}
+
+// VaccinesReport is the rollout embed compared with prev, with a chart of uptake once there are enough snapshots
+func VaccinesReport(v, prev *Vaccines) (*discordgo.MessageEmbed, []*charts.Attachment, error) {
+	emb := v.Embed(prev)
+	snapshots, err := Snapshots(v.Date.AddDate(0, 0, -snapshotChartDays))
+	if err != nil {
+		return emb, nil, err
+	}
+	if len(snapshots) < 2 {
+		return emb, nil, nil
+	}
+	graph, err := VaccinesGraph(snapshots)
+	if err != nil {
+		return emb, nil, err
+	}
+	emb.Image = &discordgo.MessageEmbedImage{URL: graph.URL()}
+	return emb, []*charts.Attachment{graph}, nil
+}
+
+// VaccinesGraph plots the share of the 12+ population with a first dose and fully vaccinated
+func VaccinesGraph(snapshots []Vaccines) (*charts.Attachment, error) {
+	dates := []time.Time{}
+	first := []float64{}
+	full := []float64{}
+	for _, snapshot := range snapshots {
+		dates = append(dates, snapshot.Date)
+		first = append(first, float64(snapshot.First)/Population*100)
+		full = append(full, float64(snapshot.Total)/Population*100)
+	}
+	graph := chart.Chart{
+		Title: "Vaccine uptake in Ireland",
+		XAxis: chart.XAxis{
+			Name:           "Date",
+			ValueFormatter: chart.TimeDateValueFormatter,
+		},
+		YAxis: chart.YAxis{
+			Name:           "% of 12+ population",
+			ValueFormatter: func(v interface{}) string { return chart.FloatValueFormatterWithFormat(v, "%.0f%%") },
+		},
+		Series: []chart.Series{
+			chart.TimeSeries{
+				Name:    "First dose",
+				Style:   charts.Line(drawing.ColorFromHex("9b12f1"), 3),
+				XValues: dates,
+				YValues: first,
+			},
+			chart.TimeSeries{
+				Name:    "Fully vaccinated",
+				Style:   charts.Line(charts.Foreground, 3),
+				XValues: dates,
+				YValues: full,
+			},
+		},
+	}
+	charts.Dark(&graph)
+	graph.Elements = []chart.Renderable{chart.Legend(&graph)}
+	return charts.Render("vaccines", graph)
+}
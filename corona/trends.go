@@ -0,0 +1,115 @@
+package corona
+
+import (
+	"errors"
+	"time"
+)
+
+// Options for the extra analysis shown by CreateEmbed
+type Options struct {
+	// CompareDays compares the latest numbers with those this many days earlier, 0 to skip
+	CompareDays int
+	// Average plots and shows 7-day rolling averages rather than single days
+	Average bool
+	// Per100k shows rates per 100,000 people, when the country's population is known
+	Per100k bool
+}
+
+// Window of the rolling averages
+const averageDays = 7
+
+// Averages are mean new cases and deaths per day
+type Averages struct {
+	Cases  float64
+	Deaths float64
+}
+
+// Comparison of a country's cumulative numbers now and some days earlier
+type Comparison struct {
+	Days        int
+	Then        CountryDaily
+	Now         CountryDaily
+	AverageThen Averages
+	AverageNow  Averages
+}
+
+// Daily converts cumulative history into new cases and deaths per day.
+// Corrections which lower the totals are treated as no new cases that day.
+func Daily(history []CountryDaily) []CountryDaily {
+	daily := []CountryDaily{}
+	for idx := 1; idx < len(history); idx++ {
+		day := CountryDaily{
+			CountryBase: history[idx].CountryBase,
+			Cases:       max(history[idx].Cases-history[idx-1].Cases, 0),
+			Deaths:      max(history[idx].Deaths-history[idx-1].Deaths, 0),
+		}
+		daily = append(daily, day)
+	}
+	return daily
+}
+
+// RollingAverage of each value and the window-1 values before it, over fewer values at the start
+func RollingAverage(values []float64, window int) []float64 {
+	averages := make([]float64, len(values))
+	sum := 0.0
+	for idx, value := range values {
+		sum += value
+		if idx >= window {
+			sum -= values[idx-window]
+		}
+		averages[idx] = sum / float64(min(idx+1, window))
+	}
+	return averages
+}
+
+// AverageAt is the 7-day average of new cases and deaths up to history[idx]
+func AverageAt(history []CountryDaily, idx int) Averages {
+	start := max(idx-averageDays, 0)
+	days := float64(idx - start)
+	if days == 0 {
+		return Averages{}
+	}
+	return Averages{
+		Cases:  float64(max(history[idx].Cases-history[start].Cases, 0)) / days,
+		Deaths: float64(max(history[idx].Deaths-history[start].Deaths, 0)) / days,
+	}
+}
+
+// Compare the latest day of the history with the day the given number of days before it
+func Compare(history []CountryDaily, days int) (*Comparison, error) {
+	if len(history) == 0 {
+		return nil, errors.New("no history")
+	}
+	last := len(history) - 1
+	target := history[last].Date.AddDate(0, 0, -days)
+	then := -1
+	for idx := last; idx >= 0; idx-- {
+		if !history[idx].Date.After(target.Add(12 * time.Hour)) {
+			then = idx
+			break
+		}
+	}
+	if then == -1 {
+		return nil, errors.New("not enough history to compare with")
+	}
+	return &Comparison{
+		Days:        days,
+		Then:        history[then],
+		Now:         history[last],
+		AverageThen: AverageAt(history, then),
+		AverageNow:  AverageAt(history, last),
+	}, nil
+}
+
+// Per100k is a count per 100,000 people
+func Per100k(count float64, population int) float64 {
+	return count / float64(population) * 100000
+}
+
+// percentChange from a to b, false when a is 0
+func percentChange(a, b float64) (float64, bool) {
+	if a == 0 {
+		return 0, false
+	}
+	return (b - a) / a * 100, true
+}
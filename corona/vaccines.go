@@ -1,11 +1,8 @@
 package corona
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
 	"math"
-	"net/http"
 	"time"
 
 	"github.com/UCCNetsoc/discord-bot/embed"
@@ -80,62 +77,9 @@ func (v *Vaccines) Embed(prev *Vaccines) *discordgo.MessageEmbed {
 			v.Janssen, int64(math.Abs(float64(v.Janssen-prev.Janssen))),
 		)
 	}
-	return embed.NewEmbed().SetTitle("Vaccines Rollout in Ireland").SetDescription(description).SetFooter(fmt.Sprintf("As of %s", v.Date.Format(layoutIE))).MessageEmbed
-}
-
-// GetVaccines will query HSE arcGIS and return vaccine stats.
-func GetVaccines() (*Vaccines, error) {
-	resp, err := http.Get(covidVaccines)
-	if err != nil {
-		return nil, err
-	}
-	vaccines := &struct {
-		Features []struct {
-			Attributes struct {
-				First   int `json:"firstDose"`
-				Second  int `json:"secondDose"`
-				Total   int `json:"totalAdministered"`
-				Date    int `json:"relDate"`
-				Pfizer  int `json:"pf"`
-				Moderna int `json:"modern"`
-				Az      int `json:"az"`
-			} `json:"attributes"`
-		} `json:"features"`
-	}{}
-	if err = json.NewDecoder(resp.Body).Decode(vaccines); err != nil {
-		return nil, err
-	}
-	respTypes, err := http.Get(covidVaccinesType)
-	if err != nil {
-		return nil, err
-	}
-	vaccineTypes := &struct {
-		Features []struct {
-			Attributes struct {
-				Date    int `json:"relDate"`
-				Pfizer  int `json:"pf"`
-				Moderna int `json:"modern"`
-				Az      int `json:"az"`
-				Janssen int `json:"janssen"`
-			} `json:"attributes"`
-		} `json:"features"`
-	}{}
-	if err = json.NewDecoder(respTypes.Body).Decode(vaccineTypes); err != nil {
-		return nil, err
-	}
-
-	if len(vaccines.Features) < 1 || len(vaccineTypes.Features) < 1 {
-		return nil, errors.New("no features")
+	footer := fmt.Sprintf("As of %s", v.Date.Format(layoutIE))
+	if prev != nil {
+		footer += fmt.Sprintf(", compared with %s", prev.Date.Format(layoutIE))
 	}
-	return &Vaccines{
-		First:       vaccines.Features[0].Attributes.First,
-		Second:      vaccines.Features[0].Attributes.Second,
-		Total:       vaccines.Features[0].Attributes.Second + vaccineTypes.Features[0].Attributes.Janssen,
-		TotalAdmin:  vaccines.Features[0].Attributes.Total,
-		Pfizer:      vaccineTypes.Features[0].Attributes.Pfizer,
-		Moderna:     vaccineTypes.Features[0].Attributes.Moderna,
-		AstraZeneca: vaccineTypes.Features[0].Attributes.Az,
-		Janssen:     vaccineTypes.Features[0].Attributes.Janssen,
-		Date:        time.Unix(int64(vaccines.Features[0].Attributes.Date)/1000, 0),
-	}, nil
+	return embed.NewEmbed().SetTitle("Vaccines Rollout in Ireland").SetDescription(description).SetFooter(footer).MessageEmbed
 }
@@ -1,19 +1,85 @@
 package emails
 
 import (
-	"github.com/sendgrid/rest"
+	"fmt"
+
+	"github.com/UCCNetsoc/discord-bot/config"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
-	"github.com/spf13/viper"
 )
 
+// Message is a single email with plain text and HTML bodies
+type Message struct {
+	FromName string
+	From     string
+	ToName   string
+	To       string
+	Subject  string
+	Text     string
+	HTML     string
+	Headers  map[string]string
+}
+
+// Mailer is a backend capable of sending email
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// Backend returns the mailer selected by email.backend
+func Backend() (Mailer, error) {
+	switch backend := config.GetString("email.backend"); backend {
+	case "sendgrid":
+		return &SendGrid{Token: config.GetString("sendgrid.token")}, nil
+	case "smtp":
+		return &SMTP{
+			Host:     config.GetString("email.smtp.host"),
+			Port:     config.GetInt("email.smtp.port"),
+			Username: config.GetString("email.smtp.username"),
+			Password: config.GetString("email.smtp.password"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown email backend %q", backend)
+	}
+}
+
 // SendEmail to end user.
-func SendEmail(fromName, from, toName, to, subject, content, htmlContent string) (*rest.Response, error) {
-	fromAddress := mail.NewEmail(fromName, from)
-	toAddress := mail.NewEmail(toName, to)
-	message := mail.NewSingleEmail(fromAddress, subject, toAddress, content, htmlContent)
+func SendEmail(fromName, from, toName, to, subject, content, htmlContent string) error {
+	mailer, err := Backend()
+	if err != nil {
+		return err
+	}
+	return mailer.Send(&Message{
+		FromName: fromName,
+		From:     from,
+		ToName:   toName,
+		To:       to,
+		Subject:  subject,
+		Text:     content,
+		HTML:     htmlContent,
+	})
+}
+
+// SendGrid sends email through the SendGrid API
+type SendGrid struct {
+	Token string
+}
+
+// Send implements Mailer
+func (s *SendGrid) Send(msg *Message) error {
+	fromAddress := mail.NewEmail(msg.FromName, msg.From)
+	toAddress := mail.NewEmail(msg.ToName, msg.To)
+	message := mail.NewSingleEmail(fromAddress, msg.Subject, toAddress, msg.Text, msg.HTML)
 	message.SetReplyTo(fromAddress)
-	client := sendgrid.NewSendClient(viper.GetString("sendgrid.token"))
+	for k, v := range msg.Headers {
+		message.SetHeader(k, v)
+	}
+	client := sendgrid.NewSendClient(s.Token)
 	response, err := client.Send(message)
-	return response, err
+	if err != nil {
+		return err
+	}
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("sendgrid returned %d: %s", response.StatusCode, response.Body)
+	}
+	return nil
 }
@@ -0,0 +1,160 @@
+package emails
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// cssRule is a single rule from an inlined style block.
+// Only element, class and element.class selectors are supported, which is all the templates use.
+type cssRule struct {
+	tag          string
+	class        string
+	declarations string
+	order        int
+}
+
+func (r cssRule) specificity() int {
+	s := 0
+	if r.tag != "" {
+		s++
+	}
+	if r.class != "" {
+		s += 10
+	}
+	return s
+}
+
+func (r cssRule) matches(n *html.Node) bool {
+	if r.tag != "" && n.Data != r.tag {
+		return false
+	}
+	if r.class == "" {
+		return true
+	}
+	for _, class := range strings.Fields(attr(n, "class")) {
+		if class == r.class {
+			return true
+		}
+	}
+	return false
+}
+
+// inlineCSS moves the rules of <style data-inline> blocks onto the style attribute of every matching element,
+// since many mail clients drop style blocks. Existing style attributes take precedence.
+func inlineCSS(doc string) (string, error) {
+	root, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		return "", err
+	}
+
+	rules := []cssRule{}
+	styles := []*html.Node{}
+	walk(root, func(n *html.Node) bool {
+		if n.Type == html.ElementNode && n.Data == "style" && hasAttr(n, "data-inline") {
+			styles = append(styles, n)
+			if n.FirstChild != nil {
+				rules = append(rules, parseCSS(n.FirstChild.Data, len(rules))...)
+			}
+			return false
+		}
+		return true
+	})
+	for _, style := range styles {
+		style.Parent.RemoveChild(style)
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].specificity() != rules[j].specificity() {
+			return rules[i].specificity() < rules[j].specificity()
+		}
+		return rules[i].order < rules[j].order
+	})
+
+	walk(root, func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return true
+		}
+		declarations := []string{}
+		for _, rule := range rules {
+			if rule.matches(n) {
+				declarations = append(declarations, rule.declarations)
+			}
+		}
+		if existing := strings.TrimSpace(attr(n, "style")); existing != "" {
+			declarations = append(declarations, strings.TrimSuffix(existing, ";"))
+		}
+		if len(declarations) > 0 {
+			setAttr(n, "style", strings.Join(declarations, "; ")+";")
+		}
+		return true
+	})
+
+	b := &strings.Builder{}
+	if err := html.Render(b, root); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func parseCSS(css string, order int) []cssRule {
+	rules := []cssRule{}
+	for _, block := range strings.Split(css, "}") {
+		selectors, body, ok := strings.Cut(block, "{")
+		if !ok {
+			continue
+		}
+		declarations := strings.TrimSuffix(strings.TrimSpace(body), ";")
+		for _, selector := range strings.Split(selectors, ",") {
+			tag, class, _ := strings.Cut(strings.TrimSpace(selector), ".")
+			if tag == "" && class == "" {
+				continue
+			}
+			rules = append(rules, cssRule{tag: tag, class: class, declarations: declarations, order: order})
+			order++
+		}
+	}
+	return rules
+}
+
+// walk visits every node depth first, descending only while visit returns true
+func walk(n *html.Node, visit func(*html.Node) bool) {
+	if !visit(n) {
+		return
+	}
+	for child := n.FirstChild; child != nil; {
+		// visit may detach the child
+		next := child.NextSibling
+		walk(child, visit)
+		child = next
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
@@ -0,0 +1,163 @@
+package emails
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// smtpSink accepts mail on a local port, sending each message it receives to the returned channel
+func smtpSink(t *testing.T) (string, int, <-chan []byte) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	messages := make(chan []byte, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return host, portNumber, messages
+}
+
+func serveSMTP(conn net.Conn, messages chan<- []byte) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 sink ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch command := strings.ToUpper(strings.Fields(line + " ")[0]); command {
+		case "EHLO", "HELO", "MAIL", "RCPT", "RSET", "NOOP":
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			data := []byte{}
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data = append(data, strings.TrimPrefix(line, ".")...)
+			}
+			messages <- data
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPUnsubscribeRoundTrip(t *testing.T) {
+	viper.Set("newsletter.secret", "test secret")
+	viper.Set("api.public_url", "https://discord.netsoc.co/")
+	t.Cleanup(viper.Reset)
+
+	host, port, messages := smtpSink(t)
+	mailer := &SMTP{Host: host, Port: port}
+	unsubscribe, err := UnsubscribeURL("Member@UMail.ucc.ie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mailer.Send(&Message{
+		FromName: "UCC Netsoc",
+		From:     "newsletter@netsoc.co",
+		To:       "member@umail.ucc.ie",
+		Subject:  "Netsoc Newsletter – Week 1",
+		Text:     "Hello\nUnsubscribe: " + unsubscribe,
+		HTML:     `<p>Hello</p><a href="` + unsubscribe + `">Unsubscribe</a>`,
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribe + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(<-messages)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Netsoc Newsletter – Week 1" {
+		t.Errorf("subject %q, %v", subject, err)
+	}
+	if to := msg.Header.Get("To"); to != "<member@umail.ucc.ie>" {
+		t.Errorf("to %q", to)
+	}
+
+	// The link in the header is the one in the text body, and its token unsubscribes the recipient
+	header := strings.Trim(msg.Header.Get("List-Unsubscribe"), "<>")
+	if header != unsubscribe {
+		t.Errorf("List-Unsubscribe %q, want %q", header, unsubscribe)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	text, err := parts.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(quotedprintable.NewReader(text))
+	if !strings.Contains(string(body), unsubscribe) {
+		t.Errorf("text body %q doesn't link to %s", body, unsubscribe)
+	}
+	link, err := url.Parse(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Host != "discord.netsoc.co" || link.Path != "/newsletter/unsubscribe" {
+		t.Errorf("unsubscribe link %s", link)
+	}
+	token := link.Query().Get("token")
+	if email, ok := VerifyUnsubscribeToken(token); !ok || email != "member@umail.ucc.ie" {
+		t.Errorf("token verified as %q, %t", email, ok)
+	}
+
+	// Tampered tokens and tokens signed with another secret are rejected
+	if _, ok := VerifyUnsubscribeToken("b3RoZXJAdW1haWwudWNjLmll" + token[strings.Index(token, "."):]); ok {
+		t.Error("token for another address verified")
+	}
+	viper.Set("newsletter.secret", "rotated")
+	if _, ok := VerifyUnsubscribeToken(token); ok {
+		t.Error("token verified with a different secret")
+	}
+	viper.Set("newsletter.secret", "")
+	if _, ok := VerifyUnsubscribeToken(token); ok {
+		t.Error("token verified without a secret")
+	}
+	if _, err = UnsubscribeToken("member@umail.ucc.ie"); err != ErrNoSecret {
+		t.Errorf("signed a token without a secret: %v", err)
+	}
+}
@@ -1,49 +1,112 @@
 package emails
 
-import "fmt"
-
-const template = `
-<!DOCTYPE html>
-<html>
-    <head>
-        <meta charset="utf-8">
-        <meta name="viewport" content="width=device-width">
-        <style>
-                @import url('https://fonts.googleapis.com/css2?family=Roboto:wght@100;300;400;500;700;900&display=swap');
-
-                html, body {
-                        margin: 0;
-                        padding: 0;
-                        font-size: 14px;
-                        font-weight: 400;
-                        font-family: 'Roboto', sans-serif !important;
-                        color: white;
-                        overflow-x: hidden;
-                }
-        </style>
-    </head>
-    <body style="margin: 0 auto;padding: 0;font-size: 14px;font-weight: 400 !important;color: white;overflow-x: hidden;font-family: 'Roboto', sans-serif !important;">
-        <div id="body" style="margin: 0 auto;background-color: rgb(33,33,33);height: 100%%;position: absolute;width: 100%%;">
-            <div id="kc-header" class="" style="height: 64px;background-color: #2196F3;position: relative;z-index: 2;box-shadow: 0px 0px 8px rgba(0,0,0,0.35);margin: 0 auto;">
-                <div id="kc-header-wrapper" class="" style="position: relative;height: 64px;display: block;text-align: center;">
-                        <img src="https://raw.githubusercontent.com/UCCNetsoc/wiki/master/assets/logo-horizontal-inverted.png" style="height: 32px;margin: 16px auto;padding: 0;">
-                </div>
-            </div>
-			<h1 style="color: white; font-size: 18px;font-weight: 200;text-align: center;padding: 8px 0;">
-				%s
-            </h1>
-            <div style="max-width: 460px; margin: 1em auto">
-                <p style="border-top: 1px solid rgb(55,55,55);border-bottom: 1px solid rgb(55,55,55);color: white;text-align: center;max-width: 500px;color: #fff;padding: 1em;">
-                    %s
-                </p>
-				<div style="background-color: #111;max-width: max-content; margin: 10px auto 15px auto;padding: 10px; border-left: #2196F3 solid 4px;">%s</div>
-            </div>
-        </div>
-    </body>
-</html>
-`
-
-// FillTemplate for custom email.
-func FillTemplate(header, paragraph, code string) string {
-	return fmt.Sprintf(template, header, paragraph, code)
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	"html/template"
+	"sort"
+	"strings"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+// Named templates
+const (
+	VerificationTemplate  = "verification"
+	NewsletterTemplate    = "newsletter"
+	EventReminderTemplate = "event_reminder"
+)
+
+// VerificationData fills the verification template
+type VerificationData struct {
+	Code    string
+	Expires string
+}
+
+// NewsletterData fills the newsletter template
+type NewsletterData struct {
+	Subject        string
+	Content        string
+	ImageURL       string
+	UnsubscribeURL string
+}
+
+// EventReminderData fills the event reminder template
+type EventReminderData struct {
+	Title       string
+	Description string
+	When        string
+	Duration    string
+	ImageURL    string
+	URL         string
+}
+
+// Rendered is a template ready to be sent
+type Rendered struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+var (
+	templateFuncs = template.FuncMap{
+		"lines": func(s string) []string {
+			return strings.Split(strings.TrimSpace(s), "\n")
+		},
+	}
+	templates = mustParseTemplates()
+)
+
+// Every named template is parsed together with the shared layout
+func mustParseTemplates() map[string]*template.Template {
+	layout := template.Must(template.New("layout.html").Funcs(templateFuncs).ParseFS(templateFiles, "templates/layout.html"))
+	names := []string{VerificationTemplate, NewsletterTemplate, EventReminderTemplate}
+	parsed := map[string]*template.Template{}
+	for _, name := range names {
+		clone := template.Must(layout.Clone())
+		parsed[name] = template.Must(clone.ParseFS(templateFiles, "templates/"+name+".html"))
+	}
+	return parsed
+}
+
+// Templates lists the names of every available template
+func Templates() []string {
+	names := []string{}
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render fills the named template, inlining its CSS and generating the plain text alternative
+func Render(name string, data interface{}) (*Rendered, error) {
+	tmpl, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+	subject := &bytes.Buffer{}
+	if err := tmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, err
+	}
+	body := &bytes.Buffer{}
+	if err := tmpl.ExecuteTemplate(body, "layout", data); err != nil {
+		return nil, err
+	}
+	doc, err := inlineCSS(body.String())
+	if err != nil {
+		return nil, err
+	}
+	text, err := plainText(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &Rendered{
+		Subject: html.UnescapeString(strings.TrimSpace(subject.String())),
+		HTML:    doc,
+		Text:    text,
+	}, nil
 }
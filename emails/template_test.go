@@ -0,0 +1,147 @@
+package emails
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderEscapesContent(t *testing.T) {
+	rendered, err := Render(NewsletterTemplate, NewsletterData{
+		Subject:        `Tom & Jerry's <b>night</b>`,
+		Content:        "<script>alert('hi')</script>\nSecond <a href=\"https://evil.example\">line</a>",
+		ImageURL:       `javascript:alert(1)`,
+		UnsubscribeURL: "https://discord.netsoc.co/newsletter/unsubscribe?token=a&b",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, unsafe := range []string{"<script>", "<b>", `<a href="https://evil.example">`, "javascript:"} {
+		if strings.Contains(rendered.HTML, unsafe) {
+			t.Errorf("HTML contains %s", unsafe)
+		}
+	}
+	for _, escaped := range []string{"&lt;script&gt;", "&lt;b&gt;night&lt;/b&gt;", "Second &lt;a href="} {
+		if !strings.Contains(rendered.HTML, escaped) {
+			t.Errorf("HTML doesn't contain %s", escaped)
+		}
+	}
+	// Each line of the content is its own line, without its HTML being interpreted
+	if !strings.Contains(rendered.HTML, "&lt;/script&gt;<br/>Second") {
+		t.Errorf("lines not separated in %s", rendered.HTML)
+	}
+	// The subject header is plain text
+	if rendered.Subject != `Tom & Jerry's <b>night</b>` {
+		t.Errorf("subject %q", rendered.Subject)
+	}
+	if !strings.Contains(rendered.Text, "<script>alert('hi')</script>\nSecond <a href=\"https://evil.example\">line</a>") {
+		t.Errorf("content changed in the text part:\n%s", rendered.Text)
+	}
+
+	if _, err = Render("nonexistent", nil); err == nil {
+		t.Error("rendered an unknown template")
+	}
+}
+
+func TestInlineCSS(t *testing.T) {
+	doc, err := inlineCSS(`<html><head>
+		<style>@import url('font.css');</style>
+		<style data-inline>
+			p { color: white; margin: 0 }
+			.note, h1 { font-size: 12px }
+			p.note { color: grey; }
+			.note { font-weight: bold }
+		</style>
+	</head><body>
+		<h1>Title</h1>
+		<p>Plain</p>
+		<p class="other note">Note</p>
+		<p class="note" style="color: red;">Overridden</p>
+		<div class="notes">Unstyled</div>
+	</body></html>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []string{
+		`<h1 style="font-size: 12px;">Title</h1>`,
+		`<p style="color: white; margin: 0;">Plain</p>`,
+		// Class rules come after element rules, and more specific rules after both
+		`<p class="other note" style="color: white; margin: 0; font-size: 12px; font-weight: bold; color: grey;">Note</p>`,
+		// Existing styles win over the style block
+		`<p class="note" style="color: white; margin: 0; font-size: 12px; font-weight: bold; color: grey; color: red;">Overridden</p>`,
+		`<div class="notes">Unstyled</div>`,
+		// Blocks which aren't inlined are kept
+		`<style>@import url('font.css');</style>`,
+	}
+	for _, want := range tests {
+		if !strings.Contains(doc, want) {
+			t.Errorf("missing %s in\n%s", want, doc)
+		}
+	}
+	if strings.Contains(doc, "data-inline") {
+		t.Errorf("inlined style block left in\n%s", doc)
+	}
+}
+
+func TestRenderInlinesLayout(t *testing.T) {
+	rendered, err := Render(VerificationTemplate, VerificationData{Code: "123456", Expires: "15 minutes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(rendered.HTML, "data-inline") || strings.Contains(rendered.HTML, ".header {") {
+		t.Error("layout styles left in a style block")
+	}
+	for _, want := range []string{`<body style="margin: 0 auto;`, `class="code" style="background-color: #111;`, `class="title" style="color: white;`} {
+		if !strings.Contains(rendered.HTML, want) {
+			t.Errorf("missing %s", want)
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	text, err := plainText(`<html><head><title>Ignored</title><style>p { color: red }</style></head><body>
+		<div class="header" data-text-skip><img src="logo.png" alt="Logo"><p>Skipped</p></div>
+		<h1>Games   night</h1>
+		<p>Starts <strong>at 7</strong>,<br>in the   <em>usual</em> room.</p>
+		<ul><li>Bring snacks</li><li>Bring <a href="https://netsoc.co/games">games</a></li></ul>
+		<p><a href="https://netsoc.co">https://netsoc.co</a></p>
+		<script>alert(1)</script>
+	</body></html>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Games night\n\nStarts at 7,\nin the usual room.\n\n" +
+		"- Bring snacks\n\n- Bring games (https://netsoc.co/games)\n\n" +
+		"https://netsoc.co\n"
+	if text != want {
+		t.Errorf("got\n%q\nwant\n%q", text, want)
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	rendered, err := Render(EventReminderTemplate, EventReminderData{
+		Title:       "Games night",
+		Description: "Bring snacks\nAnd <i>games</i>",
+		When:        "tomorrow at 19:00",
+		Duration:    "3 hours",
+		URL:         "https://netsoc.co/events/games",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Reminder: Games night\n",
+		"Games night starts tomorrow at 19:00 and runs for 3 hours.",
+		"Bring snacks\nAnd <i>games</i>",
+		"View event (https://netsoc.co/events/games)",
+	} {
+		if !strings.Contains(rendered.Text, want) {
+			t.Errorf("missing %q in\n%s", want, rendered.Text)
+		}
+	}
+	for _, unwanted := range []string{"<p", "<a", "<strong>", "UCC Netsoc logo", "font-size", "@import"} {
+		if strings.Contains(rendered.Text, unwanted) {
+			t.Errorf("%q left in\n%s", unwanted, rendered.Text)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package emails
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// Elements which start a new line in the plain text alternative
+var blockElements = map[string]bool{
+	"p": true, "div": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"ul": true, "ol": true, "tr": true, "table": true,
+}
+
+// plainText generates the plain text alternative of a rendered email.
+// Elements marked data-text-skip, such as the logo header, are left out and links keep their URL.
+func plainText(doc string) (string, error) {
+	root, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		return "", err
+	}
+	b := &strings.Builder{}
+	writeText(b, root)
+
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	text := blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text) + "\n", nil
+}
+
+func writeText(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(strings.ReplaceAll(n.Data, "\n", " "))
+		return
+	case html.ElementNode:
+		switch n.Data {
+		case "head", "style", "script":
+			return
+		case "br":
+			b.WriteString("\n")
+			return
+		case "a":
+			start := b.Len()
+			writeChildren(b, n)
+			label := strings.TrimSpace(b.String()[start:])
+			if href := attr(n, "href"); href != "" && href != label {
+				b.WriteString(" (" + href + ")")
+			}
+			return
+		}
+		if hasAttr(n, "data-text-skip") {
+			return
+		}
+		if n.Data == "li" {
+			b.WriteString("\n- ")
+			writeChildren(b, n)
+			b.WriteString("\n")
+			return
+		}
+		if blockElements[n.Data] {
+			b.WriteString("\n\n")
+			writeChildren(b, n)
+			b.WriteString("\n\n")
+			return
+		}
+	}
+	writeChildren(b, n)
+}
+
+func writeChildren(b *strings.Builder, n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		writeText(b, child)
+	}
+}
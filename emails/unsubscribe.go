@@ -0,0 +1,93 @@
+package emails
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/UCCNetsoc/discord-bot/store"
+)
+
+// CreateTables for newsletter unsubscriptions
+func CreateTables() error {
+	return store.CreateTables(
+		"CREATE TABLE IF NOT EXISTS newsletter_unsubscribes(email VARCHAR(320) PRIMARY KEY, unsubscribed_at TIMESTAMPTZ NOT NULL DEFAULT NOW());",
+	)
+}
+
+// ErrNoSecret is returned while newsletter.secret is empty, as anyone could sign unsubscribe tokens
+var ErrNoSecret = errors.New("newsletter.secret isn't set")
+
+// UnsubscribeToken is a per-recipient token, signed with newsletter.secret so nothing needs storing until it is used
+func UnsubscribeToken(email string) (string, error) {
+	if config.GetString("newsletter.secret") == "" {
+		return "", ErrNoSecret
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	return base64.RawURLEncoding.EncodeToString([]byte(email)) + "." + base64.RawURLEncoding.EncodeToString(tokenMAC(email)), nil
+}
+
+// VerifyUnsubscribeToken returns the email address a token was issued for
+func VerifyUnsubscribeToken(token string) (string, bool) {
+	if config.GetString("newsletter.secret") == "" {
+		return "", false
+	}
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+	email, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(mac, tokenMAC(string(email))) {
+		return "", false
+	}
+	return string(email), true
+}
+
+// UnsubscribeURL is the link included in each newsletter
+func UnsubscribeURL(email string) (string, error) {
+	token, err := UnsubscribeToken(email)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(config.GetString("api.public_url"), "/") + "/newsletter/unsubscribe?token=" + token, nil
+}
+
+// Unsubscribe stops newsletters being sent to an address
+func Unsubscribe(email string) error {
+	_, err := store.DB.Exec(
+		"INSERT INTO newsletter_unsubscribes(email) VALUES($1) ON CONFLICT (email) DO NOTHING;",
+		strings.ToLower(strings.TrimSpace(email)),
+	)
+	return err
+}
+
+// Unsubscribed returns the set of addresses which have unsubscribed
+func Unsubscribed() (map[string]bool, error) {
+	rows, err := store.DB.Query("SELECT email FROM newsletter_unsubscribes")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	emails := map[string]bool{}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		emails[email] = true
+	}
+	return emails, rows.Err()
+}
+
+func tokenMAC(email string) []byte {
+	mac := hmac.New(sha256.New, []byte(config.GetString("newsletter.secret")))
+	mac.Write([]byte(email))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,328 @@
+// Package feeds polls data sources and posts their new items to Discord channels.
+package feeds
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/store"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Errors are retried after an increasing delay, up to maxBackoff
+const (
+	minBackoff = 30 * time.Second
+	maxBackoff = 30 * time.Minute
+)
+
+// Item is a single update from a source
+type Item struct {
+	// Version identifies the item, the watcher remembers the last version posted
+	Version string
+	// Message is only built for new items, once per channel so attached files can be read again
+	Message func() (*discordgo.MessageSend, error)
+}
+
+// Source is polled for items, oldest first
+type Source interface {
+	Items(ctx context.Context) ([]Item, error)
+}
+
+// Feed posts the new items from a source to its channels
+type Feed struct {
+	// Name is used as the key for the persisted state
+	Name     string
+	Source   Source
+	Channels []string
+	Interval time.Duration
+	// Dedupe remembers every version posted rather than only the last,
+	// for sources like RSS where items don't arrive in version order
+	Dedupe bool
+	// Limit is the most items posted per poll, the rest wait for the next poll. 0 is unlimited.
+	Limit int
+}
+
+// Watcher runs every feed until it is stopped
+type Watcher struct {
+	session *discordgo.Session
+	lock    sync.Mutex
+	feeds   map[string]*Feed
+	cancels map[string]context.CancelFunc
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewWatcher for feeds posting with the given session
+func NewWatcher(s *discordgo.Session) *Watcher {
+	return &Watcher{session: s, feeds: map[string]*Feed{}, cancels: map[string]context.CancelFunc{}}
+}
+
+// Add a feed, replacing any feed with the same name. Feeds added after Start begin polling immediately.
+func (w *Watcher) Add(feed *Feed) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if cancel, ok := w.cancels[feed.Name]; ok {
+		cancel()
+		delete(w.cancels, feed.Name)
+	}
+	w.feeds[feed.Name] = feed
+	if w.ctx != nil {
+		w.startFeed(feed)
+	}
+}
+
+// SetInterval changes how often a feed is polled, once its current wait is over
+func (w *Watcher) SetInterval(name string, interval time.Duration) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if feed, ok := w.feeds[name]; ok {
+		feed.Interval = interval
+	}
+}
+
+// Remove stops polling a feed and forgets its state
+func (w *Watcher) Remove(name string) error {
+	w.lock.Lock()
+	if cancel, ok := w.cancels[name]; ok {
+		cancel()
+		delete(w.cancels, name)
+	}
+	delete(w.feeds, name)
+	w.lock.Unlock()
+
+	if _, err := store.DB.Exec("DELETE FROM feed_state WHERE name = $1;", name); err != nil {
+		return err
+	}
+	if _, err := store.DB.Exec("DELETE FROM feed_seen WHERE name = $1;", name); err != nil {
+		return err
+	}
+	_, err := store.DB.Exec("DELETE FROM feed_posted WHERE name = $1;", name)
+	return err
+}
+
+// Start polling every feed in the background
+func (w *Watcher) Start() error {
+	if err := store.CreateTables(
+		"CREATE TABLE IF NOT EXISTS feed_state(name VARCHAR(128) PRIMARY KEY, version TEXT NOT NULL, updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW());",
+		"CREATE TABLE IF NOT EXISTS feed_seen(name VARCHAR(128) NOT NULL, version TEXT NOT NULL, seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), PRIMARY KEY (name, version));",
+		"CREATE TABLE IF NOT EXISTS feed_posted(name VARCHAR(128) NOT NULL, version TEXT NOT NULL, channel_id VARCHAR(32) NOT NULL, posted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), PRIMARY KEY (name, version, channel_id));",
+	); err != nil {
+		return err
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	for _, feed := range w.feeds {
+		w.startFeed(feed)
+	}
+	return nil
+}
+
+// startFeed must be called with the lock held
+func (w *Watcher) startFeed(feed *Feed) {
+	ctx, cancel := context.WithCancel(w.ctx)
+	w.cancels[feed.Name] = cancel
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.run(ctx, feed)
+	}()
+}
+
+// Stop every feed and wait for them to finish
+func (w *Watcher) Stop() {
+	w.lock.Lock()
+	cancel := w.cancel
+	w.lock.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	w.wg.Wait()
+}
+
+func (w *Watcher) run(ctx context.Context, feed *Feed) {
+	logger := log.WithFields(log.Fields{"feed": feed.Name})
+	backoff := time.Duration(0)
+	for {
+		w.lock.Lock()
+		wait := feed.Interval
+		w.lock.Unlock()
+		if err := w.poll(ctx, feed); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			backoff = nextBackoff(backoff)
+			wait = backoff
+			logger.WithError(err).WithFields(log.Fields{"retry": backoff.String()}).Error("Failed to poll feed")
+		} else {
+			backoff = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func nextBackoff(previous time.Duration) time.Duration {
+	if previous == 0 {
+		return minBackoff
+	}
+	if previous*2 > maxBackoff {
+		return maxBackoff
+	}
+	return previous * 2
+}
+
+// poll posts the items after the last version seen.
+// The first poll of a feed only records the latest version, so history isn't posted.
+func (w *Watcher) poll(ctx context.Context, feed *Feed) error {
+	items, err := feed.Source.Items(ctx)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		// Recorded so the first items to turn up are posted, rather than taken for history
+		_, seen, err := lastVersion(feed.Name)
+		if err != nil || seen {
+			return err
+		}
+		return saveVersion(feed.Name, "")
+	}
+	if feed.Dedupe {
+		return w.pollUnseen(ctx, feed, items)
+	}
+	last, seen, err := lastVersion(feed.Name)
+	if err != nil {
+		return err
+	}
+	latest := items[len(items)-1].Version
+	if !seen {
+		return saveVersion(feed.Name, latest)
+	}
+	if latest == last {
+		return nil
+	}
+
+	// Items are new after the last seen version, or all of them if it has dropped out of the source
+	newItems := items
+	for idx, item := range items {
+		if item.Version == last {
+			newItems = items[idx+1:]
+		}
+	}
+	if feed.Limit > 0 && len(newItems) > feed.Limit {
+		newItems = newItems[:feed.Limit]
+	}
+	for _, item := range newItems {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err = w.post(feed, item); err != nil {
+			return err
+		}
+		// Saved as each item is posted so a failure part way through doesn't repost the earlier items
+		if err = saveVersion(feed.Name, item.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pollUnseen posts every item whose version hasn't been posted before.
+// The first poll of a feed marks every item as seen without posting.
+func (w *Watcher) pollUnseen(ctx context.Context, feed *Feed, items []Item) error {
+	_, initialised, err := lastVersion(feed.Name)
+	if err != nil {
+		return err
+	}
+	posted := 0
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var seen bool
+		err = store.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM feed_seen WHERE name = $1 AND version = $2);", feed.Name, item.Version).Scan(&seen)
+		if err != nil {
+			return err
+		}
+		if seen {
+			continue
+		}
+		if initialised {
+			if feed.Limit > 0 && posted >= feed.Limit {
+				// Left unseen for the next poll
+				break
+			}
+			// Left unseen so it is retried after the backoff
+			if err = w.post(feed, item); err != nil {
+				return err
+			}
+			posted++
+		}
+		if _, err = store.DB.Exec("INSERT INTO feed_seen(name, version) VALUES($1, $2) ON CONFLICT DO NOTHING;", feed.Name, item.Version); err != nil {
+			return err
+		}
+	}
+	return saveVersion(feed.Name, items[len(items)-1].Version)
+}
+
+// post an item to every channel of the feed, returning the errors from any channels it couldn't be posted to.
+// Each channel is recorded once it's posted to, so retrying after a failure only posts to the channels which failed.
+func (w *Watcher) post(feed *Feed, item Item) error {
+	log.WithFields(log.Fields{"feed": feed.Name, "version": item.Version}).Info("Posting new feed item")
+	errs := []error{}
+	for _, channelID := range feed.Channels {
+		var posted bool
+		err := store.DB.QueryRow(
+			"SELECT EXISTS(SELECT 1 FROM feed_posted WHERE name = $1 AND version = $2 AND channel_id = $3);", feed.Name, item.Version, channelID,
+		).Scan(&posted)
+		if err != nil {
+			return err
+		}
+		if posted {
+			continue
+		}
+		message, err := item.Message()
+		if err == nil {
+			_, err = w.session.ChannelMessageSendComplex(channelID, message)
+		}
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"feed": feed.Name, "channel": channelID}).Error("Failed to post feed item")
+			errs = append(errs, fmt.Errorf("posting %s to channel %s: %w", item.Version, channelID, err))
+			continue
+		}
+		_, err = store.DB.Exec(
+			"INSERT INTO feed_posted(name, version, channel_id) VALUES($1, $2, $3) ON CONFLICT DO NOTHING;", feed.Name, item.Version, channelID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func lastVersion(name string) (string, bool, error) {
+	var version string
+	err := store.DB.QueryRow("SELECT version FROM feed_state WHERE name = $1;", name).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	return version, err == nil, err
+}
+
+func saveVersion(name, version string) error {
+	_, err := store.DB.Exec(
+		"INSERT INTO feed_state(name, version) VALUES($1, $2) ON CONFLICT (name) DO UPDATE SET version = $2, updated_at = NOW();",
+		name, version,
+	)
+	return err
+}
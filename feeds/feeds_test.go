@@ -0,0 +1,390 @@
+package feeds
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/store"
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestMain(m *testing.M) {
+	log.InitSimpleLogger(&log.Config{Output: io.Discard})
+	os.Exit(m.Run())
+}
+
+// fakeStore keeps feed_state, feed_seen and feed_posted in memory, answering only the queries the watcher makes.
+// Opening it again keeps its rows, like the bot restarting against the same database.
+type fakeStore struct {
+	lock   sync.Mutex
+	state  map[string]string
+	seen   map[[2]string]bool
+	posted map[[3]string]bool
+}
+
+func useFakeStore(t *testing.T) *fakeStore {
+	t.Helper()
+	fake := &fakeStore{state: map[string]string{}, seen: map[[2]string]bool{}, posted: map[[3]string]bool{}}
+	previous := store.DB
+	store.DB = sql.OpenDB(fake)
+	t.Cleanup(func() {
+		store.DB.Close()
+		store.DB = previous
+	})
+	return fake
+}
+
+func (f *fakeStore) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeStore) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ store *fakeStore }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.store, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+type fakeStmt struct {
+	store *fakeStore
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.store.lock.Lock()
+	defer s.store.lock.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE"):
+	case strings.HasPrefix(s.query, "INSERT INTO feed_state"):
+		s.store.state[args[0].(string)] = args[1].(string)
+	case strings.HasPrefix(s.query, "INSERT INTO feed_seen"):
+		s.store.seen[[2]string{args[0].(string), args[1].(string)}] = true
+	case strings.HasPrefix(s.query, "INSERT INTO feed_posted"):
+		s.store.posted[[3]string{args[0].(string), args[1].(string), args[2].(string)}] = true
+	default:
+		return nil, fmt.Errorf("unexpected exec %q", s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.store.lock.Lock()
+	defer s.store.lock.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "SELECT version FROM feed_state"):
+		version, ok := s.store.state[args[0].(string)]
+		if !ok {
+			return &fakeRows{}, nil
+		}
+		return &fakeRows{values: []driver.Value{version}}, nil
+	case strings.HasPrefix(s.query, "SELECT EXISTS(SELECT 1 FROM feed_seen"):
+		return &fakeRows{values: []driver.Value{s.store.seen[[2]string{args[0].(string), args[1].(string)}]}}, nil
+	case strings.HasPrefix(s.query, "SELECT EXISTS(SELECT 1 FROM feed_posted"):
+		return &fakeRows{values: []driver.Value{s.store.posted[[3]string{args[0].(string), args[1].(string), args[2].(string)}]}}, nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", s.query)
+}
+
+// fakeRows is a single row of values, or no rows when values is nil
+type fakeRows struct {
+	values []driver.Value
+	read   bool
+}
+
+func (r *fakeRows) Columns() []string { return make([]string, len(r.values)) }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.values == nil || r.read {
+		return io.EOF
+	}
+	r.read = true
+	copy(dest, r.values)
+	return nil
+}
+
+// fakeDiscord records the embed titles posted to each channel. Posts to channels in broken fail.
+type fakeDiscord struct {
+	lock   sync.Mutex
+	posts  map[string][]string
+	broken map[string]bool
+}
+
+func newFakeDiscord(t *testing.T) (*discordgo.Session, *fakeDiscord) {
+	t.Helper()
+	fake := &fakeDiscord{posts: map[string][]string{}, broken: map[string]bool{}}
+	server := httptest.NewServer(fake)
+	previous := discordgo.EndpointChannels
+	discordgo.EndpointChannels = server.URL + "/channels/"
+	t.Cleanup(func() {
+		discordgo.EndpointChannels = previous
+		server.Close()
+	})
+	s, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, fake
+}
+
+func (f *fakeDiscord) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/channels/"), "/messages")
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.broken[channelID] {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"message": "Missing Access", "code": 50001}`)
+		return
+	}
+	message := discordgo.MessageSend{}
+	if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, emb := range message.Embeds {
+		f.posts[channelID] = append(f.posts[channelID], emb.Title)
+	}
+	json.NewEncoder(w).Encode(discordgo.Message{ID: "1", ChannelID: channelID})
+}
+
+func (f *fakeDiscord) setBroken(channelID string, broken bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.broken[channelID] = broken
+}
+
+// take the titles posted to a channel since the last take
+func (f *fakeDiscord) take(channelID string) []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	posts := f.posts[channelID]
+	delete(f.posts, channelID)
+	return posts
+}
+
+// serveFixtures serves whichever testdata file is stored in the returned value
+func serveFixtures(t *testing.T, name string) (string, *atomic.Value) {
+	t.Helper()
+	current := &atomic.Value{}
+	current.Store(name)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/"+current.Load().(string))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, current
+}
+
+func TestWatcherDedupesAcrossRestarts(t *testing.T) {
+	db := useFakeStore(t)
+	url, fixture := serveFixtures(t, "blog.rss")
+	ctx := context.Background()
+	feed := &Feed{Name: "rss-1", Source: &RSSSource{URL: url}, Channels: []string{"blog"}, Dedupe: true, Limit: 1}
+	session, discord := newFakeDiscord(t)
+	w := NewWatcher(session)
+
+	polls := []struct {
+		fixture string
+		want    []string
+	}{
+		// History isn't posted
+		{"blog.rss", nil},
+		// Two new entries, among reordered and edited ones, posted one at a time oldest first
+		{"blog-updated.rss", []string{"Hackathon results"}},
+		{"blog-updated.rss", []string{"Bot release 1.2"}},
+		{"blog-updated.rss", nil},
+		// Entries which dropped out of the feed and came back were seen already
+		{"blog.rss", nil},
+	}
+	for idx, poll := range polls {
+		fixture.Store(poll.fixture)
+		if err := w.poll(ctx, feed); err != nil {
+			t.Fatalf("poll %d: %v", idx, err)
+		}
+		if got := discord.take("blog"); strings.Join(got, "|") != strings.Join(poll.want, "|") {
+			t.Errorf("poll %d of %s posted %q, want %q", idx, poll.fixture, got, poll.want)
+		}
+	}
+
+	// A restarted bot, with a new connection, watcher and session, remembers what was posted
+	store.DB.Close()
+	store.DB = sql.OpenDB(db)
+	session, discord = newFakeDiscord(t)
+	w = NewWatcher(session)
+	fixture.Store("blog-updated.rss")
+	if err := w.poll(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+	if got := discord.take("blog"); len(got) != 0 {
+		t.Errorf("reposted %q after restarting", got)
+	}
+}
+
+func TestWatcherFilters(t *testing.T) {
+	useFakeStore(t)
+	url, fixture := serveFixtures(t, "blog.rss")
+	ctx := context.Background()
+	session, discord := newFakeDiscord(t)
+	w := NewWatcher(session)
+	// No entries match on the first poll, later matches are still new
+	feed := &Feed{Name: "rss-2", Source: &RSSSource{URL: url, Filter: regexp.MustCompile("(?i)hackathon|feed sub")}, Channels: []string{"releases"}, Dedupe: true}
+	if err := w.poll(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+	fixture.Store("blog-updated.rss")
+	if err := w.poll(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Hackathon results", "Bot release 1.2"}
+	if got := discord.take("releases"); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("posted %q, want %q", got, want)
+	}
+}
+
+func TestWatcherRetriesFailedPosts(t *testing.T) {
+	useFakeStore(t)
+	url, fixture := serveFixtures(t, "blog.rss")
+	ctx := context.Background()
+	session, discord := newFakeDiscord(t)
+	w := NewWatcher(session)
+	feed := &Feed{Name: "rss-3", Source: &RSSSource{URL: url}, Channels: []string{"blog"}, Dedupe: true}
+	if err := w.poll(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+
+	fixture.Store("blog-updated.rss")
+	discord.setBroken("blog", true)
+	if err := w.poll(ctx, feed); err == nil {
+		t.Error("poll succeeded without posting")
+	}
+	discord.setBroken("blog", false)
+	if err := w.poll(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Hackathon results", "Bot release 1.2"}
+	if got := discord.take("blog"); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("posted %q after the channel was fixed, want %q", got, want)
+	}
+}
+
+// fakeSource returns the items with the versions stored in it, each posted as an embed titled with its version
+type fakeSource struct {
+	lock     sync.Mutex
+	versions []string
+}
+
+func (f *fakeSource) set(versions ...string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.versions = versions
+}
+
+func (f *fakeSource) Items(ctx context.Context) ([]Item, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	items := []Item{}
+	for _, version := range f.versions {
+		version := version
+		items = append(items, Item{Version: version, Message: func() (*discordgo.MessageSend, error) {
+			return &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{{Title: version}}}, nil
+		}})
+	}
+	return items, nil
+}
+
+func TestWatcherLastVersion(t *testing.T) {
+	useFakeStore(t)
+	ctx := context.Background()
+	session, discord := newFakeDiscord(t)
+	w := NewWatcher(session)
+	source := &fakeSource{}
+	feed := &Feed{Name: "corona", Source: source, Channels: []string{"corona"}, Limit: 2}
+
+	polls := []struct {
+		versions []string
+		want     []string
+	}{
+		// The first poll only records where the feed is up to
+		{[]string{"a", "b", "c"}, nil},
+		{[]string{"a", "b", "c"}, nil},
+		// New versions after the last, a poll's worth at a time
+		{[]string{"b", "c", "d", "e", "f"}, []string{"d", "e"}},
+		{[]string{"b", "c", "d", "e", "f"}, []string{"f"}},
+		// Once the last version drops out of the source, everything in it is new
+		{[]string{"x", "y", "z"}, []string{"x", "y"}},
+		{[]string{"x", "y", "z"}, []string{"z"}},
+		{nil, nil},
+		{[]string{"x", "y", "z"}, nil},
+	}
+	for idx, poll := range polls {
+		source.set(poll.versions...)
+		if err := w.poll(ctx, feed); err != nil {
+			t.Fatalf("poll %d: %v", idx, err)
+		}
+		if got := discord.take("corona"); strings.Join(got, "|") != strings.Join(poll.want, "|") {
+			t.Errorf("poll %d of %v posted %q, want %q", idx, poll.versions, got, poll.want)
+		}
+	}
+
+	// A feed which was empty on its first poll posts the first items to turn up
+	empty := &Feed{Name: "vaccines", Source: &fakeSource{}, Channels: []string{"vaccines"}}
+	if err := w.poll(ctx, empty); err != nil {
+		t.Fatal(err)
+	}
+	empty.Source.(*fakeSource).set("first")
+	if err := w.poll(ctx, empty); err != nil {
+		t.Fatal(err)
+	}
+	if got := discord.take("vaccines"); strings.Join(got, "|") != "first" {
+		t.Errorf("posted %q after an empty first poll, want the first item", got)
+	}
+}
+
+func TestWatcherRetriesOnlyFailedChannels(t *testing.T) {
+	for _, dedupe := range []bool{false, true} {
+		useFakeStore(t)
+		ctx := context.Background()
+		session, discord := newFakeDiscord(t)
+		w := NewWatcher(session)
+		source := &fakeSource{}
+		feed := &Feed{Name: "feed", Source: source, Channels: []string{"public", "committee"}, Dedupe: dedupe}
+		source.set("a")
+		if err := w.poll(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+
+		source.set("a", "b")
+		discord.setBroken("committee", true)
+		for attempt := 0; attempt < 2; attempt++ {
+			if err := w.poll(ctx, feed); err == nil {
+				t.Errorf("dedupe %t: poll succeeded with a broken channel", dedupe)
+			}
+		}
+		discord.setBroken("committee", false)
+		if err := w.poll(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.poll(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+		// Posted once to each channel, however many times it was retried
+		for _, channelID := range feed.Channels {
+			if got := discord.take(channelID); strings.Join(got, "|") != "b" {
+				t.Errorf("dedupe %t: posted %q to %s, want b once", dedupe, got, channelID)
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package feeds
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/UCCNetsoc/discord-bot/embed"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Largest feed document read
+const maxFeedSize = 5 << 20
+
+var (
+	htmlTags   = regexp.MustCompile(`<[^>]*>`)
+	whitespace = regexp.MustCompile(`\s+`)
+	feedClient = &http.Client{Timeout: 15 * time.Second}
+)
+
+// Entry is an item from an RSS or Atom feed
+type Entry struct {
+	GUID      string
+	Title     string
+	Link      string
+	Summary   string
+	Published time.Time
+}
+
+// Document is a parsed RSS or Atom feed
+type Document struct {
+	Title   string
+	Link    string
+	Entries []Entry
+}
+
+type rssDocument struct {
+	Channel struct {
+		Title string `xml:"title"`
+		Link  string `xml:"link"`
+		Items []struct {
+			GUID        string `xml:"guid"`
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			Description string `xml:"description"`
+			PubDate     string `xml:"pubDate"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomDocument struct {
+	Title   string     `xml:"title"`
+	Links   []atomLink `xml:"link"`
+	Entries []struct {
+		ID        string     `xml:"id"`
+		Title     string     `xml:"title"`
+		Links     []atomLink `xml:"link"`
+		Summary   string     `xml:"summary"`
+		Content   string     `xml:"content"`
+		Published string     `xml:"published"`
+		Updated   string     `xml:"updated"`
+	} `xml:"entry"`
+}
+
+func atomHref(links []atomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	if len(links) > 0 {
+		return links[0].Href
+	}
+	return ""
+}
+
+var dateLayouts = []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", "2006-01-02T15:04:05Z07:00"}
+
+func parseFeedDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ParseFeed reads an RSS 2.0 or Atom document, returning its entries oldest first
+func ParseFeed(r io.Reader) (*Document, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxFeedSize))
+	if err != nil {
+		return nil, err
+	}
+	root := struct {
+		XMLName xml.Name
+	}{}
+	if err = xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("not a valid feed: %w", err)
+	}
+
+	doc := &Document{}
+	switch root.XMLName.Local {
+	case "rss":
+		rss := rssDocument{}
+		if err = xml.Unmarshal(data, &rss); err != nil {
+			return nil, err
+		}
+		doc.Title, doc.Link = rss.Channel.Title, rss.Channel.Link
+		for _, item := range rss.Channel.Items {
+			doc.Entries = append(doc.Entries, Entry{
+				GUID:      firstNonEmpty(item.GUID, item.Link, item.Title),
+				Title:     item.Title,
+				Link:      item.Link,
+				Summary:   item.Description,
+				Published: parseFeedDate(item.PubDate),
+			})
+		}
+	case "feed":
+		atom := atomDocument{}
+		if err = xml.Unmarshal(data, &atom); err != nil {
+			return nil, err
+		}
+		doc.Title, doc.Link = atom.Title, atomHref(atom.Links)
+		for _, entry := range atom.Entries {
+			link := atomHref(entry.Links)
+			doc.Entries = append(doc.Entries, Entry{
+				GUID:      firstNonEmpty(entry.ID, link, entry.Title),
+				Title:     entry.Title,
+				Link:      link,
+				Summary:   firstNonEmpty(entry.Summary, entry.Content),
+				Published: parseFeedDate(firstNonEmpty(entry.Published, entry.Updated)),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported feed type <%s>", root.XMLName.Local)
+	}
+
+	// Feeds usually list the newest entry first
+	for i, j := 0, len(doc.Entries)-1; i < j; i, j = i+1, j-1 {
+		doc.Entries[i], doc.Entries[j] = doc.Entries[j], doc.Entries[i]
+	}
+	// Undated entries go after the dated ones, in the reversed feed order like the rest
+	sort.SliceStable(doc.Entries, func(i, j int) bool {
+		a, b := doc.Entries[i].Published, doc.Entries[j].Published
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero() && b.IsZero()
+		}
+		return a.Before(b)
+	})
+	return doc, nil
+}
+
+// FetchFeed downloads and parses a feed
+func FetchFeed(ctx context.Context, url string) (*Document, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "UCCNetsoc-discord-bot")
+	resp, err := feedClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return ParseFeed(resp.Body)
+}
+
+// RSSSource is a feed of the entries in an RSS or Atom document whose title or summary match a filter
+type RSSSource struct {
+	URL    string
+	Filter *regexp.Regexp
+}
+
+// Items implements Source
+func (r *RSSSource) Items(ctx context.Context) ([]Item, error) {
+	doc, err := FetchFeed(ctx, r.URL)
+	if err != nil {
+		return nil, err
+	}
+	items := []Item{}
+	for _, entry := range doc.Entries {
+		if r.Filter != nil && !r.Filter.MatchString(entry.Title) && !r.Filter.MatchString(entry.Summary) {
+			continue
+		}
+		entry := entry
+		items = append(items, Item{
+			Version: entry.GUID,
+			Message: func() (*discordgo.MessageSend, error) {
+				return &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{entryEmbed(doc, entry)}}, nil
+			},
+		})
+	}
+	return items, nil
+}
+
+func entryEmbed(doc *Document, entry Entry) *discordgo.MessageEmbed {
+	emb := embed.NewEmbed().
+		SetTitle(firstNonEmpty(strings.TrimSpace(entry.Title), "New post")).
+		SetDescription(plainSummary(entry.Summary, 300)).
+		SetAuthor(doc.Title).
+		SetColor(0xf26522)
+	emb.TruncateTitle()
+	emb.URL = entry.Link
+	if !entry.Published.IsZero() {
+		emb.Timestamp = entry.Published.Format(time.RFC3339)
+	}
+	return emb.MessageEmbed
+}
+
+// plainSummary strips markup from a summary and shortens it to about limit characters
+func plainSummary(summary string, limit int) string {
+	text := html.UnescapeString(htmlTags.ReplaceAllString(summary, " "))
+	text = strings.TrimSpace(whitespace.ReplaceAllString(text, " "))
+	if runes := []rune(text); len(runes) > limit {
+		text = strings.TrimSpace(string(runes[:limit])) + "…"
+	}
+	return text
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
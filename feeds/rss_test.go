@@ -0,0 +1,145 @@
+package feeds
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFeed(t *testing.T) {
+	tests := []struct {
+		fixture string
+		title   string
+		link    string
+		guids   []string
+		// The first entry, oldest first
+		first Entry
+	}{
+		{
+			fixture: "blog.rss",
+			title:   "Netsoc Blog",
+			link:    "https://blog.netsoc.co",
+			// Undated entries go last, and entries without a GUID use their link
+			guids: []string{"https://blog.netsoc.co/posts/1", "post-2", "post-3", "post-faq", "post-pinned"},
+			first: Entry{
+				GUID:      "https://blog.netsoc.co/posts/1",
+				Title:     "Welcome back",
+				Link:      "https://blog.netsoc.co/posts/1",
+				Published: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			fixture: "releases.atom",
+			title:   "discord-bot releases",
+			link:    "https://github.com/UCCNetsoc/discord-bot/releases",
+			guids:   []string{"tag:github.com,2008:Repository/1/v1.1.0", "tag:github.com,2008:Repository/1/v1.2.0", "https://github.com/UCCNetsoc/discord-bot/releases/tag/nightly"},
+			// The summary and published date are preferred over the content and updated date
+			first: Entry{
+				GUID:      "tag:github.com,2008:Repository/1/v1.1.0",
+				Title:     "v1.1.0",
+				Link:      "https://github.com/UCCNetsoc/discord-bot/releases/tag/v1.1.0",
+				Summary:   "Autocomplete",
+				Published: time.Date(2024, 3, 4, 11, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			f, err := os.Open("testdata/" + test.fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			doc, err := ParseFeed(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.Title != test.title || doc.Link != test.link {
+				t.Errorf("feed %q at %s, want %q at %s", doc.Title, doc.Link, test.title, test.link)
+			}
+			guids := []string{}
+			for _, entry := range doc.Entries {
+				guids = append(guids, entry.GUID)
+			}
+			if strings.Join(guids, " ") != strings.Join(test.guids, " ") {
+				t.Errorf("entries %q, want %q", guids, test.guids)
+			}
+			first := doc.Entries[0]
+			if first.GUID != test.first.GUID || first.Title != test.first.Title || first.Link != test.first.Link ||
+				first.Summary != test.first.Summary || !first.Published.Equal(test.first.Published) {
+				t.Errorf("first entry %+v, want %+v", first, test.first)
+			}
+		})
+	}
+}
+
+func TestParseFeedUndatedOrder(t *testing.T) {
+	// Alternating dated and undated entries, newest first, so a comparator treating undated entries
+	// as equal to every other entry would leave them mixed in
+	doc, err := ParseFeed(strings.NewReader(`<rss><channel>
+		<item><guid>d</guid><pubDate>Thu, 04 Jan 2024 00:00:00 +0000</pubDate></item>
+		<item><guid>x</guid></item>
+		<item><guid>c</guid><pubDate>Wed, 03 Jan 2024 00:00:00 +0000</pubDate></item>
+		<item><guid>y</guid></item>
+		<item><guid>a</guid><pubDate>Mon, 01 Jan 2024 00:00:00 +0000</pubDate></item>
+		<item><guid>z</guid></item>
+		<item><guid>b</guid><pubDate>Tue, 02 Jan 2024 00:00:00 +0000</pubDate></item>
+	</channel></rss>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	guids := ""
+	for _, entry := range doc.Entries {
+		guids += entry.GUID
+	}
+	if guids != "abcdzyx" {
+		t.Errorf("entries in order %s, want abcdzyx", guids)
+	}
+}
+
+func TestParseFeedInvalid(t *testing.T) {
+	for name, document := range map[string]string{
+		"not xml":     "<html><body>",
+		"unsupported": `<?xml version="1.0"?><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"></rdf:RDF>`,
+	} {
+		if _, err := ParseFeed(strings.NewReader(document)); err == nil {
+			t.Errorf("%s: parsed without an error", name)
+		}
+	}
+}
+
+func TestRSSSource(t *testing.T) {
+	url, _ := serveFixtures(t, "blog.rss")
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{"", []string{"https://blog.netsoc.co/posts/1", "post-2", "post-3", "post-faq", "post-pinned"}},
+		// Titles and summaries are matched, with the markup left in
+		{"(?i)release", []string{"post-2"}},
+		{"(?i)autocomplete|<b>agm", []string{"post-2", "post-3"}},
+		{"nothing matches", []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			source := &RSSSource{URL: url}
+			if test.filter != "" {
+				source.Filter = regexp.MustCompile(test.filter)
+			}
+			items, err := source.Items(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			versions := []string{}
+			for _, item := range items {
+				versions = append(versions, item.Version)
+			}
+			if strings.Join(versions, " ") != strings.Join(test.want, " ") {
+				t.Errorf("items %q, want %q", versions, test.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,7 @@
 package main
 
 import (
-	"crypto/tls"
 	"flag"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -11,22 +9,23 @@ import (
 	"github.com/UCCNetsoc/discord-bot/commands"
 
 	"github.com/UCCNetsoc/discord-bot/api"
+	"github.com/UCCNetsoc/discord-bot/corona"
+	"github.com/UCCNetsoc/discord-bot/feeds"
 	"github.com/UCCNetsoc/discord-bot/prometheus"
 	"github.com/UCCNetsoc/discord-bot/status"
+	"github.com/UCCNetsoc/discord-bot/store"
 
 	"github.com/Strum355/log"
 	"github.com/UCCNetsoc/discord-bot/config"
 	"github.com/bwmarrin/discordgo"
-	"github.com/spf13/viper"
 )
 
 var production *bool
 
 func main() {
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // Take this out when corona API is deborked
-
 	// Check for flags
 	production = flag.Bool("p", false, "enables production with json logging")
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "optional YAML config file, reloaded when it changes")
 	flag.Parse()
 	if *production {
 		log.InitJSONLogger(&log.Config{Output: os.Stdout})
@@ -35,10 +34,13 @@ func main() {
 	}
 
 	// Setup viper and consul
-	exitError(config.InitConfig())
+	exitError(config.InitConfig(*configFile))
+	exitError(store.Open())
+	exitError(corona.Configure())
+	defer store.Close()
 
 	// Discord connection
-	token := viper.GetString("discord.token")
+	token := config.Get().Discord.Token
 	session, err := discordgo.New("Bot " + token)
 	session.Identify.Intents = discordgo.MakeIntent(discordgo.IntentsAll)
 	exitError(err)
@@ -53,6 +55,27 @@ func main() {
 
 	// Update the bot status periodically
 	go status.Status(session)
+	// Post scheduled announcements when they are due
+	go commands.ScheduledAnnouncements(session)
+	// Post updates from data feeds
+	watcher := feeds.NewWatcher(session)
+	if channel := config.GetString("discord.public.corona"); channel != "" {
+		watcher.Add(&feeds.Feed{Name: "corona", Source: corona.CasesSource{}, Channels: []string{channel}, Interval: config.GetDuration("corona.interval")})
+		watcher.Add(&feeds.Feed{Name: "vaccines", Source: corona.VaccinesSource{}, Channels: []string{channel}, Interval: config.GetDuration("corona.interval")})
+		config.OnReload(func(cfg *config.Config) {
+			watcher.SetInterval("corona", cfg.Corona.Interval)
+			watcher.SetInterval("vaccines", cfg.Corona.Interval)
+		})
+	}
+	if err = commands.WatchFeeds(watcher); err != nil {
+		log.WithError(err).Error("Failed to load feed subscriptions")
+	}
+	if err = watcher.Start(); err != nil {
+		log.WithError(err).Error("Failed to start feeds")
+	}
+
+	// Apply config changes from SIGHUP or the config file without reconnecting
+	config.Watch()
 
 	// Maintain connection until a SIGTERM, then cleanly exit
 	log.Info("Bot is Running")
@@ -60,6 +83,7 @@ func main() {
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, os.Kill)
 	<-sc
 	log.Info("Cleanly exiting")
+	watcher.Stop()
 	session.Close()
 }
 
@@ -0,0 +1,280 @@
+// Package minecraft implements the Minecraft Server List Ping protocol.
+// https://wiki.vg/Server_List_Ping
+package minecraft
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPort is used when an address has no port and no SRV record
+const DefaultPort = 25565
+
+// Response of Server List Ping query
+type Response struct {
+	Version     Version
+	Players     Players
+	Description Description
+	Favicon     string
+	// Round trip time of the ping packet
+	Latency time.Duration `json:"-"`
+}
+
+// Version ...
+type Version struct {
+	Name     string
+	Protocol int
+}
+
+// Players ...
+type Players struct {
+	Max    int
+	Online int
+	Sample []Player
+}
+
+// Player ...
+type Player struct {
+	Name string
+	ID   string
+}
+
+// Description is the server MOTD, which may be a plain string or a chat component
+type Description struct {
+	Text string
+}
+
+type chatComponent struct {
+	Text  string          `json:"text"`
+	Extra []chatComponent `json:"extra"`
+}
+
+func (c chatComponent) String() string {
+	b := strings.Builder{}
+	b.WriteString(c.Text)
+	for _, extra := range c.Extra {
+		b.WriteString(extra.String())
+	}
+	return b.String()
+}
+
+// UnmarshalJSON flattens chat components into their text
+func (d *Description) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &d.Text)
+	}
+	component := chatComponent{}
+	if err := json.Unmarshal(data, &component); err != nil {
+		return err
+	}
+	d.Text = component.String()
+	return nil
+}
+
+// Client queries servers using the given protocol version in its handshake
+type Client struct {
+	// -1 by convention when the client doesn't know which version the server runs
+	Protocol int32
+	Timeout  time.Duration
+	Resolver *net.Resolver
+}
+
+// DefaultClient is used by Query
+var DefaultClient = &Client{Protocol: -1, Timeout: 5 * time.Second, Resolver: net.DefaultResolver}
+
+// Query a server with the default client
+func Query(ctx context.Context, address string) (*Response, error) {
+	return DefaultClient.Query(ctx, address)
+}
+
+// Query a server, falling back to the legacy ping for servers older than 1.7
+func (c *Client) Query(ctx context.Context, address string) (*Response, error) {
+	res, err := c.Ping(ctx, address)
+	if err == nil {
+		return res, nil
+	}
+	legacy, legacyErr := c.LegacyPing(ctx, address)
+	if legacyErr != nil {
+		return nil, err
+	}
+	return legacy, nil
+}
+
+// Resolve splits an address into the host sent in the handshake and the address to dial.
+// Without a port the _minecraft._tcp SRV record is used if there is one, otherwise the default port.
+func (c *Client) Resolve(ctx context.Context, address string) (host string, port uint16, dial string, err error) {
+	if h, p, splitErr := net.SplitHostPort(address); splitErr == nil {
+		parsed, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return "", 0, "", fmt.Errorf("invalid port in %q", address)
+		}
+		return h, uint16(parsed), address, nil
+	}
+	host = address
+	_, records, err := c.resolver().LookupSRV(ctx, "minecraft", "tcp", host)
+	if err == nil && len(records) > 0 {
+		target := strings.TrimSuffix(records[0].Target, ".")
+		return host, records[0].Port, net.JoinHostPort(target, strconv.Itoa(int(records[0].Port))), nil
+	}
+	return host, DefaultPort, net.JoinHostPort(host, strconv.Itoa(DefaultPort)), nil
+}
+
+// Ping performs the status handshake and request, then measures latency with a ping packet
+func (c *Client) Ping(ctx context.Context, address string) (*Response, error) {
+	host, port, dial, err := c.Resolve(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := c.dial(ctx, dial)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Handshake - https://wiki.vg/Server_List_Ping#Handshake
+	handshake := &bytes.Buffer{}
+	writeVarInt(handshake, c.Protocol)
+	writeString(handshake, host)
+	binary.Write(handshake, binary.BigEndian, port)
+	writeVarInt(handshake, 1) // Next state: status
+	if err = writePacket(conn, 0x00, handshake.Bytes()); err != nil {
+		return nil, err
+	}
+
+	// Request - https://wiki.vg/Server_List_Ping#Status_Request
+	if err = writePacket(conn, 0x00, nil); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	id, payload, err := readPacket(reader)
+	if err != nil {
+		return nil, err
+	}
+	if id != 0x00 {
+		return nil, fmt.Errorf("unexpected packet 0x%02x in place of status response", id)
+	}
+	status, err := readString(payload)
+	if err != nil {
+		return nil, err
+	}
+	res := &Response{}
+	if err = json.Unmarshal([]byte(status), res); err != nil {
+		return nil, err
+	}
+
+	// Ping - https://wiki.vg/Server_List_Ping#Ping_Request
+	sent := time.Now()
+	ping := &bytes.Buffer{}
+	binary.Write(ping, binary.BigEndian, sent.UnixMilli())
+	if err = writePacket(conn, 0x01, ping.Bytes()); err != nil {
+		return res, nil
+	}
+	id, payload, err = readPacket(reader)
+	if err != nil || id != 0x01 {
+		// Some servers close the connection instead of replying, the status is still valid
+		return res, nil
+	}
+	if echoed, err := readLong(payload); err == nil && echoed == sent.UnixMilli() {
+		res.Latency = time.Since(sent)
+	}
+	return res, nil
+}
+
+// LegacyPing queries servers from 1.4 to 1.6, and most servers since for compatibility.
+// https://wiki.vg/Server_List_Ping#1.4_to_1.5
+func (c *Client) LegacyPing(ctx context.Context, address string) (*Response, error) {
+	_, _, dial, err := c.Resolve(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := c.dial(ctx, dial)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	sent := time.Now()
+	if _, err = conn.Write([]byte{0xfe, 0x01}); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	kick, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if kick != 0xff {
+		return nil, fmt.Errorf("unexpected packet 0x%02x in place of legacy kick", kick)
+	}
+	var length uint16
+	if err = binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	chars := make([]uint16, length)
+	if err = binary.Read(reader, binary.BigEndian, chars); err != nil {
+		return nil, err
+	}
+	latency := time.Since(sent)
+	return parseLegacy(decodeUTF16(chars), latency)
+}
+
+func parseLegacy(status string, latency time.Duration) (*Response, error) {
+	res := &Response{Latency: latency}
+	var online, max string
+	if strings.HasPrefix(status, "§1\x00") {
+		fields := strings.Split(status, "\x00")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("malformed legacy status %q", status)
+		}
+		res.Version.Protocol, _ = strconv.Atoi(fields[1])
+		res.Version.Name = fields[2]
+		res.Description.Text = fields[3]
+		online, max = fields[4], fields[5]
+	} else {
+		// Beta 1.8 to 1.3 - MOTD§online§max
+		fields := strings.Split(status, "§")
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("malformed legacy status %q", status)
+		}
+		res.Description.Text = strings.Join(fields[:len(fields)-2], "§")
+		online, max = fields[len(fields)-2], fields[len(fields)-1]
+	}
+	var err error
+	if res.Players.Online, err = strconv.Atoi(online); err != nil {
+		return nil, fmt.Errorf("malformed legacy player count %q", online)
+	}
+	if res.Players.Max, err = strconv.Atoi(max); err != nil {
+		return nil, fmt.Errorf("malformed legacy max players %q", max)
+	}
+	return res, nil
+}
+
+func (c *Client) dial(ctx context.Context, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.Timeout, Resolver: c.resolver()}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if c.Timeout > 0 && (!ok || time.Now().Add(c.Timeout).Before(deadline)) {
+		deadline, ok = time.Now().Add(c.Timeout), true
+	}
+	if ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+func (c *Client) resolver() *net.Resolver {
+	if c.Resolver != nil {
+		return c.Resolver
+	}
+	return net.DefaultResolver
+}
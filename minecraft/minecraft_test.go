@@ -0,0 +1,294 @@
+package minecraft
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/miekg/dns"
+)
+
+// serve handles each connection to a listener on 127.0.0.1, returning its address
+func serve(t *testing.T, handle func(conn net.Conn)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				handle(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+type handshake struct {
+	protocol  int32
+	host      string
+	port      uint16
+	nextState int32
+}
+
+// modernServer answers status requests with status, and pings when pong is set.
+// Each handshake is sent to the returned channel.
+func modernServer(t *testing.T, status string, pong bool) (string, <-chan handshake) {
+	t.Helper()
+	handshakes := make(chan handshake, 10)
+	address := serve(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		id, payload, err := readPacket(reader)
+		if err != nil || id != 0x00 {
+			return
+		}
+		h := handshake{}
+		h.protocol, _ = readVarInt(payload)
+		h.host, _ = readString(payload)
+		binary.Read(payload, binary.BigEndian, &h.port)
+		h.nextState, _ = readVarInt(payload)
+		handshakes <- h
+		if id, _, err = readPacket(reader); err != nil || id != 0x00 {
+			return
+		}
+		response := &bytes.Buffer{}
+		writeString(response, status)
+		writePacket(conn, 0x00, response.Bytes())
+		if !pong {
+			return
+		}
+		if id, payload, err = readPacket(reader); err == nil && id == 0x01 {
+			time.Sleep(time.Millisecond)
+			ping := make([]byte, payload.Len())
+			payload.Read(ping)
+			writePacket(conn, 0x01, ping)
+		}
+	})
+	return address, handshakes
+}
+
+// legacyServer answers 1.4+ legacy pings with status, and closes connections starting anything else
+func legacyServer(t *testing.T, status string) string {
+	t.Helper()
+	return serve(t, func(conn net.Conn) {
+		request := make([]byte, 2)
+		if _, err := conn.Read(request); err != nil || request[0] != 0xfe {
+			return
+		}
+		chars := utf16.Encode([]rune(status))
+		kick := &bytes.Buffer{}
+		kick.WriteByte(0xff)
+		binary.Write(kick, binary.BigEndian, uint16(len(chars)))
+		binary.Write(kick, binary.BigEndian, chars)
+		conn.Write(kick.Bytes())
+	})
+}
+
+const modernStatus = `{
+	"version": {"name": "1.20.4", "protocol": 765},
+	"players": {"max": 20, "online": 2, "sample": [{"name": "Notch", "id": "069a79f4-44e9-4726-a5be-fca90e38aaf5"}, {"name": "jeb_", "id": "853c80ef-3c37-49fd-aa49-938b674adae6"}]},
+	"description": {"text": "UCC ", "extra": [{"text": "Netsoc", "extra": [{"text": " Minecraft"}]}]},
+	"favicon": "data:image/png;base64,iVBORw0KGgo="
+}`
+
+func TestPing(t *testing.T) {
+	for _, pong := range []bool{true, false} {
+		address, handshakes := modernServer(t, modernStatus, pong)
+		client := &Client{Protocol: 765, Timeout: time.Second}
+		res, err := client.Ping(context.Background(), address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, port, _ := net.SplitHostPort(address)
+		portNumber, _ := strconv.Atoi(port)
+		if h := <-handshakes; h != (handshake{765, "127.0.0.1", uint16(portNumber), 1}) {
+			t.Errorf("handshake %+v", h)
+		}
+		if res.Version.Name != "1.20.4" || res.Players.Online != 2 || res.Players.Max != 20 || len(res.Players.Sample) != 2 || res.Players.Sample[1].Name != "jeb_" {
+			t.Errorf("got %+v", res)
+		}
+		// Chat components are flattened
+		if res.Description.Text != "UCC Netsoc Minecraft" {
+			t.Errorf("description %q", res.Description.Text)
+		}
+		// Servers which close the connection in place of a pong still give their status, without a latency
+		if pong != (res.Latency > 0) {
+			t.Errorf("latency %s with pong %t", res.Latency, pong)
+		}
+	}
+
+	address, _ := modernServer(t, `{"description": "Plain MOTD", "players": {"max": 10, "online": 0}}`, true)
+	res, err := Query(context.Background(), address)
+	if err != nil || res.Description.Text != "Plain MOTD" {
+		t.Errorf("got %+v, %v for a plain string MOTD", res, err)
+	}
+}
+
+func TestQueryLegacy(t *testing.T) {
+	address := legacyServer(t, "§1\x0074\x001.6.4\x00A Minecraft Server\x005\x0020")
+	res, err := (&Client{Protocol: -1, Timeout: time.Second}).Query(context.Background(), address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Version.Protocol != 74 || res.Version.Name != "1.6.4" || res.Description.Text != "A Minecraft Server" || res.Players.Online != 5 || res.Players.Max != 20 {
+		t.Errorf("got %+v", res)
+	}
+
+	tests := []struct {
+		status string
+		want   Response
+		err    bool
+	}{
+		{"Beta§MOTD§3§10", Response{Description: Description{"Beta§MOTD"}, Players: Players{Online: 3, Max: 10}}, false},
+		{"§1\x0074\x001.6.4\x00MOTD\x005", Response{}, true},
+		{"MOTD§3", Response{}, true},
+		{"MOTD§three§10", Response{}, true},
+	}
+	for _, test := range tests {
+		res, err := parseLegacy(test.status, 0)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q parsed as %+v", test.status, res)
+			}
+			continue
+		}
+		if err != nil || res.Description != test.want.Description || res.Players.Online != test.want.Players.Online || res.Players.Max != test.want.Players.Max {
+			t.Errorf("%q parsed as %+v, %v", test.status, res, err)
+		}
+	}
+}
+
+func TestPingMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply []byte
+		err   string
+	}{
+		{"oversized", []byte{0x80, 0x80, 0x80, 0x01}, "invalid packet length"},
+		{"truncated", []byte{0x7f, 0x00, 0x05, 'a'}, "unexpected EOF"},
+		{"wrong packet", []byte{0x02, 0x03, 0x00}, "unexpected packet 0x03"},
+		{"invalid JSON", []byte{0x04, 0x00, 0x02, '{', '!'}, "invalid character"},
+		{"string past the packet", []byte{0x03, 0x00, 0x10, 'a'}, "invalid string length"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			address := serve(t, func(conn net.Conn) {
+				reader := bufio.NewReader(conn)
+				readPacket(reader)
+				readPacket(reader)
+				conn.Write(test.reply)
+			})
+			// The legacy ping reads as the start of a long packet, so it times out
+			client := &Client{Protocol: -1, Timeout: 100 * time.Millisecond}
+			_, err := client.Ping(context.Background(), address)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got %v, want %s", err, test.err)
+			}
+			// The legacy ping fails too, so Query reports why the modern ping failed
+			if _, err = client.Query(context.Background(), address); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("query got %v, want %s", err, test.err)
+			}
+		})
+	}
+}
+
+// fakeDNS answers with the given records, and with no records for anything else
+func fakeDNS(t *testing.T, records ...string) *net.Resolver {
+	t.Helper()
+	answers := []dns.RR{}
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		answers = append(answers, rr)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		reply := &dns.Msg{}
+		reply.SetReply(req)
+		found := false
+		for _, rr := range answers {
+			if strings.EqualFold(rr.Header().Name, req.Question[0].Name) {
+				found = true
+				if rr.Header().Rrtype == req.Question[0].Qtype {
+					reply.Answer = append(reply.Answer, rr)
+				}
+			}
+		}
+		if !found {
+			reply.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(reply)
+	})}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	address, handshakes := modernServer(t, modernStatus, true)
+	_, port, _ := net.SplitHostPort(address)
+	client := &Client{Protocol: -1, Timeout: time.Second, Resolver: fakeDNS(t,
+		"_minecraft._tcp.mc.netsoc.test. 60 IN SRV 0 5 "+port+" play.netsoc.test.",
+		"play.netsoc.test. 60 IN A 127.0.0.1",
+	)}
+	ctx := context.Background()
+
+	tests := []struct {
+		address string
+		host    string
+		port    string
+		dial    string
+	}{
+		// The SRV record gives the server to dial, the handshake still has the address given
+		{"mc.netsoc.test", "mc.netsoc.test", port, "play.netsoc.test:" + port},
+		{"nosrv.netsoc.test", "nosrv.netsoc.test", "25565", "nosrv.netsoc.test:25565"},
+		// Ports skip the SRV lookup
+		{"mc.netsoc.test:1194", "mc.netsoc.test", "1194", "mc.netsoc.test:1194"},
+		{"[::1]:25566", "::1", "25566", "[::1]:25566"},
+	}
+	for _, test := range tests {
+		host, port, dial, err := client.Resolve(ctx, test.address)
+		if err != nil || host != test.host || strconv.Itoa(int(port)) != test.port || dial != test.dial {
+			t.Errorf("%s resolved to %s, %d, %s, %v", test.address, host, port, dial, err)
+		}
+	}
+	if _, _, _, err := client.Resolve(ctx, "mc.netsoc.test:99999"); err == nil {
+		t.Error("resolved an invalid port")
+	}
+
+	res, err := client.Ping(ctx, "mc.netsoc.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := <-handshakes; h.host != "mc.netsoc.test" || strconv.Itoa(int(h.port)) != port {
+		t.Errorf("handshake %+v after following the SRV record", h)
+	}
+	if res.Players.Online != 2 {
+		t.Errorf("got %+v", res)
+	}
+}
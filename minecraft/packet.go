@@ -0,0 +1,107 @@
+package minecraft
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// Largest packet the protocol allows, a 3 byte VarInt
+const maxPacketLength = 1<<21 - 1
+
+var errVarIntTooLong = errors.New("VarInt is longer than 5 bytes")
+
+// https://wiki.vg/Protocol#VarInt_and_VarLong
+func readVarInt(r io.ByteReader) (int32, error) {
+	var value uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint32(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(value), nil
+		}
+	}
+	return 0, errVarIntTooLong
+}
+
+func writeVarInt(w *bytes.Buffer, value int32) {
+	v := uint32(value)
+	for {
+		if v&^0x7f == 0 {
+			w.WriteByte(byte(v))
+			return
+		}
+		w.WriteByte(byte(v&0x7f | 0x80))
+		v >>= 7
+	}
+}
+
+func writeString(w *bytes.Buffer, s string) {
+	writeVarInt(w, int32(len(s)))
+	w.WriteString(s)
+}
+
+// writePacket frames the packet ID and payload with its length
+func writePacket(w io.Writer, id int32, payload []byte) error {
+	body := &bytes.Buffer{}
+	writeVarInt(body, id)
+	body.Write(payload)
+	packet := &bytes.Buffer{}
+	writeVarInt(packet, int32(body.Len()))
+	packet.Write(body.Bytes())
+	_, err := w.Write(packet.Bytes())
+	return err
+}
+
+// readPacket reads a length framed packet, returning its ID and payload
+func readPacket(r *bufio.Reader) (int32, *bytes.Reader, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if length <= 0 || length > maxPacketLength {
+		return 0, nil, fmt.Errorf("invalid packet length %d", length)
+	}
+	data := make([]byte, length)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	payload := bytes.NewReader(data)
+	id, err := readVarInt(payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, payload, nil
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	if length < 0 || int(length) > r.Len() {
+		return "", fmt.Errorf("invalid string length %d", length)
+	}
+	s := make([]byte, length)
+	if _, err = io.ReadFull(r, s); err != nil {
+		return "", err
+	}
+	return string(s), nil
+}
+
+func readLong(r *bytes.Reader) (int64, error) {
+	var value int64
+	err := binary.Read(r, binary.BigEndian, &value)
+	return value, err
+}
+
+func decodeUTF16(chars []uint16) string {
+	return string(utf16.Decode(chars))
+}
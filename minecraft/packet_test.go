@@ -0,0 +1,99 @@
+package minecraft
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestVarInt(t *testing.T) {
+	// Examples from https://wiki.vg/Protocol#VarInt_and_VarLong
+	tests := []struct {
+		value int32
+		bytes []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{255, []byte{0xff, 0x01}},
+		{25565, []byte{0xdd, 0xc7, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2147483647, []byte{0xff, 0xff, 0xff, 0xff, 0x07}},
+		{-1, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}},
+		{-2147483648, []byte{0x80, 0x80, 0x80, 0x80, 0x08}},
+	}
+	for _, test := range tests {
+		written := &bytes.Buffer{}
+		writeVarInt(written, test.value)
+		if !bytes.Equal(written.Bytes(), test.bytes) {
+			t.Errorf("%d written as % x, want % x", test.value, written.Bytes(), test.bytes)
+		}
+		read, err := readVarInt(bytes.NewReader(test.bytes))
+		if err != nil || read != test.value {
+			t.Errorf("% x read as %d, %v, want %d", test.bytes, read, err, test.value)
+		}
+	}
+
+	if _, err := readVarInt(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0x01})); !errors.Is(err, errVarIntTooLong) {
+		t.Errorf("6 byte VarInt read with %v", err)
+	}
+	if _, err := readVarInt(bytes.NewReader([]byte{0xff})); !errors.Is(err, io.EOF) {
+		t.Errorf("truncated VarInt read with %v", err)
+	}
+}
+
+func TestPacketFraming(t *testing.T) {
+	framed := &bytes.Buffer{}
+	if err := writePacket(framed, 0x01, []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	// Length of the ID and payload, the ID, then the payload
+	if want := []byte{0x04, 0x01, 1, 2, 3}; !bytes.Equal(framed.Bytes(), want) {
+		t.Errorf("framed as % x, want % x", framed.Bytes(), want)
+	}
+	id, payload, err := readPacket(bufio.NewReader(framed))
+	if err != nil || id != 0x01 || payload.Len() != 3 {
+		t.Errorf("read packet 0x%02x with %d bytes, %v", id, payload.Len(), err)
+	}
+
+	tests := []struct {
+		name   string
+		packet []byte
+		err    string
+	}{
+		{"empty", []byte{0x00}, "invalid packet length 0"},
+		{"negative length", []byte{0xff, 0xff, 0xff, 0xff, 0x0f}, "invalid packet length -1"},
+		{"oversized", []byte{0x80, 0x80, 0x80, 0x01}, "invalid packet length 2097152"},
+		{"truncated", []byte{0x0a, 0x00, 0x01, 0x02}, io.ErrUnexpectedEOF.Error()},
+		{"no length", []byte{}, io.EOF.Error()},
+		{"truncated ID", []byte{0x01, 0x80}, io.EOF.Error()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := readPacket(bufio.NewReader(bytes.NewReader(test.packet)))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got %v, want %s", err, test.err)
+			}
+		})
+	}
+}
+
+func TestReadString(t *testing.T) {
+	written := &bytes.Buffer{}
+	writeString(written, "A Minecraft Server §")
+	if s, err := readString(bytes.NewReader(written.Bytes())); err != nil || s != "A Minecraft Server §" {
+		t.Errorf("read %q, %v", s, err)
+	}
+	for name, data := range map[string][]byte{
+		"longer than the packet": {0x05, 'a', 'b'},
+		"negative length":        {0xff, 0xff, 0xff, 0xff, 0x0f},
+	} {
+		if _, err := readString(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: read without an error", name)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package minecraft
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// RCON packet types - https://wiki.vg/RCON#Packets
+const (
+	rconResponse int32 = 0
+	rconCommand  int32 = 2
+	rconLogin    int32 = 3
+)
+
+const (
+	// Longest command the server accepts
+	maxRCONCommand = 1446
+	// Largest response, 4096 bytes of payload after the ID, type and padding
+	maxRCONPacket = 4096 + 10
+)
+
+// ErrRCONAuth is returned when the server rejects the RCON password
+var ErrRCONAuth = errors.New("incorrect RCON password")
+
+// RCON is a logged in remote console connection, for running commands on a server.
+// https://wiki.vg/RCON
+type RCON struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	lastID int32
+}
+
+// DialRCON connects to the RCON port at address, which must include the port, and logs in
+func (c *Client) DialRCON(ctx context.Context, address, password string) (*RCON, error) {
+	conn, err := c.dial(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	r := &RCON{conn: conn, reader: bufio.NewReader(conn)}
+	id, _, err := r.request(rconLogin, password)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Failed logins are answered with an ID of -1
+	if id == -1 {
+		conn.Close()
+		return nil, ErrRCONAuth
+	}
+	return r, nil
+}
+
+// RCONAddress is the RCON port on the host the game server at address is reached on.
+// Addresses without a port follow the SRV record, as the game server is its target rather than the name given.
+func (c *Client) RCONAddress(ctx context.Context, address string, port int) (string, error) {
+	_, _, dial, err := c.Resolve(ctx, address)
+	if err != nil {
+		return "", err
+	}
+	host, _, err := net.SplitHostPort(dial)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// Command runs a command, without the leading slash, returning its output
+func (r *RCON) Command(command string) (string, error) {
+	if len(command) > maxRCONCommand {
+		return "", fmt.Errorf("command is longer than %d bytes", maxRCONCommand)
+	}
+	_, output, err := r.request(rconCommand, command)
+	return output, err
+}
+
+// Close the connection
+func (r *RCON) Close() error {
+	return r.conn.Close()
+}
+
+// request sends a packet and reads the reply, returning its ID and payload
+func (r *RCON) request(packetType int32, payload string) (int32, string, error) {
+	r.lastID++
+	packet := &bytes.Buffer{}
+	binary.Write(packet, binary.LittleEndian, int32(len(payload)+10))
+	binary.Write(packet, binary.LittleEndian, r.lastID)
+	binary.Write(packet, binary.LittleEndian, packetType)
+	packet.WriteString(payload)
+	packet.Write([]byte{0, 0})
+	if _, err := r.conn.Write(packet.Bytes()); err != nil {
+		return 0, "", err
+	}
+
+	var length int32
+	if err := binary.Read(r.reader, binary.LittleEndian, &length); err != nil {
+		return 0, "", err
+	}
+	if length < 10 || length > maxRCONPacket {
+		return 0, "", fmt.Errorf("invalid RCON packet length %d", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, data); err != nil {
+		return 0, "", err
+	}
+	id := int32(binary.LittleEndian.Uint32(data[0:4]))
+	replyType := int32(binary.LittleEndian.Uint32(data[4:8]))
+	if id != -1 && id != r.lastID {
+		return 0, "", fmt.Errorf("RCON reply to request %d in place of %d", id, r.lastID)
+	}
+	// Logins are answered with the command type
+	if packetType == rconLogin && replyType != rconCommand || packetType == rconCommand && replyType != rconResponse {
+		return 0, "", fmt.Errorf("unexpected RCON packet type %d", replyType)
+	}
+	return id, string(bytes.TrimRight(data[8:], "\x00")), nil
+}
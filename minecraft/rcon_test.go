@@ -0,0 +1,116 @@
+package minecraft
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRCON accepts one password and answers tell commands like a server with only the given player online
+func fakeRCON(t *testing.T, password, player string) (string, <-chan string) {
+	t.Helper()
+	commands := make(chan string, 10)
+	address := serve(t, func(conn net.Conn) {
+		loggedIn := false
+		for {
+			var length, id, packetType int32
+			if binary.Read(conn, binary.LittleEndian, &length) != nil {
+				return
+			}
+			body := make([]byte, length)
+			if _, err := io.ReadFull(conn, body); err != nil {
+				return
+			}
+			binary.Read(bytes.NewReader(body[0:4]), binary.LittleEndian, &id)
+			binary.Read(bytes.NewReader(body[4:8]), binary.LittleEndian, &packetType)
+			payload := string(bytes.TrimRight(body[8:], "\x00"))
+
+			reply, replyType := "", rconResponse
+			switch {
+			case packetType == rconLogin:
+				replyType = rconCommand
+				if loggedIn = payload == password; !loggedIn {
+					id = -1
+				}
+			case !loggedIn:
+				return
+			default:
+				commands <- payload
+				if fields := strings.Fields(payload); len(fields) < 2 || fields[1] != player {
+					reply = "No player was found"
+				}
+			}
+			packet := &bytes.Buffer{}
+			binary.Write(packet, binary.LittleEndian, int32(len(reply)+10))
+			binary.Write(packet, binary.LittleEndian, id)
+			binary.Write(packet, binary.LittleEndian, replyType)
+			packet.WriteString(reply + "\x00\x00")
+			conn.Write(packet.Bytes())
+		}
+	})
+	return address, commands
+}
+
+func TestRCON(t *testing.T) {
+	address, commands := fakeRCON(t, "hunter2", "Notch")
+	client := &Client{Timeout: time.Second}
+	ctx := context.Background()
+
+	if _, err := client.DialRCON(ctx, address, "wrong"); !errors.Is(err, ErrRCONAuth) {
+		t.Errorf("logged in with the wrong password: %v", err)
+	}
+
+	rcon, err := client.DialRCON(ctx, address, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rcon.Close()
+	for _, test := range []struct{ command, output string }{
+		{"tell Notch Your code is 123456", ""},
+		{"tell jeb_ Your code is 123456", "No player was found"},
+	} {
+		output, err := rcon.Command(test.command)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != test.output {
+			t.Errorf("%q output %q, want %q", test.command, output, test.output)
+		}
+		if received := <-commands; received != test.command {
+			t.Errorf("server received %q, want %q", received, test.command)
+		}
+	}
+	if _, err = rcon.Command(strings.Repeat("a", maxRCONCommand+1)); err == nil {
+		t.Error("sent a command longer than the server accepts")
+	}
+}
+
+func TestRCONAddress(t *testing.T) {
+	client := &Client{Resolver: fakeDNS(t,
+		"_minecraft._tcp.mc.netsoc.test. 60 IN SRV 0 5 25566 play.netsoc.test.",
+	)}
+	tests := []struct {
+		address string
+		want    string
+	}{
+		// The game server is the SRV target, not the name it's configured as
+		{"mc.netsoc.test", "play.netsoc.test:25575"},
+		{"nosrv.netsoc.test", "nosrv.netsoc.test:25575"},
+		{"mc.netsoc.test:25565", "mc.netsoc.test:25575"},
+		{"[::1]:25565", "[::1]:25575"},
+	}
+	for _, test := range tests {
+		if got, err := client.RCONAddress(context.Background(), test.address, 25575); err != nil || got != test.want {
+			t.Errorf("%s: RCON on %s, %v, want %s", test.address, got, err, test.want)
+		}
+	}
+	if _, err := client.RCONAddress(context.Background(), "mc.netsoc.test:99999", 25575); err == nil {
+		t.Error("got an RCON address for an invalid port")
+	}
+}
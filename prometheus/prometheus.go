@@ -19,7 +19,6 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/spf13/viper"
 )
 
 var (
@@ -39,13 +38,27 @@ var (
 			"server",
 			"channel",
 		})
+	minecraftOnline = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "minecraft_players_online",
+		Help: "The number of players online on each game server",
+	},
+		[]string{
+			"server",
+		})
+	minecraftMax = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "minecraft_players_max",
+		Help: "The maximum number of players allowed on each game server",
+	},
+		[]string{
+			"server",
+		})
 	globalSession *discordgo.Session
 	globalDB      *sql.DB
 )
 
 // MemberJoinLeave should be called every time a member joins or leaves.
 func MemberJoinLeave() {
-	servers := viper.Get("discord.servers").(*config.Servers)
+	servers := config.Get().Servers()
 	publicServer, err := utils.GetGuildPreview(globalSession, servers.PublicServer)
 	if err != nil {
 		log.WithError(err).Error("Failed to get Public Server guild")
@@ -76,6 +89,12 @@ func MessageDelete(server string, channel string) {
 	}
 }
 
+// MinecraftPlayers is called whenever a game server is polled
+func MinecraftPlayers(server string, online int, max int) {
+	minecraftOnline.WithLabelValues(server).Set(float64(online))
+	minecraftMax.WithLabelValues(server).Set(float64(max))
+}
+
 func createTables() {
 	_, err := globalDB.Exec("CREATE TABLE IF NOT EXISTS stats(name VARCHAR(20) PRIMARY KEY, value INT);")
 	if err != nil {
@@ -133,11 +152,11 @@ func setup(s *discordgo.Session) {
 func CreateExporter(s *discordgo.Session) {
 	db, err := sql.Open("postgres",
 		fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-			viper.GetString("sql.host"),
-			viper.GetInt("sql.port"),
-			viper.GetString("sql.username"),
-			viper.GetString("sql.password"),
-			viper.GetString("prom.dbname"),
+			config.GetString("sql.host"),
+			config.GetInt("sql.port"),
+			config.GetString("sql.username"),
+			config.GetString("sql.password"),
+			config.GetString("prom.dbname"),
 		),
 	)
 	if err != nil {
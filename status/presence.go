@@ -0,0 +1,182 @@
+package status
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/api"
+	"github.com/UCCNetsoc/discord-bot/commands"
+	"github.com/UCCNetsoc/discord-bot/config"
+	"github.com/UCCNetsoc/discord-bot/utils"
+	"github.com/bwmarrin/discordgo"
+)
+
+// errNothingToShow skips a provider without retrying, e.g. when there are no upcoming events
+var errNothingToShow = errors.New("nothing to show")
+
+// A provider returns the data for its status.<name>.template
+type provider func(s *discordgo.Session) (interface{}, error)
+
+var providers = map[string]provider{
+	"minecraft": minecraftPresence,
+	"event":     eventPresence,
+	"members":   membersPresence,
+	"uptime":    uptimePresence,
+}
+
+var started = time.Now()
+
+// rotatePresence cycles through status.providers, showing each for its status.<name>.interval.
+// Failing providers are retried status.retries times with an increasing backoff, then skipped until their next turn.
+func rotatePresence(s *discordgo.Session) {
+	for {
+		shown := false
+		for _, name := range presenceProviders() {
+			if err := showPresence(s, name); err != nil {
+				if !errors.Is(err, errNothingToShow) {
+					log.WithError(err).WithFields(log.Fields{"provider": name}).Error("Failed to update presence")
+				}
+				continue
+			}
+			shown = true
+			<-time.After(config.GetDuration(fmt.Sprintf("status.%s.interval", name)))
+		}
+		if !shown {
+			<-time.After(config.GetDuration("status.backoff"))
+		}
+	}
+}
+
+func presenceProviders() []string {
+	names := []string{}
+	for _, name := range strings.Split(config.GetString("status.providers"), ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := providers[name]; ok {
+			names = append(names, name)
+		} else if name != "" {
+			log.WithFields(log.Fields{"provider": name}).Error("Unknown presence provider")
+		}
+	}
+	return names
+}
+
+func showPresence(s *discordgo.Session, name string) error {
+	tmpl, err := template.New(name).Parse(config.GetString(fmt.Sprintf("status.%s.template", name)))
+	if err != nil {
+		return err
+	}
+	// A plain loop rather than try.Do, which gives up after try.MaxRetries whatever status.retries is
+	var data interface{}
+	for attempt := 1; ; attempt++ {
+		data, err = providers[name](s)
+		if err == nil || errors.Is(err, errNothingToShow) || attempt >= config.GetInt("status.retries") {
+			break
+		}
+		time.Sleep(time.Duration(attempt) * config.GetDuration("status.backoff"))
+	}
+	if err != nil {
+		return err
+	}
+	text := &bytes.Buffer{}
+	if err = tmpl.Execute(text, data); err != nil {
+		return err
+	}
+
+	switch activity := config.GetString(fmt.Sprintf("status.%s.activity", name)); activity {
+	case "watching":
+		return s.UpdateWatchStatus(0, text.String())
+	case "listening":
+		return s.UpdateListeningStatus(text.String())
+	default:
+		return s.UpdateGameStatus(0, text.String())
+	}
+}
+
+// Cycle through the reachable game servers from the latest poll
+var nextServer int
+
+func minecraftPresence(s *discordgo.Session) (interface{}, error) {
+	gameServersLock.RLock()
+	statuses := gameServers
+	gameServersLock.RUnlock()
+	for range statuses {
+		status := statuses[nextServer%len(statuses)]
+		nextServer++
+		if status.Err != nil {
+			continue
+		}
+		plural := "players"
+		if status.Response.Players.Online == 1 {
+			plural = "player"
+		}
+		return map[string]interface{}{
+			"Server":  status.Server.Name,
+			"Online":  status.Response.Players.Online,
+			"Max":     status.Response.Players.Max,
+			"Players": plural,
+		}, nil
+	}
+	if len(statuses) == 0 {
+		return nil, errNothingToShow
+	}
+	return nil, errors.New("no game servers are reachable")
+}
+
+func eventPresence(s *discordgo.Session) (interface{}, error) {
+	// The cached events, so the calendar isn't fetched every rotation
+	events, err := api.PublicEvents()
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		if event.Start != nil && event.Start.After(time.Now()) {
+			return map[string]interface{}{
+				"Title":     event.Summary,
+				"Countdown": countdown(time.Until(*event.Start)),
+				"Start":     event.Start.Format("Mon 2 Jan 15:04"),
+			}, nil
+		}
+	}
+	return nil, errNothingToShow
+}
+
+func membersPresence(s *discordgo.Session) (interface{}, error) {
+	servers := config.Get().Servers()
+	preview, err := utils.GetGuildPreview(s, servers.PublicServer)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"Members": preview.ApproximateMemberCount,
+		"Online":  preview.ApproximatePresenceCount,
+	}, nil
+}
+
+func uptimePresence(s *discordgo.Session) (interface{}, error) {
+	up, total := commands.SitesUp()
+	return map[string]interface{}{
+		"Up":     up,
+		"Total":  total,
+		"Uptime": countdown(time.Since(started)),
+	}, nil
+}
+
+// countdown is a coarse duration such as 3d 4h, precise enough for a status
+func countdown(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
@@ -1,33 +1,46 @@
 package status
 
 import (
-	"fmt"
+	"context"
+	"sync"
 	"time"
 
 	"github.com/Strum355/log"
 	"github.com/UCCNetsoc/discord-bot/commands"
+	"github.com/UCCNetsoc/discord-bot/prometheus"
 	"github.com/bwmarrin/discordgo"
 )
 
-// Status ...
+var (
+	// Result of the most recent game server poll
+	gameServers     []commands.ServerStatus
+	gameServersLock sync.RWMutex
+)
+
+// Status polls the game servers in the background and rotates the bot presence
 func Status(s *discordgo.Session) {
-	for {
-		minecraftPlayerCount(s)
-		wait := time.After(time.Minute)
-		<-wait
-	}
+	go pollGameServers(s)
+	rotatePresence(s)
 }
 
-func minecraftPlayerCount(s *discordgo.Session) {
-	resp, err := commands.Query()
-	if err != nil {
-		log.Error("Failed to query MC Server status: " + err.Error())
-		time.Sleep(time.Hour)
-	} else {
-		plural := "players"
-		if resp.Players.Online == 1 {
-			plural = "player"
+// pollGameServers queries every game server each minute, recording their players
+func pollGameServers(s *discordgo.Session) {
+	for {
+		statuses := commands.QueryGameServers(context.Background())
+		for _, status := range statuses {
+			if status.Err != nil {
+				log.WithFields(log.Fields{"server": status.Server.Host}).Error("Failed to query MC Server status: " + status.Err.Error())
+				continue
+			}
+			prometheus.MinecraftPlayers(status.Server.Name, status.Response.Players.Online, status.Response.Players.Max)
 		}
-		s.UpdateGameStatus(0, fmt.Sprintf("Minecraft %d %s online minecraft.netsoc.co", resp.Players.Online, plural))
+		gameServersLock.Lock()
+		gameServers = statuses
+		gameServersLock.Unlock()
+
+		commands.RecordGameServers(statuses)
+		commands.AnnounceJoins(s, statuses)
+		wait := time.After(commands.MinecraftPollInterval)
+		<-wait
 	}
 }
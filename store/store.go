@@ -0,0 +1,51 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Strum355/log"
+	"github.com/UCCNetsoc/discord-bot/config"
+	// Needed for postgres
+	_ "github.com/lib/pq"
+)
+
+// DB is the bot's own database, shared by features which need state to survive restarts
+var DB *sql.DB
+
+// Open sets up the connection pool, it should be called before anything uses the store.
+// Connections are made lazily so an unreachable database only fails the queries using it.
+func Open() error {
+	db, err := sql.Open("postgres",
+		fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+			config.GetString("sql.host"),
+			config.GetInt("sql.port"),
+			config.GetString("sql.username"),
+			config.GetString("sql.password"),
+			config.GetString("sql.dbname"),
+		),
+	)
+	if err != nil {
+		return err
+	}
+	DB = db
+	return nil
+}
+
+// CreateTables runs each CREATE TABLE IF NOT EXISTS statement, stopping at the first failure
+func CreateTables(statements ...string) error {
+	for _, statement := range statements {
+		if _, err := DB.Exec(statement); err != nil {
+			log.WithError(err).WithFields(log.Fields{"statement": statement}).Error("Failed to create table")
+			return err
+		}
+	}
+	return nil
+}
+
+// Close the connection pool
+func Close() {
+	if DB != nil {
+		DB.Close()
+	}
+}